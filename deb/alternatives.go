@@ -0,0 +1,63 @@
+package deb
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+)
+
+var reAlternativeName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._+-]*$`)
+
+// Alternative registers Path as a candidate for the generic name Link with
+// update-alternatives, e.g. /usr/bin/vim.tiny for /usr/bin/editor. The
+// alternative with the highest Priority is used unless the administrator
+// chooses one.
+type Alternative struct {
+	Link     string `json:"link"`
+	Name     string `json:"name,omitempty"` // Defaults to the base name of Link
+	Path     string `json:"path"`
+	Priority int    `json:"priority"`
+}
+
+func (a Alternative) name() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return path.Base(a.Link)
+}
+
+func (a Alternative) validate() error {
+	if !path.IsAbs(a.Link) || !path.IsAbs(a.Path) {
+		return fmt.Errorf("Alternative %q is invalid; link and path must be absolute paths", a.Link)
+	}
+	if !reAlternativeName.MatchString(a.name()) {
+		return fmt.Errorf("Alternative name %q is invalid; expected letters, digits, or ._+-", a.name())
+	}
+	if a.Priority < 0 {
+		return fmt.Errorf("Alternative %q is invalid; priority must not be negative", a.Link)
+	}
+	return nil
+}
+
+// alternativesSnippet registers the alternatives in postinst and removes them
+// in prerm
+func (p *PackageSpec) alternativesSnippet(name string) string {
+	if len(p.Alternatives) == 0 {
+		return ""
+	}
+	switch name {
+	case "postinst":
+		snippet := "if [ \"$1\" = \"configure\" ]; then\n"
+		for _, a := range p.Alternatives {
+			snippet += fmt.Sprintf("\tupdate-alternatives --install %s %s %s %d\n", a.Link, a.name(), a.Path, a.Priority)
+		}
+		return snippet + "fi\n"
+	case "prerm":
+		snippet := "if [ \"$1\" = \"remove\" ] || [ \"$1\" = \"deconfigure\" ]; then\n"
+		for _, a := range p.Alternatives {
+			snippet += fmt.Sprintf("\tupdate-alternatives --remove %s %s\n", a.name(), a.Path)
+		}
+		return snippet + "fi\n"
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package deb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAlternativesSnippets(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.Preinst = "#!/bin/sh\necho preinst\n"
+	p.Postinst = "#!/bin/sh\nset -e\n#DEBHELPER#\nexit 0\n"
+	p.Alternatives = []Alternative{
+		{Link: "/usr/bin/editor", Path: "/usr/local/bin/package1", Priority: 50},
+		{Link: "/usr/bin/pager", Name: "pager", Path: "/usr/local/bin/package1", Priority: 10},
+	}
+	if err := p.Validate(true); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "control.tar.gz")
+	if err := p.CreateControlArchive(filename); err != nil {
+		t.Fatal(err)
+	}
+	headers, contents := readTarGz(t, filename)
+
+	expected := `#!/bin/sh
+set -e
+if [ "$1" = "configure" ]; then
+	update-alternatives --install /usr/bin/editor editor /usr/local/bin/package1 50
+	update-alternatives --install /usr/bin/pager pager /usr/local/bin/package1 10
+fi
+exit 0
+`
+	if found := string(contents["postinst"]); found != expected {
+		t.Errorf("Expected postinst\n%s\n--Found--\n%s", expected, found)
+	}
+
+	// prerm doesn't exist so it is generated
+	expected = `#!/bin/sh
+set -e
+if [ "$1" = "remove" ] || [ "$1" = "deconfigure" ]; then
+	update-alternatives --remove editor /usr/local/bin/package1
+	update-alternatives --remove pager /usr/local/bin/package1
+fi
+`
+	if found := string(contents["prerm"]); found != expected {
+		t.Errorf("Expected prerm\n%s\n--Found--\n%s", expected, found)
+	}
+	if header := headers["prerm"]; header == nil || header.Mode != 0755 {
+		t.Errorf("Expected prerm to have mode 0755, found %+v", header)
+	}
+
+	if found := string(contents["preinst"]); found != p.Preinst {
+		t.Errorf("Expected preinst to be unchanged, found %q", found)
+	}
+	if _, ok := contents["postrm"]; ok {
+		t.Errorf("Expected no postrm")
+	}
+
+	for _, alternative := range []Alternative{
+		{Link: "usr/bin/editor", Path: "/usr/bin/vim"},
+		{Link: "/usr/bin/editor", Path: "/usr/bin/vim", Name: "my editor"},
+		{Link: "/usr/bin/editor", Path: "/usr/bin/vim", Priority: -1},
+	} {
+		p.Alternatives = []Alternative{alternative}
+		err := p.Validate(true)
+		if err == nil || !strings.Contains(err.Error(), "Alternative") {
+			t.Errorf("Expected %+v to be invalid; found %+v", alternative, err)
+		}
+	}
+}
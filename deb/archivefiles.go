@@ -0,0 +1,210 @@
+package deb
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cbednarski/mkdeb/deb/tar"
+
+	"github.com/klauspost/pgzip"
+)
+
+// walkArchiveFiles reads FromArchive and calls fn for each member listed in
+// ArchiveFiles, along with its normalized target path. Members are streamed
+// directly from the source archive so they are never extracted to disk.
+//
+// Tar (optionally gzipped) and zip archives are supported, based on the
+// extension of FromArchive.
+func (p *PackageSpec) walkArchiveFiles(fn func(target string, info os.FileInfo, r io.Reader) error) error {
+	if len(p.ArchiveFiles) == 0 {
+		return nil
+	}
+
+	found := map[string]bool{}
+	visit := func(name string, info os.FileInfo, r io.Reader) error {
+		name = strings.TrimPrefix(name, "./")
+		dest, ok := p.ArchiveFiles[name]
+		if !ok || found[name] {
+			return nil
+		}
+		found[name] = true
+		return fn(p.targetPath(dest), info, r)
+	}
+
+	var err error
+	switch {
+	case strings.HasSuffix(p.FromArchive, ".zip"):
+		err = p.walkZip(p.FromArchive, visit)
+	case strings.HasSuffix(p.FromArchive, ".tar"):
+		err = p.walkTar(p.FromArchive, false, visit)
+	case strings.HasSuffix(p.FromArchive, ".tar.gz"), strings.HasSuffix(p.FromArchive, ".tgz"):
+		err = p.walkTar(p.FromArchive, true, visit)
+	default:
+		return fmt.Errorf("Unsupported archive %q; expected .tar, .tar.gz, .tgz, or .zip", p.FromArchive)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed reading %q: %s", p.FromArchive, err)
+	}
+
+	missing := []string{}
+	for name := range p.ArchiveFiles {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("These files are missing from %q: %s", p.FromArchive, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// walkTar calls fn for each regular file in a tar archive
+func (p *PackageSpec) walkTar(filename string, gzipped bool, fn func(name string, info os.FileInfo, r io.Reader) error) error {
+	return p.walkTarHeaders(filename, gzipped, func(header *tar.Header, r io.Reader) error {
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			return nil
+		}
+		return fn(header.Name, header.FileInfo(), r)
+	})
+}
+
+// walkTarHeaders calls fn for every member of a tar archive, including
+// directories and links
+func (p *PackageSpec) walkTarHeaders(filename string, gzipped bool, fn func(header *tar.Header, r io.Reader) error) error {
+	file, err := p.open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if gzipped {
+		zipreader, err := pgzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer zipreader.Close()
+		reader = zipreader
+	}
+
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(header, archive); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *PackageSpec) walkZip(filename string, fn func(name string, info os.FileInfo, r io.Reader) error) error {
+	// zip needs random access to the file so we read it into memory if the
+	// source does not support it
+	file, err := p.open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := p.stat(filename)
+	if err != nil {
+		return err
+	}
+	readerAt, ok := file.(io.ReaderAt)
+	if !ok {
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		readerAt = bytes.NewReader(data)
+	}
+	archive, err := zip.NewReader(readerAt, info.Size())
+	if err != nil {
+		return err
+	}
+
+	for _, member := range archive.File {
+		if member.FileInfo().IsDir() {
+			continue
+		}
+		reader, err := member.Open()
+		if err != nil {
+			return err
+		}
+		err = fn(member.Name, member.FileInfo(), reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeArchiveFiles copies the members listed in ArchiveFiles into the data
+// archive. Their headers are normalized the same way as files on disk.
+func (p *PackageSpec) writeArchiveFiles(archive *tar.Writer) error {
+	// Members aren't tracked by git themselves, so under GitMTime they get
+	// the last commit that changed the archive
+	gitModTime := p.gitModTimes([]string{p.FromArchive})[p.FromArchive]
+
+	return p.walkArchiveFiles(func(target string, info os.FileInfo, r io.Reader) error {
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		reader := bufio.NewReader(r)
+		magic := func() []byte {
+			head, _ := reader.Peek(4)
+			return head
+		}
+		if err := p.normalizeHeader(header, target, info, gitModTime, magic); err != nil {
+			return err
+		}
+
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err = io.Copy(archive, reader)
+		return err
+	})
+}
+
+// archiveFileChecksums returns md5sums lines (or sha256sums, etc. depending
+// on newHash) for the members listed in ArchiveFiles.
+func (p *PackageSpec) archiveFileChecksums(newHash func() hash.Hash) ([]byte, error) {
+	data := []byte{}
+	err := p.walkArchiveFiles(func(target string, info os.FileInfo, r io.Reader) error {
+		hash := newHash()
+		if _, err := io.Copy(hash, r); err != nil {
+			return err
+		}
+		data = append(data, []byte(hex.EncodeToString(hash.Sum(nil))+"  "+target+"\n")...)
+		return nil
+	})
+	return data, err
+}
+
+// archiveFilesSize returns the total size in bytes of the members listed in
+// ArchiveFiles.
+func (p *PackageSpec) archiveFilesSize() (int64, error) {
+	size := int64(0)
+	err := p.walkArchiveFiles(func(target string, info os.FileInfo, r io.Reader) error {
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,120 @@
+package deb
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateDataArchiveFromArchive(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.FromArchive = path.Join("test-fixtures", "upstream-1.0.tar.gz")
+	p.ArchiveFiles = map[string]string{
+		"upstream-1.0/bin/upstream":      "/usr/bin/upstream",
+		"upstream-1.0/etc/upstream.conf": "/etc/upstream.conf",
+	}
+
+	filename := "test-data.tar.gz"
+	if err := p.CreateDataArchive(filename); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+
+	headers, contents := readTarGz(t, filename)
+
+	expected := "#!/bin/sh\necho upstream\n"
+	if found := string(contents["usr/bin/upstream"]); found != expected {
+		t.Errorf("Expected usr/bin/upstream to contain %q, found %q", expected, found)
+	}
+	if header, ok := headers["usr/bin/upstream"]; !ok || header.Mode&0777 != 0755 {
+		t.Errorf("Expected usr/bin/upstream with mode 0755, found %+v", header)
+	}
+
+	expected = "verbose = true\n"
+	if found := string(contents["etc/upstream.conf"]); found != expected {
+		t.Errorf("Expected etc/upstream.conf to contain %q, found %q", expected, found)
+	}
+
+	if _, ok := headers["upstream-1.0/README"]; ok {
+		t.Errorf("Found unexpected README in data archive")
+	}
+}
+
+func TestCreateDataArchiveFromArchiveClampMTime(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.AutoPath = "-"
+	p.BuildTime = time.Date(2020, time.March, 4, 5, 6, 7, 0, time.UTC)
+	p.ClampMTime = true
+	p.IgnoreFileModes = true
+	p.FromArchive = path.Join("test-fixtures", "upstream-1.0.tar.gz")
+	p.ArchiveFiles = map[string]string{
+		"upstream-1.0/bin/upstream":      "/usr/lib/upstream/upstream",
+		"upstream-1.0/etc/upstream.conf": "/etc/upstream.conf",
+	}
+
+	filename := "test-data.tar.gz"
+	if err := p.CreateDataArchive(filename); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+
+	headers, contents := readTarGz(t, filename)
+
+	modes := map[string]int64{
+		"usr/lib/upstream/upstream": 0755,
+		"etc/upstream.conf":         0644,
+	}
+	for name, mode := range modes {
+		header, ok := headers[name]
+		if !ok {
+			t.Errorf("Expected %s in data archive", name)
+			continue
+		}
+		if !header.ModTime.Equal(p.BuildTime) {
+			t.Errorf("Expected %s to have mtime %s, found %s", name, p.BuildTime, header.ModTime)
+		}
+		if header.Mode&0777 != mode {
+			t.Errorf("Expected %s to have mode %o, found %o", name, mode, header.Mode&0777)
+		}
+	}
+
+	// Sniffing for a #! must not consume the start of the file
+	expected := "#!/bin/sh\necho upstream\n"
+	if found := string(contents["usr/lib/upstream/upstream"]); found != expected {
+		t.Errorf("Expected usr/lib/upstream/upstream to contain %q, found %q", expected, found)
+	}
+}
+
+func TestCalculateChecksumsFromArchive(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.AutoPath = "-"
+	p.FromArchive = path.Join("test-fixtures", "upstream-1.0.tar.gz")
+	p.ArchiveFiles = map[string]string{
+		"upstream-1.0/bin/upstream": "/usr/bin/upstream",
+	}
+
+	data, err := p.CalculateChecksums()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "264418b13a34e1e9528581e447440b56  usr/bin/upstream\n"
+	if string(data) != expected {
+		t.Errorf("--Expected--\n%s\n--Found--\n%s\n", expected, data)
+	}
+}
+
+func TestFromArchiveMissingMember(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.FromArchive = path.Join("test-fixtures", "upstream-1.0.tar.gz")
+	p.ArchiveFiles = map[string]string{
+		"upstream-1.0/bin/missing": "/usr/bin/missing",
+	}
+
+	_, err := p.CalculateChecksums()
+	if err == nil || !strings.Contains(err.Error(), "upstream-1.0/bin/missing") {
+		t.Errorf("Expected missing member error; found %+v", err)
+	}
+}
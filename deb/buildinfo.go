@@ -0,0 +1,39 @@
+package deb
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// gitCommit returns the abbreviated hash of the commit checked out in the
+// current directory, or an empty string if it is not a git repository or git
+// is not installed. Tests replace this to avoid depending on git.
+var gitCommit = func() string {
+	output, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// buildInfo describes when the package was built, and from which git commit if
+// there is one, e.g. "Built: 2024-05-01 (abcd123)". This is added to the
+// extended description when BuildInfo is set.
+func (p *PackageSpec) buildInfo() string {
+	info := fmt.Sprintf("Built: %s", p.buildTime().UTC().Format("2006-01-02"))
+	if commit := gitCommit(); commit != "" {
+		info += fmt.Sprintf(" (%s)", commit)
+	}
+	return info
+}
+
+// description returns the Description control field, including the build
+// information if BuildInfo is set.
+func (p *PackageSpec) description() string {
+	if !p.BuildInfo || p.Description == "" {
+		return p.Description
+	}
+	// Lines in the extended description are indented by one space
+	return p.Description + "\n " + p.buildInfo()
+}
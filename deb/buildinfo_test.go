@@ -0,0 +1,40 @@
+package deb
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderControlFileBuildInfo(t *testing.T) {
+	defer func(original func() string) { gitCommit = original }(gitCommit)
+	gitCommit = func() string { return "abcd123" }
+
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.BuildTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	control, err := p.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(control), "Built:") {
+		t.Errorf("Expected no build info by default\n%s", control)
+	}
+
+	p.BuildInfo = true
+	control, err = p.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Description: A CLI tool for building debian packages\n Built: 2024-05-01 (abcd123)\n"
+	if !strings.HasSuffix(string(control), expected) {
+		t.Errorf("Expected control file to end with %q\n%s", expected, control)
+	}
+
+	// Outside of a git repository only the date is shown
+	gitCommit = func() string { return "" }
+	if info := p.buildInfo(); info != "Built: 2024-05-01" {
+		t.Errorf("Expected %q, found %q", "Built: 2024-05-01", info)
+	}
+}
@@ -0,0 +1,206 @@
+package deb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cbednarski/mkdeb/deb/tar"
+)
+
+// BundleConfig is the name of the config file inside a bundle. See
+// BuildFromTarball.
+const BundleConfig = "mkdeb.json"
+
+// BuildFromTarball builds a package from a bundle: a tar or tar.gz archive
+// with mkdeb.json at the top level and the files to package alongside it. The
+// config is loaded from the bundle, and paths in it like AutoPath and Files
+// refer to members of the bundle. The bundle is read into memory rather than
+// extracted to disk, so it must be small enough to fit in memory, and the
+// package is written to target. Bundles may contain files and directories, but
+// not symlinks or other special files.
+//
+// Since there is no -version flag here, the config in a bundle must also set
+// "version", which is ignored in regular config files.
+func BuildFromTarball(tarPath, target string) error {
+	p, err := NewPackageSpecFromTarball(tarPath)
+	if err != nil {
+		return err
+	}
+	return p.Build(target)
+}
+
+// NewPackageSpecFromTarball loads the config from a bundle and sets FS to the
+// rest of its contents. See BuildFromTarball.
+func NewPackageSpecFromTarball(tarPath string) (*PackageSpec, error) {
+	var gzipped bool
+	switch {
+	case strings.HasSuffix(tarPath, ".tar"):
+	case strings.HasSuffix(tarPath, ".tar.gz"), strings.HasSuffix(tarPath, ".tgz"):
+		gzipped = true
+	default:
+		return nil, fmt.Errorf("Unsupported bundle %q; expected .tar, .tar.gz, or .tgz", tarPath)
+	}
+
+	var config []byte
+	files := bundleFS{}
+	// walkTarHeaders only needs a PackageSpec to read tarPath, which is on disk
+	err := (&PackageSpec{}).walkTarHeaders(tarPath, gzipped, func(header *tar.Header, r io.Reader) error {
+		name := fsPath(header.Name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			files.add(name, header.FileInfo().Mode(), header.ModTime, nil)
+			return nil
+		case tar.TypeReg, tar.TypeRegA:
+		default:
+			return fmt.Errorf("%s is not a regular file or directory", header.Name)
+		}
+
+		// Every file is held in memory until the package is built
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if name == BundleConfig {
+			config = data
+			return nil
+		}
+		files.add(name, header.FileInfo().Mode(), header.ModTime, data)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed reading bundle %q: %s", tarPath, err)
+	}
+	if config == nil {
+		return nil, fmt.Errorf("Bundle %q does not contain %s", tarPath, BundleConfig)
+	}
+
+	p, err := NewPackageSpecFromJSON(config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %s in bundle %q: %s", BundleConfig, tarPath, err)
+	}
+	// Version is left out of PackageSpec's JSON so read it separately
+	bundle := struct {
+		Version string `json:"version"`
+	}{}
+	if err := json.Unmarshal(config, &bundle); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s in bundle %q: %s", BundleConfig, tarPath, err)
+	}
+	p.Version = bundle.Version
+	p.FS = files
+	return p, nil
+}
+
+// bundleFS is an in-memory fs.FS holding the contents of a bundle. It maps
+// slash-separated paths to files and directories. Parent directories are
+// added along with each file, so ReadDir can list any directory.
+type bundleFS map[string]*bundleFile
+
+// bundleFile is a file or directory in a bundleFS. It is also the
+// fs.FileInfo for itself.
+type bundleFile struct {
+	name    string
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (f *bundleFile) Name() string       { return f.name }
+func (f *bundleFile) Size() int64        { return int64(len(f.data)) }
+func (f *bundleFile) Mode() fs.FileMode  { return f.mode }
+func (f *bundleFile) ModTime() time.Time { return f.modTime }
+func (f *bundleFile) IsDir() bool        { return f.mode.IsDir() }
+func (f *bundleFile) Sys() interface{}   { return nil }
+
+// add puts a file or directory in the bundle. Missing parent directories are
+// created with mode 0755, and a directory that was created this way takes the
+// mode and modification time from the bundle when it is added explicitly.
+func (b bundleFS) add(name string, mode fs.FileMode, modTime time.Time, data []byte) {
+	b[name] = &bundleFile{name: path.Base(name), data: data, mode: mode, modTime: modTime}
+	for dir := path.Dir(name); name != "."; name, dir = dir, path.Dir(dir) {
+		if _, ok := b[dir]; ok {
+			break
+		}
+		b[dir] = &bundleFile{name: path.Base(dir), mode: fs.ModeDir | 0755, modTime: modTime}
+	}
+}
+
+// Open implements fs.FS
+func (b bundleFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	file, ok := b[name]
+	if !ok {
+		if name != "." {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		// An empty bundle still has a root directory
+		file = &bundleFile{name: ".", mode: fs.ModeDir | 0755}
+	}
+	open := &openBundleFile{bundleFile: file, path: name, Reader: bytes.NewReader(file.data)}
+	if file.IsDir() {
+		open.entries, _ = b.ReadDir(name)
+	}
+	return open, nil
+}
+
+// ReadDir implements fs.ReadDirFS
+func (b bundleFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if dir, ok := b[name]; !ok && name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	} else if ok && !dir.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries := []fs.DirEntry{}
+	for child, file := range b {
+		if child != "." && path.Dir(child) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(file))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// openBundleFile is a bundleFile that has been opened for reading. For
+// directories, entries holds the directory entries that haven't been read.
+type openBundleFile struct {
+	*bundleFile
+	*bytes.Reader
+	path    string
+	entries []fs.DirEntry
+}
+
+func (f *openBundleFile) Stat() (fs.FileInfo, error) { return f.bundleFile, nil }
+func (f *openBundleFile) Close() error               { return nil }
+
+func (f *openBundleFile) Read(b []byte) (int, error) {
+	if f.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.path, Err: errors.New("is a directory")}
+	}
+	return f.Reader.Read(b)
+}
+
+// ReadDir implements fs.ReadDirFile
+func (f *openBundleFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.path, Err: errors.New("not a directory")}
+	}
+	if n > 0 && len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > len(f.entries) {
+		n = len(f.entries)
+	}
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
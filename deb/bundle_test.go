@@ -0,0 +1,108 @@
+package deb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/cbednarski/mkdeb/deb/tar"
+)
+
+func TestBuildFromTarball(t *testing.T) {
+	target, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+
+	if err := BuildFromTarball("test-fixtures/bundle.tar.gz", target); err != nil {
+		t.Fatal(err)
+	}
+
+	headers, contents := readDeb(t, filepath.Join(target, "hello-1.0.0-all.deb"))
+	if len(headers) != 3 {
+		t.Fatalf("Expected 3 ar members, found %d", len(headers))
+	}
+	_, data := readTarGzData(t, bytes.NewReader(contents["data.tar.gz"]))
+	expected := "#!/bin/sh\necho hello\n"
+	if found := string(data["usr/bin/hello"]); found != expected {
+		t.Errorf("Expected usr/bin/hello to contain %q, found %q", expected, found)
+	}
+	if _, ok := data[BundleConfig]; ok {
+		t.Errorf("Expected %s to be left out of the data archive", BundleConfig)
+	}
+	_, control := readTarGzData(t, bytes.NewReader(contents["control.tar.gz"]))
+	if !strings.Contains(string(control["control"]), "Package: hello\n") {
+		t.Errorf("Expected control file for hello, found\n%s", control["control"])
+	}
+	if _, ok := control["postinst"]; !ok {
+		t.Errorf("Expected postinst in the control archive")
+	}
+}
+
+func TestBuildFromTarballMissingConfig(t *testing.T) {
+	err := BuildFromTarball("test-fixtures/upstream-1.0.tar.gz", "")
+	if err == nil || !strings.Contains(err.Error(), "does not contain mkdeb.json") {
+		t.Errorf("Expected missing config error, found %v", err)
+	}
+}
+
+func TestNewPackageSpecFromTarballFS(t *testing.T) {
+	p, err := NewPackageSpecFromTarball("test-fixtures/bundle.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(p.FS, "deb-pkg/etc/hello/settings", "deb-pkg/postinst", "deb-pkg/usr/bin/hello"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := p.stat("deb-pkg/usr/bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() || info.Mode().Perm() != 0755 {
+		t.Errorf("Expected deb-pkg/usr/bin to be a directory with mode 0755, found %s", info.Mode())
+	}
+}
+
+func TestNewPackageSpecFromTarballSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundle := filepath.Join(dir, "bundle.tar")
+	file, err := os.Create(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	archive := tar.NewWriter(file)
+	config := []byte(`{"package": "hello", "version": "1.0.0"}`)
+	for _, header := range []*tar.Header{
+		{Name: BundleConfig, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(config)), ModTime: time.Now()},
+		{Name: "deb-pkg/usr/bin/hi", Typeflag: tar.TypeSymlink, Linkname: "hello", Mode: 0777, ModTime: time.Now()},
+	} {
+		if err := archive.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			if _, err := archive.Write(config); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewPackageSpecFromTarball(bundle)
+	if err == nil || !strings.Contains(err.Error(), "deb-pkg/usr/bin/hi is not a regular file or directory") {
+		t.Errorf("Expected symlinks to be rejected, found %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package deb
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ChangelogVersion returns the version from the top entry of a Debian-style
+// changelog file, such as debian/changelog.
+func ChangelogVersion(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read changelog: %s", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		matches := reChangelogEntry.FindStringSubmatch(line)
+		if matches == nil {
+			return "", fmt.Errorf("Unable to find a version in %s; expected the first line to look like \"package (version) suite; urgency=low\"", filename)
+		}
+		version := matches[2]
+		if !reVersion.MatchString(version) {
+			return "", fmt.Errorf("Version %q in %s does not match debian version syntax", version, filename)
+		}
+		return version, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("Failed to read changelog: %s", err)
+	}
+	return "", fmt.Errorf("Changelog %s is empty", filename)
+}
+
+// ChangelogEntry formats a Debian changelog stanza for Version with message as
+// the list of changes, signed by Maintainer at date. Each line of message is
+// written as a separate change.
+func (p *PackageSpec) ChangelogEntry(message string, date time.Time) string {
+	entry := fmt.Sprintf("%s (%s) unstable; urgency=low\n\n", p.Package, p.Version)
+	for _, line := range strings.Split(strings.TrimSpace(message), "\n") {
+		entry += fmt.Sprintf("  * %s\n", strings.TrimSpace(line))
+	}
+	entry += fmt.Sprintf("\n -- %s  %s\n", p.Maintainer, date.Format(time.RFC1123Z))
+	return entry
+}
+
+// AddChangelogEntry prepends a new changelog stanza to filename (see
+// ChangelogEntry). The file is created if it does not already exist.
+func (p *PackageSpec) AddChangelogEntry(filename, message string, date time.Time) error {
+	existing, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to read changelog: %s", err)
+	}
+
+	data := p.ChangelogEntry(message, date)
+	if len(existing) > 0 {
+		data += "\n" + string(existing)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("Failed to create changelog directory: %s", err)
+	}
+	if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		return fmt.Errorf("Failed to write changelog: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package deb
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChangelogVersion(t *testing.T) {
+	version, err := ChangelogVersion(path.Join("test-fixtures", "changelog", "changelog"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "1.2.0-1" {
+		t.Errorf("Expected version %q, found %q", "1.2.0-1", version)
+	}
+}
+
+func TestChangelogVersionInvalid(t *testing.T) {
+	file, err := ioutil.TempFile("", "mkdeb-changelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	for _, contents := range []string{
+		"",
+		"this is not a changelog\n",
+		"package1 (not_a_version) unstable; urgency=low\n",
+	} {
+		if err := ioutil.WriteFile(file.Name(), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ChangelogVersion(file.Name()); err == nil {
+			t.Errorf("Expected error for changelog %q", contents)
+		}
+	}
+
+	if _, err := ChangelogVersion(path.Join("test-fixtures", "missing")); err == nil || !strings.Contains(err.Error(), "Failed to read") {
+		t.Errorf("Expected read error; found %+v", err)
+	}
+}
+
+func TestChangelogEntry(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "1.3.0-1"
+	date := time.Date(2017, time.January, 3, 15, 4, 5, 0, time.FixedZone("PST", -8*60*60))
+
+	expected := `mkdeb (1.3.0-1) unstable; urgency=low
+
+  * Fix a bug
+  * Add a feature
+
+ -- Chris Bednarski <banzaimonkey@gmail.com>  Tue, 03 Jan 2017 15:04:05 -0800
+`
+	if entry := p.ChangelogEntry("Fix a bug\nAdd a feature\n", date); entry != expected {
+		t.Errorf("Expected entry:\n%s\nFound:\n%s", expected, entry)
+	}
+}
+
+func TestAddChangelogEntry(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "1.3.0-1"
+
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	original, err := ioutil.ReadFile(path.Join("test-fixtures", "changelog", "changelog"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "debian", "changelog")
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Now()
+	if err := p.AddChangelogEntry(filename, "Fix a bug", date); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := p.ChangelogEntry("Fix a bug", date) + "\n" + string(original)
+	if string(data) != expected {
+		t.Errorf("Expected changelog:\n%s\nFound:\n%s", expected, data)
+	}
+
+	// The new entry should be picked up as the current version
+	if version, err := ChangelogVersion(filename); err != nil {
+		t.Fatal(err)
+	} else if version != p.Version {
+		t.Errorf("Expected version %q, found %q", p.Version, version)
+	}
+}
@@ -0,0 +1,162 @@
+package deb
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// checksumCacheName is the name of the cache file. See checksumCacheDir.
+const checksumCacheName = "mkdeb-checksums.json"
+
+// checksumEntry holds the cached checksums of a file for each algorithm. They
+// are only used while the file's size and modification time are the same as
+// when it was hashed.
+type checksumEntry struct {
+	Size    int64             `json:"size"`
+	ModTime int64             `json:"modTime"`
+	Sums    map[string]string `json:"sums"`
+}
+
+// checksumCache stores checksums of source files between builds when
+// ChecksumCache is set. The control and data archives are created in parallel
+// so access is guarded by a mutex.
+type checksumCache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]checksumEntry
+}
+
+// hashAlgorithm names the algorithm used by newHash, e.g. *md5.digest
+func hashAlgorithm(newHash func() hash.Hash) string {
+	return fmt.Sprintf("%T", newHash())
+}
+
+// checksumCacheDir returns the directory the checksum cache is saved in. This
+// is TempPath if it is set, or mkdeb in the user's cache directory (usually
+// ~/.cache/mkdeb). The shared system temp directory is not used since anyone
+// could create or replace the cache there.
+func (p *PackageSpec) checksumCacheDir() (string, error) {
+	if p.TempPath != "" {
+		return p.TempPath, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "mkdeb")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// openChecksumCache loads the checksum cache. A missing or unreadable cache is
+// not an error; the checksums are just calculated again.
+func (p *PackageSpec) openChecksumCache() {
+	dir, err := p.checksumCacheDir()
+	if err != nil {
+		log.Printf("Not using checksum cache: %s", err)
+		return
+	}
+	cache := &checksumCache{
+		path:    filepath.Join(dir, checksumCacheName),
+		entries: map[string]checksumEntry{},
+	}
+	if data, err := ioutil.ReadFile(cache.path); err == nil {
+		if err := json.Unmarshal(data, &cache.entries); err != nil {
+			log.Printf("Ignoring invalid checksum cache %s: %s", cache.path, err)
+			cache.entries = map[string]checksumEntry{}
+		}
+	}
+	p.checksumCache = cache
+}
+
+// closeChecksumCache saves the checksum cache. Entries for files that no longer
+// exist are dropped so the cache doesn't grow forever.
+func (p *PackageSpec) closeChecksumCache() {
+	cache := p.checksumCache
+	p.checksumCache = nil
+	if cache == nil {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	for source := range cache.entries {
+		if _, err := os.Stat(source); err != nil {
+			delete(cache.entries, source)
+		}
+	}
+
+	data, err := json.Marshal(cache.entries)
+	if err == nil {
+		err = writeFileAtomic(cache.path, data)
+	}
+	if err != nil {
+		log.Printf("Error saving checksum cache %s: %s", cache.path, err)
+	}
+}
+
+// writeFileAtomic writes data to a new temp file next to filename and renames
+// it into place, so concurrent builds never see a partially written file or
+// write to the same temp file
+func writeFileAtomic(filename string, data []byte) error {
+	temp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), filename)
+}
+
+// cachedHashFile is like hashFile, but uses the checksum cache when it is
+// open and the file is on the local filesystem
+func (p *PackageSpec) cachedHashFile(name string, newHash func() hash.Hash) (string, error) {
+	cache := p.checksumCache
+	source, local := p.source(name)
+	if cache == nil || !local {
+		return p.hashFile(name, newHash)
+	}
+
+	source, err := filepath.Abs(source)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		return "", err
+	}
+	algorithm := hashAlgorithm(newHash)
+
+	cache.mu.Lock()
+	entry, ok := cache.entries[source]
+	cache.mu.Unlock()
+	if !ok || entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		entry = checksumEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Sums: map[string]string{}}
+	} else if sum, ok := entry.Sums[algorithm]; ok {
+		return sum, nil
+	}
+
+	sum, err := p.hashFile(name, newHash)
+	if err != nil {
+		return "", err
+	}
+	cache.mu.Lock()
+	entry.Sums[algorithm] = sum
+	cache.entries[source] = entry
+	cache.mu.Unlock()
+	return sum, nil
+}
@@ -0,0 +1,132 @@
+package deb
+
+import (
+	"bytes"
+	"crypto/md5"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChecksumCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	autoPath := filepath.Join(dir, "deb-pkg")
+	if err := os.MkdirAll(filepath.Join(autoPath, "usr", "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	hello := filepath.Join(autoPath, "usr", "bin", "hello")
+	world := filepath.Join(autoPath, "usr", "bin", "world")
+	for _, file := range []string{hello, world} {
+		if err := ioutil.WriteFile(file, []byte("#!/bin/sh\necho "+filepath.Base(file)+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.AutoPath = autoPath
+	p.TempPath = dir
+	p.ChecksumCache = true
+	p.Force = true
+
+	target := filepath.Join(dir, "output")
+	md5sums := func() string {
+		if err := p.Build(target); err != nil {
+			t.Fatal(err)
+		}
+		_, contents := readDeb(t, filepath.Join(target, p.Filename()))
+		_, control := readTarGzData(t, bytes.NewReader(contents["control.tar.gz"]))
+		return string(control["md5sums"])
+	}
+
+	first := md5sums()
+	if _, err := os.Stat(filepath.Join(dir, checksumCacheName)); err != nil {
+		t.Fatalf("Expected the checksum cache to be saved: %s", err)
+	}
+	if second := md5sums(); second != first {
+		t.Errorf("Expected the same md5sums from the cache\n%s\n--Found--\n%s", first, second)
+	}
+
+	// Replace the cached checksum for hello to show that it is used
+	source, err := filepath.Abs(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.openChecksumCache()
+	entry := p.checksumCache.entries[source]
+	entry.Sums[hashAlgorithm(md5.New)] = "cached"
+	p.checksumCache.entries[source] = entry
+	p.closeChecksumCache()
+	if found := md5sums(); !strings.Contains(found, "cached  usr/bin/hello\n") {
+		t.Errorf("Expected the cached checksum for hello, found\n%s", found)
+	}
+
+	// Changing a file invalidates its cached checksum
+	if err := ioutil.WriteFile(hello, []byte("#!/bin/sh\necho changed\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(hello, future, future); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := p.md5SumFile(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := md5sums()
+	if !strings.Contains(found, sum+"  usr/bin/hello\n") {
+		t.Errorf("Expected the new checksum %s for hello, found\n%s", sum, found)
+	}
+	if !strings.Contains(first, strings.Split(found, "\n")[1]) {
+		t.Errorf("Expected world to be unchanged, found\n%s", found)
+	}
+}
+
+func TestChecksumCacheDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Without TempPath the cache goes in the user's cache directory rather
+	// than the shared temp directory
+	for _, name := range []string{"XDG_CACHE_HOME", "HOME"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, dir)
+	}
+	p := PackageSpecFixture(t)
+	p.ChecksumCache = true
+	p.openChecksumCache()
+	if p.checksumCache == nil {
+		t.Fatal("Expected the checksum cache to be open")
+	}
+	p.closeChecksumCache()
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(cacheDir, "mkdeb", checksumCacheName))
+	if err != nil {
+		t.Fatalf("Expected the checksum cache in %s: %s", cacheDir, err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the checksum cache to be private, found %s", info.Mode())
+	}
+	files, err := filepath.Glob(filepath.Join(cacheDir, "mkdeb", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("Expected only the checksum cache to be left behind, found %+v", files)
+	}
+}
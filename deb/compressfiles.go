@@ -0,0 +1,138 @@
+package deb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// compressedExtensions are file types that are already compressed, so
+// gzipping them again with CompressOver would only waste time
+var compressedExtensions = []string{
+	".gz", ".tgz", ".xz", ".txz", ".bz2", ".zst", ".lz", ".lzma", ".z", ".zip",
+	".7z", ".jar", ".png", ".jpg", ".jpeg", ".gif", ".webp", ".mp3", ".ogg",
+	".mp4", ".woff", ".woff2", ".deb",
+}
+
+// normalizeExtension returns ext in lowercase with a leading dot, so "TXT" and
+// ".txt" are the same
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// validateCompressExtensions checks that none of CompressExtensions are
+// already compressed
+func (p *PackageSpec) validateCompressExtensions() error {
+	for _, ext := range p.CompressExtensions {
+		if hasString(compressedExtensions, normalizeExtension(ext)) {
+			return fmt.Errorf("Compress extension %q is already compressed; remove it from compressExtensions", ext)
+		}
+	}
+	return nil
+}
+
+// shouldCompress returns true if file should be gzipped because of
+// CompressOver. Conffiles and executables are never compressed since they
+// would stop working.
+func (p *PackageSpec) shouldCompress(file, target string, info os.FileInfo) bool {
+	if p.CompressOver <= 0 || !info.Mode().IsRegular() || info.Size() <= int64(p.CompressOver) {
+		return false
+	}
+	if info.Mode().Perm()&0111 != 0 {
+		return false
+	}
+	if strings.HasPrefix(target, "etc/") || hasString(p.Conffiles, "/"+target) {
+		return false
+	}
+	ext := normalizeExtension(filepath.Ext(target))
+	if hasString(compressedExtensions, ext) {
+		return false
+	}
+	for _, allowed := range p.CompressExtensions {
+		if normalizeExtension(allowed) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// compressFiles gzips files in the package that match CompressOver and
+// CompressExtensions into ws. The compressed copies are used for the rest of
+// the build, and are installed with a .gz extension added to their name.
+func (p *PackageSpec) compressFiles(ws string) error {
+	if p.CompressOver <= 0 {
+		return nil
+	}
+	files, err := p.ListFiles(false)
+	if err != nil {
+		return err
+	}
+
+	compressedRoot := filepath.Join(ws, "compressed")
+	compressedFiles := map[string]string{}
+	for _, file := range files {
+		target, err := p.normalizeFilename(file)
+		if err != nil {
+			return err
+		}
+		info, err := p.stat(file)
+		if err != nil {
+			return err
+		}
+		if !p.shouldCompress(file, target, info) {
+			continue
+		}
+
+		compressed := filepath.Join(compressedRoot, filepath.FromSlash(target)+".gz")
+		if err := p.gzipFile(file, compressed, info); err != nil {
+			return fmt.Errorf("Failed to compress %s: %s", file, err)
+		}
+		compressedFiles[file] = compressed
+	}
+	p.compressedFiles = compressedFiles
+	return nil
+}
+
+// gzipFile writes a gzipped copy of file to dest with the same mode and
+// modification time, so the package is the same as if the file had been
+// compressed beforehand
+func (p *PackageSpec) gzipFile(file, dest string, info os.FileInfo) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	source, err := p.open(file)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zipwriter, err := newCompressor(out, "gzip")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zipwriter, source); err != nil {
+		return err
+	}
+	if err := zipwriter.Close(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(dest, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(dest, info.ModTime(), info.ModTime())
+}
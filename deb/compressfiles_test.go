@@ -0,0 +1,96 @@
+package deb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildCompressOver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	large := []byte(strings.Repeat("All work and no play makes Jack a dull boy.\n", 200))
+	root := filepath.Join(dir, "deb-pkg")
+	for name, data := range map[string][]byte{
+		"usr/share/doc/mkdeb/manual.txt": large,
+		"usr/share/doc/mkdeb/README.txt": []byte("small\n"),
+		"usr/share/doc/mkdeb/notes.md":   large,
+		"usr/share/doc/mkdeb/old.txt.gz": large,
+		"etc/mkdeb/defaults.txt":         large,
+	} {
+		filename := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.AutoPath = root
+	p.CompressOver = 1024
+	p.CompressExtensions = []string{".txt"}
+
+	output := filepath.Join(dir, "output")
+	if err := p.Build(output); err != nil {
+		t.Fatal(err)
+	}
+
+	_, contents := readDeb(t, filepath.Join(output, p.Filename()))
+	headers, data := readTarGzData(t, bytes.NewReader(contents["data.tar.gz"]))
+
+	compressed, ok := data["usr/share/doc/mkdeb/manual.txt.gz"]
+	if !ok {
+		t.Fatalf("Expected manual.txt to be compressed, found %+v", headers)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uncompressed, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(uncompressed, large) {
+		t.Errorf("Expected manual.txt.gz to contain the original file")
+	}
+	if size := headers["usr/share/doc/mkdeb/manual.txt.gz"].Size; size != int64(len(compressed)) || size >= int64(len(large)) {
+		t.Errorf("Expected the compressed size in the header, found %d", size)
+	}
+
+	// Small files, other extensions, compressed files, and conffiles are left
+	// alone
+	for _, name := range []string{
+		"usr/share/doc/mkdeb/README.txt",
+		"usr/share/doc/mkdeb/notes.md",
+		"usr/share/doc/mkdeb/old.txt.gz",
+		"etc/mkdeb/defaults.txt",
+	} {
+		if _, ok := data[name]; !ok {
+			t.Errorf("Expected %s to be uncompressed", name)
+		}
+	}
+
+	_, control := readTarGzData(t, bytes.NewReader(contents["control.tar.gz"]))
+	expected := fmt.Sprintf("%x  usr/share/doc/mkdeb/manual.txt.gz\n", md5.Sum(compressed))
+	if !strings.Contains(string(control["md5sums"]), expected) {
+		t.Errorf("Expected md5sums to contain %q\n%s", expected, control["md5sums"])
+	}
+
+	p.CompressExtensions = []string{".txt", "gz"}
+	if err := p.Validate(false); err == nil || !strings.Contains(err.Error(), `Compress extension "gz" is already compressed`) {
+		t.Errorf("Expected compressed extension to be invalid, found %v", err)
+	}
+}
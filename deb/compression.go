@@ -0,0 +1,108 @@
+package deb
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/cbednarski/mkdeb/deb/tar"
+
+	"github.com/klauspost/pgzip"
+	"github.com/ulikunitz/xz"
+)
+
+// compressions lists the supported values for ControlCompression and
+// DataCompression. An empty value is the same as gzip.
+var compressions = []string{"gzip", "xz", "none"}
+
+// ControlArchiveName returns the name of the control archive member in the
+// .deb, e.g. control.tar.gz, based on ControlCompression.
+func (p *PackageSpec) ControlArchiveName() string {
+	return "control.tar" + compressionExtension(p.ControlCompression)
+}
+
+// DataArchiveName returns the name of the data archive member in the .deb,
+// e.g. data.tar.xz, based on DataCompression.
+func (p *PackageSpec) DataArchiveName() string {
+	return "data.tar" + compressionExtension(p.DataCompression)
+}
+
+func compressionExtension(compression string) string {
+	switch compression {
+	case "xz":
+		return ".xz"
+	case "none":
+		return ""
+	}
+	return ".gz"
+}
+
+func validateCompression(field, compression string) error {
+	if compression != "" && !hasString(compressions, compression) {
+		return fmt.Errorf("%s %q is not supported; expected one of %s", field, compression, strings.Join(compressions, ", "))
+	}
+	return nil
+}
+
+// newCompressor returns a writer that compresses everything written to it into
+// w. The returned writer must be closed to flush the compressed stream, but
+// closing it does not close w.
+func newCompressor(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case "", "gzip":
+		return pgzip.NewWriter(w), nil
+	case "xz":
+		return xz.NewWriter(w)
+	case "none":
+		return nopWriteCloser{w}, nil
+	}
+	return nil, validateCompression("Compression", compression)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// tarFormats are the formats allowed for TarFormat
+var tarFormats = []string{"pax", "gnu", "ustar"}
+
+// newTarWriter creates a tar writer for the control or data archive using
+// TarFormat, which defaults to pax
+func (p *PackageSpec) newTarWriter(w io.Writer) (*tar.Writer, error) {
+	format := p.TarFormat
+	if format == "" {
+		format = "pax"
+	}
+	archive := tar.NewWriter(w)
+	if err := archive.SetFormat(format); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// newDecompressor returns a reader for the archive member name, decompressing
+// it based on its extension, e.g. data.tar.xz. This uses compress/gzip rather
+// than pgzip because pgzip reads ahead in the background, and r is usually
+// shared with an ar.Reader that moves on to the next member. Close the reader
+// when you are done with it.
+func newDecompressor(r io.Reader, name string) (io.ReadCloser, error) {
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"):
+		return gzip.NewReader(r)
+	case strings.HasSuffix(name, ".tar.xz"):
+		reader, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(reader), nil
+	case strings.HasSuffix(name, ".tar"):
+		return ioutil.NopCloser(r), nil
+	}
+	return nil, fmt.Errorf("Unsupported archive %q", name)
+}
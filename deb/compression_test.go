@@ -0,0 +1,185 @@
+package deb
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/cbednarski/mkdeb/deb/tar"
+
+	"github.com/ulikunitz/xz"
+)
+
+func TestBuildCompression(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.ControlCompression = "gzip"
+	p.DataCompression = "xz"
+
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+
+	if err := p.Build("output"); err != nil {
+		t.Fatal(err)
+	}
+
+	headers, contents := readDeb(t, filename)
+	expected := []string{"debian-binary", "control.tar.gz", "data.tar.xz"}
+	if len(headers) != len(expected) {
+		t.Fatalf("Expected %d ar members, found %d", len(expected), len(headers))
+	}
+	for i, header := range headers {
+		if header.Name != expected[i] {
+			t.Errorf("Expected member %d to be %q, found %q", i, expected[i], header.Name)
+		}
+	}
+
+	// The control archive is still gzipped
+	controlHeaders, _ := readTarGzData(t, bytes.NewReader(contents["control.tar.gz"]))
+	if _, ok := controlHeaders["control"]; !ok {
+		t.Errorf("Expected control in control.tar.gz")
+	}
+
+	// The data archive is xz compressed
+	reader, err := xz.NewReader(bytes.NewReader(contents["data.tar.xz"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := tar.NewReader(reader)
+	found := map[string]bool{}
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		found[header.Name] = true
+	}
+	if !found["usr/local/bin/package1"] {
+		t.Errorf("Expected usr/local/bin/package1 in data.tar.xz, found %+v", found)
+	}
+}
+
+func TestValidateCompression(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.DataCompression = "bzip2"
+	err := p.Validate(false)
+	if err == nil || !strings.Contains(err.Error(), "Data compression") {
+		t.Errorf("Expected data compression error; found %+v", err)
+	}
+
+	p.DataCompression = "none"
+	if err := p.Validate(false); err != nil {
+		t.Error(err)
+	}
+	if name := p.DataArchiveName(); name != "data.tar" {
+		t.Errorf("Expected data.tar, found %q", name)
+	}
+}
+
+func TestTarFormat(t *testing.T) {
+	// The ustar name field holds 100 characters, and the prefix field another
+	// 155, so mediumPath needs the prefix and longPath doesn't fit at all
+	mediumPath := "usr/share/" + strings.Repeat("d", 100) + "/file"
+	longPath := "usr/share/" + strings.Repeat("d/", 150) + "file"
+	utf8Path := "usr/share/café.txt"
+
+	for _, test := range []struct {
+		format string
+		marker string
+		long   bool
+		utf8   bool
+	}{
+		{"", "PaxHeaders", true, true},
+		{"pax", "PaxHeaders", true, true},
+		{"gnu", "././@LongLink", true, true},
+		{"ustar", "ustar\x0000", false, false},
+	} {
+		p := PackageSpecFixture(t)
+		p.TarFormat = test.format
+		p.DataCompression = "none"
+		p.AutoPath = "deb-pkg"
+		p.FS = fstest.MapFS{
+			"deb-pkg/" + mediumPath: {Data: []byte("medium\n"), Mode: 0644},
+		}
+		if err := p.Validate(false); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := &bytes.Buffer{}
+		if err := p.WriteDataArchive(buf); err != nil {
+			t.Fatalf("%q: %s", test.format, err)
+		}
+		if !bytes.Contains(buf.Bytes(), []byte(test.marker)) {
+			t.Errorf("%q: Expected data archive to contain %q", test.format, test.marker)
+		}
+		archive := tar.NewReader(buf)
+		names := []string{}
+		for {
+			header, err := archive.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%q: %s", test.format, err)
+			}
+			names = append(names, header.Name)
+		}
+		if !hasString(names, mediumPath) {
+			t.Errorf("%q: Expected %s in the data archive, found %+v", test.format, mediumPath, names)
+		}
+
+		p.FS.(fstest.MapFS)["deb-pkg/"+longPath] = &fstest.MapFile{Data: []byte("long\n"), Mode: 0644}
+		err := p.WriteDataArchive(&bytes.Buffer{})
+		if test.long && err != nil {
+			t.Errorf("%q: %s", test.format, err)
+		}
+		if !test.long && (err == nil || !strings.Contains(err.Error(), "can't be represented in ustar format")) {
+			t.Errorf("%q: Expected %s to be rejected, found %v", test.format, longPath, err)
+		}
+
+		// GNU tar stores names that aren't ASCII as raw bytes, and pax uses
+		// an extended header
+		p.FS = fstest.MapFS{
+			"deb-pkg/" + utf8Path: {Data: []byte("utf8\n"), Mode: 0644},
+		}
+		buf.Reset()
+		err = p.WriteDataArchive(buf)
+		if !test.utf8 {
+			if err == nil || !strings.Contains(err.Error(), "can't be represented in ustar format") {
+				t.Errorf("%q: Expected %s to be rejected, found %v", test.format, utf8Path, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %s", test.format, err)
+		}
+		archive = tar.NewReader(buf)
+		names = []string{}
+		for {
+			header, err := archive.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%q: %s", test.format, err)
+			}
+			names = append(names, header.Name)
+		}
+		if !hasString(names, utf8Path) {
+			t.Errorf("%q: Expected %s in the data archive, found %+v", test.format, utf8Path, names)
+		}
+	}
+
+	p := PackageSpecFixture(t)
+	p.TarFormat = "v7"
+	if err := p.Validate(false); err == nil || !strings.Contains(err.Error(), `Tar format "v7" is invalid`) {
+		t.Errorf("Expected invalid tar format error, found %v", err)
+	}
+}
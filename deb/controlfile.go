@@ -0,0 +1,102 @@
+package deb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// ParseControlFile creates a PackageSpec from the contents of a debian binary
+// control file, like the one generated by RenderControlFile. Fields mkdeb does
+// not support are ignored, as is Installed-Size since it is calculated during
+// the build.
+func ParseControlFile(data []byte) (*PackageSpec, error) {
+	p := DefaultPackageSpec()
+
+	fields := map[string]string{}
+	field := ""
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// Lines starting with whitespace continue the previous field
+		if line[0] == ' ' || line[0] == '\t' {
+			if field == "" {
+				return nil, fmt.Errorf("Invalid control file line %d: %q", i+1, line)
+			}
+			fields[field] += "\n" + line
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("Invalid control file line %d: %q", i+1, line)
+		}
+		field = strings.ToLower(strings.TrimSpace(parts[0]))
+		fields[field] = strings.TrimSpace(parts[1])
+	}
+
+	p.Package = fields["package"]
+	p.Version = fields["version"]
+	p.Architecture = fields["architecture"]
+	p.Maintainer = fields["maintainer"]
+	p.Description = fields["description"]
+	p.PreDepends = splitList(fields["pre-depends"])
+	p.Depends = splitList(fields["depends"])
+	p.Conflicts = splitList(fields["conflicts"])
+	p.Breaks = splitList(fields["breaks"])
+	p.Replaces = splitList(fields["replaces"])
+	p.BuiltUsing = splitList(fields["built-using"])
+	p.Homepage = fields["homepage"]
+	p.VcsBrowser = fields["vcs-browser"]
+	p.VcsGit = fields["vcs-git"]
+	p.Origin = fields["origin"]
+	p.Bugs = fields["bugs"]
+	p.Essential = fields["essential"] == "yes"
+	p.MultiArch = fields["multi-arch"]
+	p.Tags = splitList(fields["tag"])
+	p.Testsuite = fields["testsuite"]
+	if section, ok := fields["section"]; ok {
+		p.Section = section
+	}
+	if priority, ok := fields["priority"]; ok {
+		p.Priority = priority
+	}
+
+	return p, nil
+}
+
+// splitList splits a comma-separated control field like Depends into a list
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.Join(strings.Fields(item), " ")
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// NewPackageSpecFromDebianTree creates a PackageSpec from a directory laid out
+// for dpkg-deb --build, where dir/DEBIAN contains the control file and any
+// control scripts, and everything else in dir is installed as-is.
+func NewPackageSpecFromDebianTree(dir string) (*PackageSpec, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "DEBIAN", "control"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read control file: %s", err)
+	}
+
+	p, err := ParseControlFile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Everything outside of DEBIAN is part of the package; see RootTree
+	p.AutoPath = dir
+	p.RootTree = true
+
+	return p, nil
+}
@@ -5,6 +5,7 @@ package deb
 
 import (
 	"path"
+	"strings"
 	"testing"
 )
 
@@ -20,8 +21,8 @@ Version: 0.1.0
 Architecture: amd64
 Maintainer: Chris Bednarski <banzaimonkey@gmail.com>
 Installed-Size: 0
-Section: default
-Priority: extra
+Section: misc
+Priority: optional
 Homepage: https://github.com/cbednarski/mkdeb
 Description: A CLI tool for building debian packages
 `
@@ -50,8 +51,8 @@ Architecture: amd64
 Maintainer: Chris Bednarski <banzaimonkey@gmail.com>
 Installed-Size: 0
 Depends: wget, tree
-Section: default
-Priority: extra
+Section: misc
+Priority: optional
 Homepage: https://github.com/cbednarski/mkdeb
 Description: A CLI tool for building debian packages
 `
@@ -65,6 +66,53 @@ Description: A CLI tool for building debian packages
 	}
 }
 
+func TestRenderControlFileNormalizesDepends(t *testing.T) {
+	p, err := NewPackageSpecFromFile(path.Join("test-fixtures", "example-basic.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Version = "0.1.0"
+	p.Depends = []string{"curl(>=7.0.0)", " tree ", "curl (>= 7.0.0)", "wget  ( =  1.2 )", "tree"}
+
+	buf, err := p.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Depends: curl (>= 7.0.0), tree, wget (= 1.2)\n"
+	if !strings.Contains(string(buf), expected) {
+		t.Fatalf("Expected control file to contain %q\n%s", expected, buf)
+	}
+}
+
+func TestValidateDoesNotNormalizeRelationships(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.Depends = []string{"libc6(>= 2.31)", "libc6 (>= 2.31)", "libc6 (>= 2.32)"}
+	p.Conflicts = []string{"old-tool ( << 1.0 )", "old-tool (<< 1.0)"}
+
+	if err := p.Validate(true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Validate must not change the spec; normalizing happens on render
+	if found := strings.Join(p.Depends, ", "); found != "libc6(>= 2.31), libc6 (>= 2.31), libc6 (>= 2.32)" {
+		t.Errorf("Expected Validate to leave depends alone, found %q", found)
+	}
+	if found := strings.Join(p.Conflicts, ", "); found != "old-tool ( << 1.0 ), old-tool (<< 1.0)" {
+		t.Errorf("Expected Validate to leave conflicts alone, found %q", found)
+	}
+
+	buf, err := p.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"Depends: libc6 (>= 2.31), libc6 (>= 2.32)\n", "Conflicts: old-tool (<< 1.0)\n"} {
+		if !strings.Contains(string(buf), expected) {
+			t.Errorf("Expected control file to contain %q\n%s", expected, buf)
+		}
+	}
+}
+
 func TestRenderControlFileWithPreDepends(t *testing.T) {
 	p, err := NewPackageSpecFromFile(path.Join("test-fixtures", "example-predepends.json"))
 	if err != nil {
@@ -80,8 +128,8 @@ Architecture: amd64
 Maintainer: Chris Bednarski <banzaimonkey@gmail.com>
 Installed-Size: 0
 Pre-Depends: wget, tree
-Section: default
-Priority: extra
+Section: misc
+Priority: optional
 Homepage: https://github.com/cbednarski/mkdeb
 Description: A CLI tool for building debian packages
 `
@@ -112,9 +160,231 @@ Installed-Size: 0
 Depends: wget, tree
 Conflicts: debpkg
 Replaces: debpkg
-Section: default
-Priority: extra
+Section: misc
+Priority: optional
+Homepage: https://github.com/cbednarski/mkdeb
+Description: A CLI tool for building debian packages
+`
+	buf, err := p.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf) != expected {
+		t.Fatalf("Control file did not match expected\n%s\n--Found--\n%s\n", expected, string(buf))
+	}
+}
+
+func TestRenderControlFileWithBuiltUsing(t *testing.T) {
+	p, err := NewPackageSpecFromFile(path.Join("test-fixtures", "example-basic.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Version = "0.1.0"
+	p.BuiltUsing = []string{"gcc-10 (= 10.2.1-6)", "musl (= 1.2.2-1)"}
+	if err := p.Validate(true); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Package: mkdeb
+Version: 0.1.0
+Architecture: amd64
+Maintainer: Chris Bednarski <banzaimonkey@gmail.com>
+Installed-Size: 0
+Built-Using: gcc-10 (= 10.2.1-6), musl (= 1.2.2-1)
+Section: misc
+Priority: optional
+Homepage: https://github.com/cbednarski/mkdeb
+Description: A CLI tool for building debian packages
+`
+	buf, err := p.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != expected {
+		t.Fatalf("Control file did not match expected\n%s\n--Found--\n%s\n", expected, string(buf))
+	}
+
+	// Empty fields are omitted
+	p.BuiltUsing = nil
+	buf, err = p.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(buf), "Built-Using:") {
+		t.Fatalf("Expected Built-Using to be omitted\n%s", string(buf))
+	}
+
+	// Only exact versions are allowed
+	for _, source := range []string{"gcc-10", "gcc-10 (>= 10.2.1-6)", "gcc-10 (<< 11)"} {
+		p.BuiltUsing = []string{source}
+		err := p.Validate(true)
+		if err == nil || !strings.Contains(err.Error(), "Built-Using") {
+			t.Errorf("Expected %q to be invalid; found %+v", source, err)
+		}
+	}
+}
+
+func TestRenderControlFileWithEssential(t *testing.T) {
+	p, err := NewPackageSpecFromFile(path.Join("test-fixtures", "example-basic.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Version = "0.1.0"
+
+	buf, err := p.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(buf), "Essential:") {
+		t.Fatalf("Expected Essential to be omitted\n%s", string(buf))
+	}
+
+	p.Essential = true
+	expected := `Package: mkdeb
+Version: 0.1.0
+Architecture: amd64
+Maintainer: Chris Bednarski <banzaimonkey@gmail.com>
+Installed-Size: 0
+Section: misc
+Priority: optional
+Essential: yes
+Homepage: https://github.com/cbednarski/mkdeb
+Description: A CLI tool for building debian packages
+`
+	buf, err = p.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != expected {
+		t.Fatalf("Control file did not match expected\n%s\n--Found--\n%s\n", expected, string(buf))
+	}
+}
+
+func TestRenderControlFileWithTags(t *testing.T) {
+	p, err := NewPackageSpecFromFile(path.Join("test-fixtures", "example-basic.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Version = "0.1.0"
+	p.Tags = []string{"role::program", "implemented-in::go"}
+
+	expected := `Package: mkdeb
+Version: 0.1.0
+Architecture: amd64
+Maintainer: Chris Bednarski <banzaimonkey@gmail.com>
+Installed-Size: 0
+Section: misc
+Priority: optional
+Homepage: https://github.com/cbednarski/mkdeb
+Tag: role::program, implemented-in::go
+Description: A CLI tool for building debian packages
+`
+	buf, err := p.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != expected {
+		t.Fatalf("Control file did not match expected\n%s\n--Found--\n%s\n", expected, string(buf))
+	}
+
+	p.Tags = append(p.Tags, "role:program")
+	if err := p.Validate(false); err == nil || !strings.Contains(err.Error(), `Tag "role:program" is invalid`) {
+		t.Errorf("Expected invalid tag error, found %v", err)
+	}
+}
+
+func TestRenderControlFileWithTestsuite(t *testing.T) {
+	p, err := NewPackageSpecFromFile(path.Join("test-fixtures", "example-basic.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Version = "0.1.0"
+	p.Testsuite = "autopkgtest"
+	if err := p.Validate(true); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Package: mkdeb
+Version: 0.1.0
+Architecture: amd64
+Maintainer: Chris Bednarski <banzaimonkey@gmail.com>
+Installed-Size: 0
+Section: misc
+Priority: optional
+Homepage: https://github.com/cbednarski/mkdeb
+Testsuite: autopkgtest
+Description: A CLI tool for building debian packages
+`
+	buf, err := p.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != expected {
+		t.Fatalf("Control file did not match expected\n%s\n--Found--\n%s\n", expected, string(buf))
+	}
+
+	p.Testsuite = "autopkgtest, autopkgtest-pkg-python"
+	if err := p.Validate(true); err != nil {
+		t.Errorf("Expected multiple test suites to be valid: %s", err)
+	}
+	p.Testsuite = "unittest"
+	err = p.Validate(true)
+	if err == nil || !strings.Contains(err.Error(), "Testsuite") {
+		t.Errorf("Expected unknown test suite to be invalid; found %+v", err)
+	}
+}
+
+func TestRenderControlFileWithVcs(t *testing.T) {
+	p, err := NewPackageSpecFromFile(path.Join("test-fixtures", "example-basic.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Version = "0.1.0"
+	p.VcsGit = "https://github.com/cbednarski/mkdeb.git"
+	p.VcsBrowser = "https://github.com/cbednarski/mkdeb"
+
+	expected := `Package: mkdeb
+Version: 0.1.0
+Architecture: amd64
+Maintainer: Chris Bednarski <banzaimonkey@gmail.com>
+Installed-Size: 0
+Section: misc
+Priority: optional
+Homepage: https://github.com/cbednarski/mkdeb
+Vcs-Browser: https://github.com/cbednarski/mkdeb
+Vcs-Git: https://github.com/cbednarski/mkdeb.git
+Description: A CLI tool for building debian packages
+`
+	buf, err := p.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf) != expected {
+		t.Fatalf("Control file did not match expected\n%s\n--Found--\n%s\n", expected, string(buf))
+	}
+}
+
+func TestRenderControlFileWithOriginAndBugs(t *testing.T) {
+	p, err := NewPackageSpecFromFile(path.Join("test-fixtures", "example-basic.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Version = "0.1.0"
+	p.Origin = "cbednarski"
+	p.Bugs = "https://github.com/cbednarski/mkdeb/issues"
+
+	expected := `Package: mkdeb
+Version: 0.1.0
+Architecture: amd64
+Maintainer: Chris Bednarski <banzaimonkey@gmail.com>
+Installed-Size: 0
+Section: misc
+Priority: optional
 Homepage: https://github.com/cbednarski/mkdeb
+Origin: cbednarski
+Bugs: https://github.com/cbednarski/mkdeb/issues
 Description: A CLI tool for building debian packages
 `
 	buf, err := p.RenderControlFile()
@@ -125,4 +395,154 @@ Description: A CLI tool for building debian packages
 	if string(buf) != expected {
 		t.Fatalf("Control file did not match expected\n%s\n--Found--\n%s\n", expected, string(buf))
 	}
+
+	// Empty fields are omitted
+	p.Origin = ""
+	p.Bugs = ""
+	buf, err = p.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(buf), "Origin:") || strings.Contains(string(buf), "Bugs:") {
+		t.Fatalf("Expected Origin and Bugs to be omitted\n%s", string(buf))
+	}
+}
+
+func TestParseControlFile(t *testing.T) {
+	p, err := NewPackageSpecFromFile(path.Join("test-fixtures", "example-depends.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Version = "0.1.0"
+	p.VcsGit = "https://github.com/cbednarski/mkdeb.git"
+	p.Description = "A CLI tool for building debian packages\n This is the long description."
+
+	data, err := p.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseControlFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rendering the parsed control file should give us the same thing back
+	found, err := parsed.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(found) != string(data) {
+		t.Errorf("Control file did not match expected\n%s\n--Found--\n%s\n", data, found)
+	}
+}
+
+func TestParseControlFileInvalid(t *testing.T) {
+	for _, data := range []string{
+		" starts with a continuation\n",
+		"Package: mkdeb\nnot a field\n",
+	} {
+		if _, err := ParseControlFile([]byte(data)); err == nil || !strings.Contains(err.Error(), "Invalid control file") {
+			t.Errorf("Expected invalid control file error for %q; found %+v", data, err)
+		}
+	}
+}
+
+func TestNewPackageSpecFromDebianTree(t *testing.T) {
+	dir := path.Join("test-fixtures", "debian-tree")
+	p, err := NewPackageSpecFromDebianTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Package != "tool" || p.Version != "1.0.0-1" || p.Section != "utils" || p.Priority != "optional" {
+		t.Errorf("Expected fields from DEBIAN/control, found %+v", p)
+	}
+	if len(p.Depends) != 2 || p.Depends[0] != "curl (>= 7.0.0)" || p.Depends[1] != "git" {
+		t.Errorf("Expected depends from DEBIAN/control, found %+v", p.Depends)
+	}
+	if err := p.Validate(true); err != nil {
+		t.Error(err)
+	}
+
+	scripts := p.MapControlFiles()
+	if scripts["postinst"] != path.Join(dir, "DEBIAN", "postinst") || len(scripts) != 1 {
+		t.Errorf("Expected postinst from DEBIAN, found %+v", scripts)
+	}
+
+	files, err := p.ListFiles(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := path.Join(dir, "usr", "bin", "tool")
+	if len(files) != 1 || files[0] != expected {
+		t.Errorf("Expected only %s, found %+v", expected, files)
+	}
+}
+
+func TestControlFields(t *testing.T) {
+	fields := map[string]ControlField{}
+	for _, field := range ControlFields() {
+		fields[field.Name] = field
+	}
+
+	for name, required := range map[string]bool{
+		"Package":      true,
+		"Version":      true,
+		"Architecture": true,
+		"Maintainer":   true,
+		"Description":  true,
+		"Depends":      false,
+		"Pre-Depends":  false,
+		"Homepage":     false,
+	} {
+		field, ok := fields[name]
+		if !ok {
+			t.Errorf("Expected %s to be listed", name)
+			continue
+		}
+		if field.Required != required {
+			t.Errorf("Expected %s required to be %t", name, required)
+		}
+		if field.Description == "" {
+			t.Errorf("Expected %s to have a description", name)
+		}
+	}
+
+	// Every field in a rendered control file should be listed
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.Depends = []string{"curl"}
+	p.Bugs = "https://github.com/cbednarski/mkdeb/issues"
+	data, err := p.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		name := strings.SplitN(line, ":", 2)[0]
+		if _, ok := fields[name]; !ok {
+			t.Errorf("Expected %s to be listed", name)
+		}
+	}
+}
+
+func TestRenderControlFileEmptyFields(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.Section = ""
+	p.Priority = ""
+	p.Homepage = ""
+	data, err := p.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// These have always been written, even when empty
+	for _, line := range []string{"\nSection: \n", "\nPriority: \n", "\nHomepage: \n"} {
+		if !strings.Contains(string(data), line) {
+			t.Errorf("Expected %q in control file:\n%s", strings.TrimSpace(line), data)
+		}
+	}
+	if strings.Contains(string(data), "Vcs-Git:") {
+		t.Errorf("Expected empty Vcs-Git to be left out:\n%s", data)
+	}
 }
@@ -0,0 +1,123 @@
+package deb
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// DebugPackageName returns the name of the companion package that holds
+// debug symbols when SplitDebug is enabled.
+func (p *PackageSpec) DebugPackageName() string {
+	return p.Package + "-dbgsym"
+}
+
+// DebugFilename returns the filename of the -dbgsym package, which ends in
+// .ddeb instead of .deb if DebugExtension is set to ddeb
+func (p *PackageSpec) DebugFilename() string {
+	return p.debugPackageSpec("").Filename()
+}
+
+// splitDebugInfo splits the debug information out of each ELF binary in the
+// package and returns the spec for the -dbgsym package that installs it. The
+// stripped binaries are used in place of the originals for the rest of the
+// build. If there are no binaries with debug information it returns nil.
+//
+// The -dbgsym package is built after the main package, so a failed build
+// doesn't leave it behind in target.
+func (p *PackageSpec) splitDebugInfo(ws string) (*PackageSpec, error) {
+	files, err := p.ListFiles(false)
+	if err != nil {
+		return nil, err
+	}
+
+	debugRoot := filepath.Join(ws, "dbgsym")
+	strippedRoot := filepath.Join(ws, "stripped")
+	p.strippedFiles = map[string]string{}
+
+	for _, file := range files {
+		source, local := p.source(file)
+		if !local || !hasDebugInfo(source) {
+			continue
+		}
+		normFile, err := p.NormalizeFilename(file)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(source)
+		if err != nil {
+			return nil, err
+		}
+
+		debugFile := filepath.Join(debugRoot, "usr", "lib", "debug", normFile+".debug")
+		strippedFile := filepath.Join(strippedRoot, normFile)
+		for _, dir := range []string{filepath.Dir(debugFile), filepath.Dir(strippedFile)} {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := objcopy("--only-keep-debug", source, debugFile); err != nil {
+			return nil, err
+		}
+		if err := objcopy("--strip-debug", "--add-gnu-debuglink="+debugFile, source, strippedFile); err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(strippedFile, info.Mode().Perm()); err != nil {
+			return nil, err
+		}
+		p.strippedFiles[file] = strippedFile
+	}
+
+	if len(p.strippedFiles) == 0 {
+		return nil, nil
+	}
+	return p.debugPackageSpec(debugRoot), nil
+}
+
+// debugPackageSpec returns the spec for the -dbgsym package, which installs the
+// files in autoPath
+func (p *PackageSpec) debugPackageSpec(autoPath string) *PackageSpec {
+	return &PackageSpec{
+		Package:            p.DebugPackageName(),
+		Version:            p.Version,
+		Architecture:       p.Architecture,
+		Maintainer:         p.Maintainer,
+		Description:        "debug symbols for " + p.Package,
+		Depends:            []string{fmt.Sprintf("%s (= %s)", p.Package, p.Version)},
+		Section:            "debug",
+		Priority:           "optional",
+		Homepage:           p.Homepage,
+		AutoPath:           autoPath,
+		TempPath:           p.TempPath,
+		FormatVersion:      p.FormatVersion,
+		Force:              p.Force,
+		InMemory:           p.InMemory,
+		Logger:             p.Logger,
+		BuildTime:          p.BuildTime,
+		ClampMTime:         p.ClampMTime,
+		Date:               p.Date,
+		ControlCompression: p.ControlCompression,
+		DataCompression:    p.DataCompression,
+		extension:          p.DebugExtension,
+	}
+}
+
+// hasDebugInfo returns true if filename is an ELF binary with DWARF sections
+func hasDebugInfo(filename string) bool {
+	file, err := elf.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	return file.Section(".debug_info") != nil || file.Section(".zdebug_info") != nil
+}
+
+func objcopy(args ...string) error {
+	if output, err := exec.Command("objcopy", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("objcopy %v failed: %s\n%s", args, err, output)
+	}
+	return nil
+}
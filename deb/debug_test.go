@@ -0,0 +1,121 @@
+package deb
+
+import (
+	"bytes"
+	"debug/elf"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// DebugBinaryFixture compiles a binary with debug information into
+// deb-pkg/usr/bin/hello under a new temp directory, which the caller should
+// remove. The test is skipped if cc or objcopy are not installed.
+func DebugBinaryFixture(t *testing.T) string {
+	for _, tool := range []string{"cc", "objcopy"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is required for this test", tool)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := filepath.Join(dir, "hello.c")
+	if err := ioutil.WriteFile(source, []byte("int main() { return 0; }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	binDir := filepath.Join(dir, "deb-pkg", "usr", "bin")
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if output, err := exec.Command("cc", "-g", "-o", filepath.Join(binDir, "hello"), source).CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile fixture: %s\n%s", err, output)
+	}
+	return dir
+}
+
+func TestBuildSplitDebug(t *testing.T) {
+	dir := DebugBinaryFixture(t)
+	defer os.RemoveAll(dir)
+
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.AutoPath = filepath.Join(dir, "deb-pkg")
+	p.SplitDebug = true
+
+	output := filepath.Join(dir, "output")
+	if err := p.Build(output); err != nil {
+		t.Fatal(err)
+	}
+
+	// The main package should contain a stripped binary
+	_, contents := readDeb(t, filepath.Join(output, p.Filename()))
+	_, data := readTarGzData(t, bytes.NewReader(contents["data.tar.gz"]))
+	binary, err := elf.NewFile(bytes.NewReader(data["usr/bin/hello"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binary.Section(".debug_info") != nil {
+		t.Errorf("Expected usr/bin/hello to be stripped of debug information")
+	}
+
+	// The dbgsym package should contain the debug information
+	_, contents = readDeb(t, filepath.Join(output, p.DebugFilename()))
+	_, data = readTarGzData(t, bytes.NewReader(contents["data.tar.gz"]))
+	debugFile := "usr/lib/debug/usr/bin/hello.debug"
+	if _, ok := data[debugFile]; !ok {
+		t.Fatalf("Expected %s in dbgsym package", debugFile)
+	}
+	_, control := readTarGzData(t, bytes.NewReader(contents["control.tar.gz"]))
+	if !bytes.Contains(control["control"], []byte("Depends: mkdeb (= 0.1.0)")) {
+		t.Errorf("Expected dbgsym to depend on mkdeb\n%s", control["control"])
+	}
+}
+
+func TestBuildSplitDebugFailure(t *testing.T) {
+	dir := DebugBinaryFixture(t)
+	defer os.RemoveAll(dir)
+
+	// The main package can't be built without its postinst
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.AutoPath = filepath.Join(dir, "deb-pkg")
+	p.SplitDebug = true
+	p.Postinst = filepath.Join(dir, "missing-postinst")
+
+	output := filepath.Join(dir, "output")
+	if err := p.Build(output); err == nil {
+		t.Fatal("Expected the build to fail")
+	}
+	if _, err := os.Stat(filepath.Join(output, p.DebugFilename())); !os.IsNotExist(err) {
+		t.Errorf("Expected no dbgsym package after a failed build, found %v", err)
+	}
+}
+
+func TestDebugFilename(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+
+	if filename := p.DebugFilename(); filename != "mkdeb-dbgsym-0.1.0-amd64.deb" {
+		t.Errorf("Expected .deb by default, found %q", filename)
+	}
+
+	p.DebugExtension = "ddeb"
+	if filename := p.DebugFilename(); filename != "mkdeb-dbgsym-0.1.0-amd64.ddeb" {
+		t.Errorf("Expected .ddeb, found %q", filename)
+	}
+	if filename := p.Filename(); filename != "mkdeb-0.1.0-amd64.deb" {
+		t.Errorf("Expected main package to keep .deb, found %q", filename)
+	}
+
+	p.DebugExtension = "udeb"
+	if err := p.Validate(false); err == nil || !strings.Contains(err.Error(), "Debug extension") {
+		t.Errorf("Expected invalid debug extension error, found %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package deb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+// doctorTools are external programs that some mkdeb features or common
+// packaging workflows rely on. None of them are needed for a basic build, but
+// if required returns true the config can't be built without the tool.
+var doctorTools = []struct {
+	name     string
+	purpose  string
+	required func(p *PackageSpec) bool
+}{
+	{"objcopy", "splitting debug symbols from binaries", func(p *PackageSpec) bool { return p.SplitDebug }},
+	{"xz", "inspecting xz compressed archives", nil},
+	{"gpg", "signing packages and repositories", nil},
+	{"git", "reading versions and timestamps from git", nil},
+	{"lintian", "checking packages against debian policy", nil},
+}
+
+// lookPath finds external programs. Tests replace this to simulate tools that
+// are or are not installed.
+var lookPath = exec.LookPath
+
+// Check is the result of one of the environment checks run by Doctor.
+type Check struct {
+	Name     string
+	OK       bool
+	Required bool // If a required check fails, builds will fail
+	Detail   string
+}
+
+// Doctor checks whether the optional external tools used with mkdeb are
+// installed, and whether dir (usually the directory containing the config) is
+// writable. If p is not nil, tools that p needs to build are required.
+func Doctor(dir string, p *PackageSpec) []Check {
+	checks := []Check{}
+	for _, tool := range doctorTools {
+		check := Check{Name: tool.name}
+		check.Required = p != nil && tool.required != nil && tool.required(p)
+		if found, err := lookPath(tool.name); err != nil {
+			check.Detail = fmt.Sprintf("not found; used for %s", tool.purpose)
+		} else {
+			check.OK = true
+			check.Detail = found
+		}
+		checks = append(checks, check)
+	}
+
+	check := Check{Name: "config dir", Required: true}
+	if err := checkWritable(dir); err != nil {
+		check.Detail = err.Error()
+	} else {
+		check.OK = true
+		check.Detail = dir + " is writable"
+	}
+	return append(checks, check)
+}
+
+// checkWritable verifies we can create a file in dir
+func checkWritable(dir string) error {
+	file, err := ioutil.TempFile(dir, ".mkdeb-doctor")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %s", dir, err)
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
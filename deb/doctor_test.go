@@ -0,0 +1,72 @@
+package deb
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	defer func(original func(string) (string, error)) { lookPath = original }(lookPath)
+	lookPath = func(name string) (string, error) {
+		if name == "gpg" || name == "lintian" {
+			return "", errors.New("executable file not found in $PATH")
+		}
+		return "/usr/bin/" + name, nil
+	}
+
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	checks := Doctor(dir, nil)
+	results := map[string]Check{}
+	for _, check := range checks {
+		results[check.Name] = check
+	}
+	for name, ok := range map[string]bool{"objcopy": true, "xz": true, "git": true, "gpg": false, "lintian": false, "config dir": true} {
+		check, found := results[name]
+		if !found {
+			t.Errorf("Expected a check for %s", name)
+			continue
+		}
+		if check.OK != ok {
+			t.Errorf("Expected %s OK to be %t, found %+v", name, ok, check)
+		}
+	}
+	if results["objcopy"].Detail != "/usr/bin/objcopy" {
+		t.Errorf("Expected the path to objcopy, found %q", results["objcopy"].Detail)
+	}
+	if results["gpg"].Required || !results["config dir"].Required {
+		t.Errorf("Expected only the config dir check to be required, found %+v", checks)
+	}
+
+	checks = Doctor(filepath.Join(dir, "missing"), nil)
+	if last := checks[len(checks)-1]; last.OK {
+		t.Errorf("Expected missing config dir to fail, found %+v", last)
+	}
+}
+
+func TestDoctorSplitDebug(t *testing.T) {
+	defer func(original func(string) (string, error)) { lookPath = original }(lookPath)
+	lookPath = func(name string) (string, error) {
+		return "", errors.New("executable file not found in $PATH")
+	}
+
+	p := PackageSpecFixture(t)
+	for _, splitDebug := range []bool{false, true} {
+		p.SplitDebug = splitDebug
+		for _, check := range Doctor(".", p) {
+			if check.Name == "objcopy" && check.Required != splitDebug {
+				t.Errorf("Expected objcopy required to be %t with splitDebug %t", splitDebug, splitDebug)
+			}
+			if check.Name == "gpg" && check.Required {
+				t.Errorf("Expected gpg not to be required, found %+v", check)
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package deb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ControlField describes a field that mkdeb writes to the debian control file.
+type ControlField struct {
+	Name        string // Name in the control file, e.g. Pre-Depends
+	Config      string // Name in the mkdeb config file, e.g. preDepends
+	Required    bool
+	Description string
+
+	// value returns the rendered value of the field. Fields with an empty
+	// value are left out of the control file, except for required fields and
+	// those in alwaysWritten.
+	value func(p *PackageSpec) string
+}
+
+// alwaysWritten lists optional fields that are written to the control file
+// even when they are empty, as mkdeb has always done.
+var alwaysWritten = map[string]bool{"Section": true, "Priority": true, "Homepage": true}
+
+// controlFields lists the control fields mkdeb supports in the order they are
+// written to the control file. This is used by RenderControlFile so adding a
+// field here is all you need to do to support it.
+var controlFields = []ControlField{
+	{"Package", "package", true, "The name of your package",
+		func(p *PackageSpec) string { return p.Package }},
+	{"Version", "version", true, "Package version, set with -version when building",
+		func(p *PackageSpec) string { return p.Version }},
+	{"Architecture", "architecture", true, "CPU architecture for your binaries, or all",
+		func(p *PackageSpec) string { return p.Architecture }},
+	{"Multi-Arch", "multiArch", false, "One of " + strings.Join(multiArchValues, ", "),
+		func(p *PackageSpec) string { return p.MultiArch }},
+	{"Maintainer", "maintainer", true, "Your Name <you@example.com>",
+		func(p *PackageSpec) string { return p.Maintainer }},
+	{"Installed-Size", "", false, "Size of the installed files in KiB, calculated automatically",
+		func(p *PackageSpec) string { return fmt.Sprintf("%d", p.InstalledSize) }},
+	{"Pre-Depends", "preDepends", false, "Packages that must be installed and configured before this one",
+		func(p *PackageSpec) string { return join(normalizeRelations(p.PreDepends)) }},
+	{"Depends", "depends", false, "Packages this package depends on",
+		func(p *PackageSpec) string { return join(normalizeRelations(p.Depends)) }},
+	{"Conflicts", "conflicts", false, "Packages that can't be installed alongside this one",
+		func(p *PackageSpec) string { return join(normalizeRelations(p.Conflicts)) }},
+	{"Breaks", "breaks", false, "Packages this package breaks",
+		func(p *PackageSpec) string { return join(normalizeRelations(p.Breaks)) }},
+	{"Replaces", "replaces", false, "Packages whose files this package replaces",
+		func(p *PackageSpec) string { return join(normalizeRelations(p.Replaces)) }},
+	{"Built-Using", "builtUsing", false, "Source packages incorporated into this one, like 'gcc-10 (= 10.2.1-6)'",
+		func(p *PackageSpec) string { return join(normalizeRelations(p.BuiltUsing)) }},
+	{"Section", "section", false, "Category for your package, such as utils or net",
+		func(p *PackageSpec) string { return p.Section }},
+	{"Priority", "priority", false, "One of " + strings.Join(priorities, ", "),
+		func(p *PackageSpec) string { return p.Priority }},
+	{"Essential", "essential", false, "Set to true if the system can't work without this package",
+		func(p *PackageSpec) string {
+			if p.Essential {
+				return "yes"
+			}
+			return ""
+		}},
+	{"Homepage", "homepage", false, "URL for your project",
+		func(p *PackageSpec) string { return p.Homepage }},
+	{"Vcs-Browser", "vcsBrowser", false, "URL to browse your project's source code",
+		func(p *PackageSpec) string { return p.VcsBrowser }},
+	{"Vcs-Git", "vcsGit", false, "URL to your project's git repository",
+		func(p *PackageSpec) string { return p.VcsGit }},
+	{"Origin", "origin", false, "Name of the organization that produced the package",
+		func(p *PackageSpec) string { return p.Origin }},
+	{"Bugs", "bugs", false, "URL where bugs should be reported",
+		func(p *PackageSpec) string { return p.Bugs }},
+	{"Tag", "tags", false, "Debtags that classify the package, like role::program",
+		func(p *PackageSpec) string { return join(p.Tags) }},
+	{"Testsuite", "testsuite", false, "Test suites for the package, such as autopkgtest",
+		func(p *PackageSpec) string { return p.Testsuite }},
+	{"Description", "description", true, "Brief explanation of your package",
+		func(p *PackageSpec) string { return p.description() }},
+}
+
+// ControlFields returns the control fields mkdeb supports, in the order they
+// appear in the control file.
+func ControlFields() []ControlField {
+	return append([]ControlField{}, controlFields...)
+}
+
+// RenderControlFile creates a debian control file for this package.
+func (p *PackageSpec) RenderControlFile() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	for _, field := range controlFields {
+		// Description is last since its extended description spans lines
+		if field.Name == "Description" {
+			for _, name := range p.extraFieldNames() {
+				fmt.Fprintf(buf, "%s: %s\n", name, p.ExtraFields[name])
+			}
+		}
+		value := field.value(p)
+		if value == "" && !field.Required && !alwaysWritten[field.Name] {
+			continue
+		}
+		fmt.Fprintf(buf, "%s: %s\n", field.Name, value)
+	}
+	return buf.Bytes(), nil
+}
+
+// extraFieldNames returns the names of ExtraFields in sorted order
+func (p *PackageSpec) extraFieldNames() []string {
+	names := []string{}
+	for name := range p.ExtraFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateExtraField checks that name is a valid control field name that
+// mkdeb does not already write, and that value fits on one line
+func validateExtraField(name, value string) error {
+	if !reFieldName.MatchString(name) {
+		return fmt.Errorf("Extra field name %q is invalid; expected letters, numbers, and dashes like X-Commit", name)
+	}
+	for _, field := range controlFields {
+		if !strings.EqualFold(field.Name, name) {
+			continue
+		}
+		if field.Config == "" {
+			return fmt.Errorf("Extra field %q is calculated by mkdeb and can't be set", name)
+		}
+		return fmt.Errorf("Extra field %q is already set by mkdeb; use the %s option instead", name, field.Config)
+	}
+	if strings.TrimSpace(value) == "" || strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("Extra field %q must have a value on a single line", name)
+	}
+	return nil
+}
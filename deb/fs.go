@@ -0,0 +1,171 @@
+package deb
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// The methods in this file read source files for the package. If
+// PackageSpec.FS is set files are read from it, otherwise they are read from
+// the local filesystem. Files downloaded by FetchRemoteFiles, binaries
+// stripped by SplitDebug, and files compressed because of CompressOver are
+// always read from the local filesystem.
+
+// source returns the path to read for name, and whether it should be read
+// from the local filesystem rather than PackageSpec.FS
+func (p *PackageSpec) source(name string) (string, bool) {
+	if compressed, ok := p.compressedFiles[name]; ok {
+		return compressed, true
+	}
+	return p.originalSource(name)
+}
+
+// originalSource is like source, but ignores the gzipped copies made because of
+// CompressOver
+func (p *PackageSpec) originalSource(name string) (string, bool) {
+	if stripped, ok := p.strippedFiles[name]; ok {
+		return stripped, true
+	}
+	if _, fetched := p.fetchedFiles[name]; fetched || p.FS == nil {
+		return name, true
+	}
+	return fsPath(name), false
+}
+
+// fsPath converts a filename into the unrooted, slash-separated form expected
+// by fs.FS
+func fsPath(name string) string {
+	name = path.Clean(filepath.ToSlash(name))
+	for len(name) > 0 && name[0] == '/' {
+		name = name[1:]
+	}
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (p *PackageSpec) open(name string) (io.ReadCloser, error) {
+	source, local := p.source(name)
+	if !local {
+		return p.FS.Open(source)
+	}
+	return os.Open(source)
+}
+
+func (p *PackageSpec) readFile(name string) ([]byte, error) {
+	source, local := p.source(name)
+	if !local {
+		return fs.ReadFile(p.FS, source)
+	}
+	return os.ReadFile(source)
+}
+
+func (p *PackageSpec) stat(name string) (os.FileInfo, error) {
+	source, local := p.source(name)
+	if !local {
+		return fs.Stat(p.FS, source)
+	}
+	return os.Stat(source)
+}
+
+// lstat is like stat but does not follow symlinks on the local filesystem.
+// fs.FS has no concept of symlinks so this is the same as stat for PackageSpec.FS
+func (p *PackageSpec) lstat(name string) (os.FileInfo, error) {
+	source, local := p.source(name)
+	if !local {
+		return fs.Stat(p.FS, source)
+	}
+	return os.Lstat(source)
+}
+
+// statOriginal is like stat, but ignores the gzipped copies made because of
+// CompressOver, so the size is the size of the file before it was compressed
+func (p *PackageSpec) statOriginal(name string) (os.FileInfo, error) {
+	source, local := p.originalSource(name)
+	if !local {
+		return fs.Stat(p.FS, source)
+	}
+	return os.Stat(source)
+}
+
+func (p *PackageSpec) exists(name string) bool {
+	_, err := p.stat(name)
+	return err == nil
+}
+
+// walk is like filepath.Walk, but uses fs.WalkDir when PackageSpec.FS is set
+func (p *PackageSpec) walk(root string, fn filepath.WalkFunc) error {
+	source, local := p.source(root)
+	if local && p.FollowDirSymlinks {
+		return walkFollowingSymlinks(source, fn)
+	}
+	if local {
+		return filepath.Walk(source, fn)
+	}
+	return fs.WalkDir(p.FS, source, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fn(name, nil, err)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fn(name, nil, err)
+		}
+		return fn(name, info, nil)
+	})
+}
+
+// walkFollowingSymlinks is like filepath.Walk, but descends into symlinked
+// directories. A directory that is already being walked is skipped when we
+// encounter it again so symlink cycles don't recurse forever.
+func walkFollowingSymlinks(root string, fn filepath.WalkFunc) error {
+	ancestors := map[string]bool{}
+
+	var walk func(name string) error
+	walk = func(name string) error {
+		info, err := os.Stat(name)
+		if err != nil {
+			// Report broken symlinks the same way filepath.Walk would
+			if info, err := os.Lstat(name); err == nil {
+				return fn(name, info, nil)
+			}
+			return fn(name, nil, err)
+		}
+		if !info.IsDir() {
+			return fn(name, info, nil)
+		}
+
+		real, err := filepath.EvalSymlinks(name)
+		if err != nil {
+			return fn(name, info, err)
+		}
+		if ancestors[real] {
+			return nil
+		}
+
+		if err := fn(name, info, nil); err != nil {
+			if err == filepath.SkipDir {
+				return nil
+			}
+			return err
+		}
+
+		entries, err := os.ReadDir(name)
+		if err != nil {
+			return fn(name, info, err)
+		}
+		ancestors[real] = true
+		defer delete(ancestors, real)
+		for _, entry := range entries {
+			if err := walk(filepath.Join(name, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return walk(root)
+}
@@ -0,0 +1,202 @@
+package deb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func MapFSFixture() fstest.MapFS {
+	return fstest.MapFS{
+		"deb-pkg/usr/bin/hello":      {Data: []byte("#!/bin/sh\necho hello\n"), Mode: 0755},
+		"deb-pkg/etc/hello/settings": {Data: []byte("greeting = hello\n"), Mode: 0644},
+		"deb-pkg/postinst":           {Data: []byte("#!/bin/sh\necho installed\n"), Mode: 0755},
+	}
+}
+
+func TestBuildFromFS(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.FS = MapFSFixture()
+	p.AutoPath = "deb-pkg"
+
+	sums, err := p.CalculateChecksums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"  etc/hello/settings\n", "  usr/bin/hello\n"} {
+		if !strings.Contains(string(sums), expected) {
+			t.Errorf("Expected md5sums to contain %q\n%s", expected, sums)
+		}
+	}
+
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+	if err := p.Build("output"); err != nil {
+		t.Fatal(err)
+	}
+
+	dataFile := path.Join("output", "test-fs-data.tar.gz")
+	defer os.Remove(dataFile)
+	if err := p.CreateDataArchive(dataFile); err != nil {
+		t.Fatal(err)
+	}
+	headers, contents := readTarGz(t, dataFile)
+	expected := "#!/bin/sh\necho hello\n"
+	if found := string(contents["usr/bin/hello"]); found != expected {
+		t.Errorf("Expected usr/bin/hello to contain %q, found %q", expected, found)
+	}
+	if header := headers["usr/bin/hello"]; header == nil || header.Mode&0777 != 0755 {
+		t.Errorf("Expected usr/bin/hello to have mode 0755, found %+v", header)
+	}
+	if _, ok := headers["postinst"]; ok {
+		t.Errorf("Control script postinst should not be in the data archive")
+	}
+
+	controlFile := path.Join("output", "test-fs-control.tar.gz")
+	defer os.Remove(controlFile)
+	if err := p.CreateControlArchive(controlFile); err != nil {
+		t.Fatal(err)
+	}
+	_, contents = readTarGz(t, controlFile)
+	if found := string(contents["conffiles"]); found != "/etc/hello/settings\n" {
+		t.Errorf("Expected conffiles to list /etc/hello/settings, found %q", found)
+	}
+	expected = "#!/bin/sh\necho installed\n"
+	if found := string(contents["postinst"]); found != expected {
+		t.Errorf("Expected postinst %q, found %q", expected, found)
+	}
+}
+
+func TestBuildInMemory(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.FS = MapFSFixture()
+	p.AutoPath = "deb-pkg"
+	p.InMemory = true
+
+	// Keep the workspace so we can check that nothing was written to it
+	tempPath, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempPath)
+	p.TempPath = tempPath
+	p.KeepIntermediate = true
+
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+	if err := p.Build("output"); err != nil {
+		t.Fatal(err)
+	}
+
+	if matches, _ := filepath.Glob(filepath.Join(tempPath, "*", "*")); len(matches) != 0 {
+		t.Errorf("Expected no intermediate files, found %+v", matches)
+	}
+
+	headers, contents := readDeb(t, filename)
+	if len(headers) != 3 {
+		t.Fatalf("Expected 3 ar members, found %d", len(headers))
+	}
+	_, data := readTarGzData(t, bytes.NewReader(contents["data.tar.gz"]))
+	expected := "#!/bin/sh\necho hello\n"
+	if found := string(data["usr/bin/hello"]); found != expected {
+		t.Errorf("Expected usr/bin/hello to contain %q, found %q", expected, found)
+	}
+	_, control := readTarGzData(t, bytes.NewReader(contents["control.tar.gz"]))
+	if _, ok := control["postinst"]; !ok {
+		t.Errorf("Expected postinst in the control archive")
+	}
+}
+
+func TestListFilesFollowDirSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// deb-pkg/usr/share/tool is a symlink to shared, which contains a symlink
+	// back to deb-pkg/usr to make a cycle
+	autoPath := filepath.Join(dir, "deb-pkg")
+	shared := filepath.Join(dir, "shared")
+	for _, d := range []string{filepath.Join(autoPath, "usr", "share"), shared} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(shared, "data"), []byte("data\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(shared, filepath.Join(autoPath, "usr", "share", "tool")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(autoPath, "usr"), filepath.Join(shared, "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	p := PackageSpecFixture(t)
+	p.AutoPath = autoPath
+
+	// By default symlinked directories are not followed
+	files, err := p.ListFiles(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := filepath.Join(autoPath, "usr", "share", "tool", "data")
+	if hasString(files, data) {
+		t.Errorf("Expected %q to be skipped, found %+v", data, files)
+	}
+
+	p.FollowDirSymlinks = true
+	files, err = p.ListFiles(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != data {
+		t.Errorf("Expected only %q, found %+v", data, files)
+	}
+}
+
+func TestListFilesFromFS(t *testing.T) {
+	fsys := MapFSFixture()
+	fsys["deb-pkg/usr/share/hello/.git/HEAD"] = &fstest.MapFile{Data: []byte("ref: refs/heads/main\n")}
+	fsys["deb-pkg/usr/share/hello/README"] = &fstest.MapFile{Data: []byte("hello\n")}
+
+	p := PackageSpecFixture(t)
+	p.FS = fsys
+	p.AutoPath = "deb-pkg"
+
+	files, err := p.ListFiles(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := []string{}
+	for _, file := range files {
+		target, err := p.NormalizeFilename(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		targets = append(targets, target)
+	}
+	expected := []string{"etc/hello/settings", "usr/bin/hello", "usr/share/hello/README"}
+	if strings.Join(targets, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected files %+v, found %+v from %+v", expected, targets, files)
+	}
+
+	dirs, err := p.ListFiles(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasString(dirs, "deb-pkg/usr/share/hello") {
+		t.Errorf("Expected directories to be listed, found %+v", dirs)
+	}
+	if hasString(dirs, "deb-pkg/usr/share/hello/.git") {
+		t.Errorf("Expected .git to be excluded, found %+v", dirs)
+	}
+}
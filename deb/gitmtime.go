@@ -0,0 +1,108 @@
+package deb
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gitLogBatchSize limits how many paths are passed to a single git log so we
+// stay under the command line length limit
+const gitLogBatchSize = 500
+
+// gitModTimes returns the time of the last commit that changed each file when
+// GitMTime is set. Files that are not tracked by git, or when git is not
+// installed, are left out so the caller can fall back to the build time. Files
+// are looked up in batches, one git log per repository, rather than running
+// git once for every file.
+func (p *PackageSpec) gitModTimes(files []string) map[string]time.Time {
+	mtimes := map[string]time.Time{}
+	if !p.GitMTime || p.FS != nil {
+		return mtimes
+	}
+
+	// Group files by the repository they are in, relative to its top level
+	toplevels := map[string]string{}
+	repos := map[string]map[string]string{}
+	for _, file := range files {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			continue
+		}
+		dir := filepath.Dir(abs)
+		toplevel, ok := toplevels[dir]
+		if !ok {
+			output, err := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel").Output()
+			if err == nil {
+				toplevel = strings.TrimSpace(string(output))
+			}
+			toplevels[dir] = toplevel
+		}
+		if toplevel == "" {
+			continue
+		}
+		rel, err := filepath.Rel(toplevel, abs)
+		if err != nil {
+			continue
+		}
+		if repos[toplevel] == nil {
+			repos[toplevel] = map[string]string{}
+		}
+		repos[toplevel][filepath.ToSlash(rel)] = file
+	}
+
+	for toplevel, paths := range repos {
+		batch := []string{}
+		for rel := range paths {
+			batch = append(batch, rel)
+			if len(batch) == gitLogBatchSize {
+				gitLogTimes(toplevel, batch, paths, mtimes)
+				batch = []string{}
+			}
+		}
+		if len(batch) > 0 {
+			gitLogTimes(toplevel, batch, paths, mtimes)
+		}
+	}
+	return mtimes
+}
+
+// gitLogTimes runs git log in toplevel for the paths in batch and records the
+// time of the most recent commit that touched each one in mtimes, keyed by
+// the original filename from files.
+func gitLogTimes(toplevel string, batch []string, files map[string]string, mtimes map[string]time.Time) {
+	args := []string{"-C", toplevel, "-c", "core.quotePath=false", "log",
+		"--format=format:commit %ct", "--name-only", "--no-renames", "--"}
+	output, err := exec.Command("git", append(args, batch...)...).Output()
+	if err != nil {
+		return
+	}
+
+	// Commits are listed newest first, so the first time we see a path is
+	// its last commit
+	var commitTime time.Time
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "commit ") {
+			if seconds, err := strconv.ParseInt(strings.TrimPrefix(line, "commit "), 10, 64); err == nil {
+				commitTime = time.Unix(seconds, 0)
+			}
+			continue
+		}
+		file, ok := files[line]
+		if !ok {
+			continue
+		}
+		if _, seen := mtimes[file]; !seen && !commitTime.IsZero() {
+			mtimes[file] = commitTime
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package deb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGitMTime(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	git := func(date string, args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=mkdeb", "GIT_AUTHOR_EMAIL=mkdeb@example.com",
+			"GIT_COMMITTER_NAME=mkdeb", "GIT_COMMITTER_EMAIL=mkdeb@example.com",
+			"GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s\n%s", args, err, output)
+		}
+	}
+	write := func(name, contents string) {
+		name = filepath.Join(dir, "deb-pkg", name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// old is committed once, new is changed in a later commit, and untracked
+	// is never committed
+	git("", "init", "-q")
+	write("usr/share/tool/old", "old\n")
+	write("usr/share/tool/new", "new\n")
+	git("2020-01-01T00:00:00Z", "add", ".")
+	git("2020-01-01T00:00:00Z", "commit", "-q", "-m", "Add files")
+	write("usr/share/tool/new", "newer\n")
+	git("2021-06-01T12:00:00Z", "commit", "-q", "-a", "-m", "Update new")
+	write("usr/share/tool/untracked", "untracked\n")
+
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.AutoPath = filepath.Join(dir, "deb-pkg")
+	p.GitMTime = true
+	p.BuildTime = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	buf := &bytes.Buffer{}
+	if err := p.WriteDataArchive(buf); err != nil {
+		t.Fatal(err)
+	}
+	headers, _ := readTarGzData(t, buf)
+	for name, expected := range map[string]time.Time{
+		"usr/share/tool/old":       time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		"usr/share/tool/new":       time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC),
+		"usr/share/tool/untracked": p.BuildTime,
+		"usr/share/tool":           p.BuildTime,
+	} {
+		header, ok := headers[name]
+		if !ok {
+			t.Errorf("Expected %s in the data archive", name)
+			continue
+		}
+		if !header.ModTime.Equal(expected) {
+			t.Errorf("Expected %s to have mtime %s, found %s", name, expected, header.ModTime)
+		}
+	}
+}
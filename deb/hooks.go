@@ -0,0 +1,35 @@
+package deb
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// RunPreBuild runs the PreBuild commands in the current directory, writing
+// their output to out. It stops at the first command that fails.
+func (p *PackageSpec) RunPreBuild(out io.Writer) error {
+	return runHooks("Pre-build", p.PreBuild, out)
+}
+
+// RunPostBuild runs the PostBuild commands in the current directory, writing
+// their output to out. It stops at the first command that fails.
+func (p *PackageSpec) RunPostBuild(out io.Writer) error {
+	return runHooks("Post-build", p.PostBuild, out)
+}
+
+// runHooks runs each command with sh -c. The output of a failed command is
+// included in the error so it is shown even when out is discarded.
+func runHooks(kind string, commands []string, out io.Writer) error {
+	for _, command := range commands {
+		output, err := exec.Command("sh", "-c", command).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s hook %q failed: %s\n%s", kind, command, err, strings.TrimRight(string(output), "\n"))
+		}
+		if _, err := out.Write(output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
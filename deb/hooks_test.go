@@ -0,0 +1,36 @@
+package deb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunHooks(t *testing.T) {
+	p := &PackageSpec{
+		PreBuild:  []string{"echo before"},
+		PostBuild: []string{"echo after", "echo broken && exit 3", "echo skipped"},
+	}
+
+	out := &bytes.Buffer{}
+	if err := p.RunPreBuild(out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "before\n" {
+		t.Errorf("Expected pre-build output %q, found %q", "before\n", out.String())
+	}
+
+	out.Reset()
+	err := p.RunPostBuild(out)
+	if err == nil {
+		t.Fatal("Expected failing hook to return an error")
+	}
+	for _, expected := range []string{`Post-build hook "echo broken && exit 3" failed`, "exit status 3", "broken"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to contain %q, found %q", expected, err)
+		}
+	}
+	if out.String() != "after\n" {
+		t.Errorf("Expected hooks to stop at the failure, found output %q", out.String())
+	}
+}
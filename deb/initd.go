@@ -0,0 +1,74 @@
+package deb
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// initScriptDir is where packages install SysV init scripts
+const initScriptDir = "/etc/init.d"
+
+var reInitScriptName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// initScriptNames returns the names of the scripts in InitScripts, which are
+// also the names they are registered as with update-rc.d
+func (p *PackageSpec) initScriptNames() []string {
+	names := []string{}
+	for _, script := range p.InitScripts {
+		names = append(names, filepath.Base(script))
+	}
+	return names
+}
+
+// isInitScript returns true if target is the archive path of one of the
+// InitScripts
+func (p *PackageSpec) isInitScript(target string) bool {
+	for _, name := range p.initScriptNames() {
+		if p.targetPath(path.Join(initScriptDir, name)) == target {
+			return true
+		}
+	}
+	return false
+}
+
+func validateInitScript(script string) error {
+	if name := filepath.Base(script); !reInitScriptName.MatchString(name) {
+		return fmt.Errorf("Init script name %q is invalid; expected letters, digits, or ._-", name)
+	}
+	return nil
+}
+
+// initScriptSnippet registers the InitScripts with update-rc.d and starts them
+// in postinst, stops them in prerm, and unregisters them in postrm when the
+// package is purged.
+func (p *PackageSpec) initScriptSnippet(name string) string {
+	if len(p.InitScripts) == 0 {
+		return ""
+	}
+	lines := []string{}
+	switch name {
+	case "postinst":
+		lines = append(lines, `if [ "$1" = "configure" ] || [ "$1" = "abort-upgrade" ]; then`)
+		for _, script := range p.initScriptNames() {
+			lines = append(lines,
+				fmt.Sprintf("\tupdate-rc.d %s defaults >/dev/null", script),
+				fmt.Sprintf("\tinvoke-rc.d %s start || true", script))
+		}
+	case "prerm":
+		lines = append(lines, `if [ "$1" = "remove" ]; then`)
+		for _, script := range p.initScriptNames() {
+			lines = append(lines, fmt.Sprintf("\tinvoke-rc.d %s stop || true", script))
+		}
+	case "postrm":
+		lines = append(lines, `if [ "$1" = "purge" ]; then`)
+		for _, script := range p.initScriptNames() {
+			lines = append(lines, fmt.Sprintf("\tupdate-rc.d %s remove >/dev/null", script))
+		}
+	default:
+		return ""
+	}
+	return strings.Join(append(lines, "fi"), "\n") + "\n"
+}
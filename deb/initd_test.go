@@ -0,0 +1,56 @@
+package deb
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestBuildInitScripts(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.Force = true
+	p.InitScripts = []string{path.Join("test-fixtures", "initd", "package1d")}
+	if err := p.Validate(true); err != nil {
+		t.Fatal(err)
+	}
+
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+	if err := p.Build("output"); err != nil {
+		t.Fatal(err)
+	}
+	_, contents := readDeb(t, filename)
+
+	// The fixture is not executable, but init scripts must be
+	headers, data := readTarGzData(t, bytes.NewReader(contents["data.tar.gz"]))
+	header := headers["etc/init.d/package1d"]
+	if header == nil || !bytes.HasPrefix(data["etc/init.d/package1d"], []byte("#!/bin/sh")) {
+		t.Fatalf("Expected the init script to be installed in /etc/init.d")
+	}
+	if header.Mode&0777 != 0755 {
+		t.Errorf("Expected the init script to have mode 0755, found %o", header.Mode)
+	}
+
+	_, control := readTarGzData(t, bytes.NewReader(contents["control.tar.gz"]))
+	for name, snippet := range map[string]string{
+		"postinst": "update-rc.d package1d defaults >/dev/null",
+		"prerm":    "invoke-rc.d package1d stop || true",
+		"postrm":   "if [ \"$1\" = \"purge\" ]; then\n\tupdate-rc.d package1d remove >/dev/null\nfi\n",
+	} {
+		if !strings.Contains(string(control[name]), snippet) {
+			t.Errorf("Expected %s to contain %q\n%s", name, snippet, control[name])
+		}
+	}
+	if !strings.Contains(string(control["conffiles"]), "/etc/init.d/package1d\n") {
+		t.Errorf("Expected the init script to be a conffile\n%s", control["conffiles"])
+	}
+
+	p.InitScripts = []string{"init/.hidden"}
+	err := p.Validate(true)
+	if err == nil || !strings.Contains(err.Error(), "Init script") {
+		t.Errorf("Expected .hidden to be invalid; found %+v", err)
+	}
+}
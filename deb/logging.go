@@ -0,0 +1,24 @@
+package deb
+
+import (
+	"context"
+	"log/slog"
+)
+
+// discardHandler drops every log record. It is used when PackageSpec.Logger
+// is not set so mkdeb doesn't log anything unless asked to.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// logger returns the Logger for this package, annotated with the package
+// name and architecture, or a logger that discards everything.
+func (p *PackageSpec) logger() *slog.Logger {
+	if p.Logger == nil {
+		return slog.New(discardHandler{})
+	}
+	return p.Logger.With("package", p.Package, "architecture", p.Architecture)
+}
@@ -0,0 +1,80 @@
+package deb
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path"
+	"testing"
+)
+
+// recordHandler keeps every record it receives so tests can inspect them
+type recordHandler struct {
+	attrs   []slog.Attr
+	records *[]slog.Record
+}
+
+func (h recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h recordHandler) Handle(_ context.Context, r slog.Record) error {
+	r = r.Clone()
+	r.AddAttrs(h.attrs...)
+	*h.records = append(*h.records, r)
+	return nil
+}
+
+func (h recordHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return recordHandler{attrs: append(append([]slog.Attr{}, h.attrs...), attrs...), records: h.records}
+}
+
+func (h recordHandler) WithGroup(string) slog.Handler { return h }
+
+func recordAttrs(r slog.Record) map[string]slog.Value {
+	attrs := map[string]slog.Value{}
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value
+		return true
+	})
+	return attrs
+}
+
+func TestBuildLogging(t *testing.T) {
+	records := []slog.Record{}
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.Force = true
+	p.Logger = slog.New(recordHandler{records: &records})
+
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+	if err := p.Build("output"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"validated package", "listed files", "created archives", "assembled package"}
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d records, found %d", len(expected), len(records))
+	}
+	for i, r := range records {
+		if r.Message != expected[i] {
+			t.Errorf("Expected record %d to be %q, found %q", i, expected[i], r.Message)
+		}
+		attrs := recordAttrs(r)
+		if attrs["package"].String() != "mkdeb" {
+			t.Errorf("Expected %q to include the package name, found %+v", r.Message, attrs)
+		}
+		if _, ok := attrs["duration"]; !ok {
+			t.Errorf("Expected %q to include a duration, found %+v", r.Message, attrs)
+		}
+	}
+	if files := recordAttrs(records[1])["files"].Int64(); files != 2 {
+		t.Errorf("Expected 2 files to be logged, found %d", files)
+	}
+}
+
+func TestBuildLoggingDisabled(t *testing.T) {
+	p := PackageSpecFixture(t)
+	if p.logger().Enabled(context.Background(), slog.LevelError) {
+		t.Errorf("Expected logging to be disabled when Logger is not set")
+	}
+}
@@ -0,0 +1,64 @@
+package deb
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// ForArchitecture returns a copy of the PackageSpec that builds the package for
+// arch. AutoPath and the source paths in Files are rendered with text/template
+// using the copy as data, so you can use a path like build/{{.Architecture}} to
+// pick up the binaries for each architecture.
+func (p *PackageSpec) ForArchitecture(arch string) (*PackageSpec, error) {
+	c := *p
+	c.Architecture = arch
+	c.Architectures = nil
+
+	autoPath, err := c.renderPath(p.AutoPath)
+	if err != nil {
+		return nil, err
+	}
+	c.AutoPath = autoPath
+
+	if p.Files != nil {
+		c.Files = map[string]string{}
+		for src, dest := range p.Files {
+			src, err := c.renderPath(src)
+			if err != nil {
+				return nil, err
+			}
+			c.Files[src] = dest
+		}
+	}
+	return &c, nil
+}
+
+// Packages returns one PackageSpec for each of the Architectures (see
+// ForArchitecture), or just this PackageSpec if Architectures is not set.
+func (p *PackageSpec) Packages() ([]*PackageSpec, error) {
+	if len(p.Architectures) == 0 {
+		return []*PackageSpec{p}, nil
+	}
+	packages := []*PackageSpec{}
+	for _, arch := range p.Architectures {
+		c, err := p.ForArchitecture(arch)
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, c)
+	}
+	return packages, nil
+}
+
+func (p *PackageSpec) renderPath(name string) (string, error) {
+	t, err := template.New(name).Parse(name)
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse path %q: %s", name, err)
+	}
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, p); err != nil {
+		return "", fmt.Errorf("Failed to render path %q: %s", name, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,68 @@
+package deb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildArchitectures(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.Architecture = ""
+	p.Architectures = []string{"amd64", "arm64"}
+
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, arch := range p.Architectures {
+		filename := filepath.Join(dir, arch, "usr", "bin", "tool")
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte("tool for "+arch), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.AutoPath = filepath.Join(dir, "{{.Architecture}}")
+
+	if err := p.Validate(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Build("output"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, arch := range p.Architectures {
+		filename := path.Join("output", "mkdeb-0.1.0-"+arch+".deb")
+		defer os.Remove(filename)
+
+		_, contents := readDeb(t, filename)
+		_, control := readTarGzData(t, bytes.NewReader(contents["control.tar.gz"]))
+		if !strings.Contains(string(control["control"]), "Architecture: "+arch+"\n") {
+			t.Errorf("Expected %s control file to have architecture %s\n%s", filename, arch, control["control"])
+		}
+		_, data := readTarGzData(t, bytes.NewReader(contents["data.tar.gz"]))
+		if found := string(data["usr/bin/tool"]); found != "tool for "+arch {
+			t.Errorf("Expected %s to contain the %s binary, found %q", filename, arch, found)
+		}
+	}
+}
+
+func TestValidateArchitectures(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Architecture = ""
+	p.Architectures = []string{"amd64", "x86_64"}
+
+	err := p.Validate(false)
+	if err == nil || !strings.Contains(err.Error(), "x86_64") {
+		t.Errorf("Expected unsupported arch error; found %+v", err)
+	}
+}
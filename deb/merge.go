@@ -0,0 +1,121 @@
+package deb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+)
+
+// MergeSpecs returns a new PackageSpec combining base and override. This lets
+// several packages share common fields from a base config (see Extends).
+//
+// Fields set in override replace the same fields in base, except for lists and
+// maps. Lists like Depends are appended to the list in base, skipping values
+// that are already present, and maps like Files are merged, with entries in
+// override replacing entries in base that have the same key. Since there is no
+// way to tell an unset bool from false, override can enable a bool option but
+// not disable one that is enabled in base. The lists and maps in the result
+// are copies, so neither base nor override is changed by modifying it.
+//
+// Paths are not rewritten, so relative paths from base, like AutoPath or the
+// sources in Files, are resolved from wherever the merged spec is built. When
+// configs are loaded with NewPackageSpecFromFile and built with mkdeb that is
+// the directory of the config that extends base, not the directory of base.
+func MergeSpecs(base, override *PackageSpec) *PackageSpec {
+	merged := *base
+
+	// PackageSpec has a lot of fields, so use reflection rather than listing
+	// them all here and keeping the list up to date.
+	dst := reflect.ValueOf(&merged).Elem()
+	src := reflect.ValueOf(override).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		field := dst.Field(i)
+		value := src.Field(i)
+		if !field.CanSet() || (value.IsZero() && field.IsZero()) {
+			continue
+		}
+		// Lists and maps are always copied so changing the merged spec
+		// doesn't change base
+		switch field.Kind() {
+		case reflect.Slice:
+			list := reflect.MakeSlice(field.Type(), 0, field.Len()+value.Len())
+			list = reflect.AppendSlice(list, field)
+			for j := 0; j < value.Len(); j++ {
+				if !containsValue(list, value.Index(j)) {
+					list = reflect.Append(list, value.Index(j))
+				}
+			}
+			field.Set(list)
+		case reflect.Map:
+			m := reflect.MakeMap(field.Type())
+			for _, source := range []reflect.Value{field, value} {
+				iter := source.MapRange()
+				for iter.Next() {
+					m.SetMapIndex(iter.Key(), iter.Value())
+				}
+			}
+			field.Set(m)
+		default:
+			if !value.IsZero() {
+				field.Set(value)
+			}
+		}
+	}
+	return &merged
+}
+
+func containsValue(list, value reflect.Value) bool {
+	for i := 0; i < list.Len(); i++ {
+		if reflect.DeepEqual(list.Index(i).Interface(), value.Interface()) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadSpecFile loads filename, following Extends. seen holds the configs that
+// are already being loaded so we can detect loops.
+func loadSpecFile(filename string, seen map[string]bool) (*PackageSpec, error) {
+	abspath, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	if seen[abspath] {
+		return nil, fmt.Errorf("Config %s extends itself", filename)
+	}
+	seen[abspath] = true
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load without defaults so we can tell which fields were actually set
+	override := &PackageSpec{}
+	if err := json.Unmarshal(data, override); err != nil {
+		return nil, err
+	}
+	if override.Extends == "" {
+		return NewPackageSpecFromJSON(data)
+	}
+
+	// Extends is relative to the config file that refers to it
+	baseFile := override.Extends
+	if !filepath.IsAbs(baseFile) {
+		baseFile = filepath.Join(filepath.Dir(filename), baseFile)
+	}
+	base, err := loadSpecFile(baseFile, seen)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load %s: %s", override.Extends, err)
+	}
+	merged := MergeSpecs(base, override)
+
+	// The default priority depends on the section, which may be overridden
+	if merged.defaultedPriority && override.Priority == "" {
+		merged.Priority = ""
+		merged.applyDefaultPriority()
+	}
+	return merged, nil
+}
@@ -0,0 +1,132 @@
+package deb
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeSpecsScalars(t *testing.T) {
+	base := DefaultPackageSpec()
+	base.Package = "base"
+	base.Maintainer = "Chris Bednarski <banzaimonkey@gmail.com>"
+	base.Homepage = "https://github.com/cbednarski/mkdeb"
+	base.UpgradeConfigs = true
+
+	override := &PackageSpec{
+		Package:  "override",
+		Homepage: "https://www.example.com",
+	}
+
+	merged := MergeSpecs(base, override)
+	if merged.Package != "override" {
+		t.Errorf("Expected package %q, found %q", "override", merged.Package)
+	}
+	if merged.Homepage != "https://www.example.com" {
+		t.Errorf("Expected homepage %q, found %q", "https://www.example.com", merged.Homepage)
+	}
+	if merged.Maintainer != base.Maintainer {
+		t.Errorf("Expected maintainer %q, found %q", base.Maintainer, merged.Maintainer)
+	}
+	if merged.AutoPath != "deb-pkg" {
+		t.Errorf("Expected default autoPath, found %q", merged.AutoPath)
+	}
+	if !merged.UpgradeConfigs {
+		t.Errorf("Expected upgradeConfigs from base")
+	}
+
+	// Neither input is modified
+	if base.Package != "base" || override.Maintainer != "" {
+		t.Errorf("Expected inputs to be unchanged")
+	}
+}
+
+func TestMergeSpecsLists(t *testing.T) {
+	base := DefaultPackageSpec()
+	base.Depends = []string{"curl", "git"}
+	base.Files = map[string]string{"a": "/usr/bin/a", "b": "/usr/bin/b"}
+
+	override := &PackageSpec{
+		Depends: []string{"git", "python"},
+		Files:   map[string]string{"b": "/usr/local/bin/b", "c": "/usr/bin/c"},
+	}
+
+	merged := MergeSpecs(base, override)
+	expectedDepends := []string{"curl", "git", "python"}
+	if !reflect.DeepEqual(merged.Depends, expectedDepends) {
+		t.Errorf("Expected depends %+v, found %+v", expectedDepends, merged.Depends)
+	}
+	expectedFiles := map[string]string{"a": "/usr/bin/a", "b": "/usr/local/bin/b", "c": "/usr/bin/c"}
+	if !reflect.DeepEqual(merged.Files, expectedFiles) {
+		t.Errorf("Expected files %+v, found %+v", expectedFiles, merged.Files)
+	}
+	if len(base.Depends) != 2 || len(base.Files) != 2 {
+		t.Errorf("Expected base to be unchanged, found %+v", base)
+	}
+}
+
+func TestMergeSpecsCopies(t *testing.T) {
+	base := DefaultPackageSpec()
+	base.Depends = []string{"curl", "git"}
+	base.Files = map[string]string{"a": "/usr/bin/a"}
+
+	// Fields the override doesn't set must still be copied from base
+	merged := MergeSpecs(base, &PackageSpec{Package: "override"})
+	merged.Depends[0] = "wget"
+	merged.Files["b"] = "/usr/bin/b"
+
+	if !reflect.DeepEqual(base.Depends, []string{"curl", "git"}) {
+		t.Errorf("Expected base depends to be unchanged, found %+v", base.Depends)
+	}
+	if !reflect.DeepEqual(base.Files, map[string]string{"a": "/usr/bin/a"}) {
+		t.Errorf("Expected base files to be unchanged, found %+v", base.Files)
+	}
+}
+
+func TestNewPackageSpecFromFileExtends(t *testing.T) {
+	p, err := NewPackageSpecFromFile(path.Join("test-fixtures", "example-extends.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Package != "mkdeb" || p.Architecture != "amd64" || p.Section != "utils" {
+		t.Errorf("Expected fields from both configs, found %+v", p)
+	}
+	if p.Homepage != "https://www.example.com/mkdeb" {
+		t.Errorf("Expected homepage from override, found %q", p.Homepage)
+	}
+	if p.Priority != "optional" {
+		t.Errorf("Expected default priority for the utils section, found %q", p.Priority)
+	}
+	if expected := []string{"curl (>= 7.0.0)", "git"}; !reflect.DeepEqual(p.Depends, expected) {
+		t.Errorf("Expected depends %+v, found %+v", expected, p.Depends)
+	}
+	if len(p.Files) != 2 {
+		t.Errorf("Expected files from both configs, found %+v", p.Files)
+	}
+}
+
+func TestNewPackageSpecFromFileExtendsLoop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := filepath.Join(dir, "a.json")
+	b := filepath.Join(dir, "b.json")
+	if err := ioutil.WriteFile(a, []byte(`{"extends": "b.json"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(b, []byte(`{"extends": "a.json"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewPackageSpecFromFile(a)
+	if err == nil || !strings.Contains(err.Error(), "extends itself") {
+		t.Errorf("Expected extends loop error; found %+v", err)
+	}
+}
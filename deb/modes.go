@@ -0,0 +1,58 @@
+package deb
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// File modes used in the data archive when the host filesystem can't tell us
+// the real Unix permissions. See IgnoreFileModes.
+const (
+	DefaultFileMode = 0644
+	DefaultExecMode = 0755
+)
+
+// ignoreFileModes returns true if permissions reported by the filesystem
+// should be replaced with DefaultFileMode or DefaultExecMode. Windows does not
+// have Unix permissions, so this is always the case there.
+func (p *PackageSpec) ignoreFileModes() bool {
+	return p.IgnoreFileModes || runtime.GOOS == "windows"
+}
+
+// defaultMode picks a mode for target based on what kind of file it is, since
+// we can't trust the permissions from the filesystem. Directories, files under
+// a bin or sbin directory, scripts, and ELF binaries are executable. magic
+// returns the first few bytes of the file and is only called if needed.
+func defaultMode(target string, info os.FileInfo, magic func() []byte) int64 {
+	if info.IsDir() {
+		return DefaultExecMode
+	}
+	for _, dir := range strings.Split(target, "/") {
+		if dir == "bin" || dir == "sbin" {
+			return DefaultExecMode
+		}
+	}
+
+	head := magic()
+	if bytes.HasPrefix(head, []byte("#!")) || bytes.Equal(head, []byte("\x7fELF")) {
+		return DefaultExecMode
+	}
+	return DefaultFileMode
+}
+
+// fileMagic returns the first four bytes of filename, or nil if it can't be
+// read. We'll find out about that when we copy the file.
+func (p *PackageSpec) fileMagic(filename string) []byte {
+	file, err := p.open(filename)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	magic := make([]byte, 4)
+	n, _ := io.ReadFull(file, magic)
+	return magic[:n]
+}
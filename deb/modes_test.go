@@ -0,0 +1,64 @@
+package deb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateDataArchiveIgnoreFileModes(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Simulate a filesystem that reports bogus permissions for everything
+	root := filepath.Join(dir, "root")
+	for name, data := range map[string]string{
+		"etc/tool/config":  "key = value\n",
+		"usr/bin/tool":     "tool binary",
+		"usr/lib/tool.sh":  "#!/bin/sh\necho tool\n",
+		"usr/lib/tool.elf": "\x7fELF binary",
+	} {
+		filename := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(data), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(filename, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.AutoPath = root
+	p.IgnoreFileModes = true
+
+	data := filepath.Join(dir, "data.tar.gz")
+	if err := p.CreateDataArchive(data); err != nil {
+		t.Fatal(err)
+	}
+
+	headers, _ := readTarGz(t, data)
+	for name, expected := range map[string]int64{
+		"etc":              DefaultExecMode,
+		"etc/tool/config":  DefaultFileMode,
+		"usr/bin/tool":     DefaultExecMode,
+		"usr/lib/tool.sh":  DefaultExecMode,
+		"usr/lib/tool.elf": DefaultExecMode,
+	} {
+		header, ok := headers[name]
+		if !ok {
+			t.Errorf("Expected %s in the data archive", name)
+			continue
+		}
+		if mode := header.Mode & 0777; mode != expected {
+			t.Errorf("Expected %s to have mode %o, found %o", name, expected, mode)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package deb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	// multiArchValues are the values allowed in the Multi-Arch field
+	multiArchValues = []string{"same", "foreign", "allowed", "no"}
+
+	// multiArchTriplets maps supported architectures to the GNU triplet used
+	// in multiarch paths like /usr/lib/x86_64-linux-gnu
+	multiArchTriplets = map[string]string{
+		"alpha":       "alpha-linux-gnu",
+		"amd64":       "x86_64-linux-gnu",
+		"arc":         "arc-linux-gnu",
+		"arm":         "arm-linux-gnu",
+		"arm64":       "aarch64-linux-gnu",
+		"arm64ilp32":  "aarch64-linux-gnu_ilp32",
+		"armeb":       "armeb-linux-gnu",
+		"armel":       "arm-linux-gnueabi",
+		"armhf":       "arm-linux-gnueabihf",
+		"avr32":       "avr32-linux-gnu",
+		"hppa":        "hppa-linux-gnu",
+		"i386":        "i386-linux-gnu",
+		"ia64":        "ia64-linux-gnu",
+		"loong64":     "loongarch64-linux-gnu",
+		"m32r":        "m32r-linux-gnu",
+		"m68k":        "m68k-linux-gnu",
+		"mips":        "mips-linux-gnu",
+		"mips64":      "mips64-linux-gnuabi64",
+		"mips64el":    "mips64el-linux-gnuabi64",
+		"mips64r6":    "mipsisa64r6-linux-gnuabi64",
+		"mips64r6el":  "mipsisa64r6el-linux-gnuabi64",
+		"mipsel":      "mipsel-linux-gnu",
+		"mipsn32":     "mips64-linux-gnuabin32",
+		"mipsn32el":   "mips64el-linux-gnuabin32",
+		"mipsn32r6":   "mipsisa64r6-linux-gnuabin32",
+		"mipsn32r6el": "mipsisa64r6el-linux-gnuabin32",
+		"mipsr6":      "mipsisa32r6-linux-gnu",
+		"mipsr6el":    "mipsisa32r6el-linux-gnu",
+		"nios2":       "nios2-linux-gnu",
+		"or1k":        "or1k-linux-gnu",
+		"powerpc":     "powerpc-linux-gnu",
+		"powerpcel":   "powerpcle-linux-gnu",
+		"powerpcspe":  "powerpc-linux-gnuspe",
+		"ppc64":       "powerpc64-linux-gnu",
+		"ppc64el":     "powerpc64le-linux-gnu",
+		"riscv64":     "riscv64-linux-gnu",
+		"s390":        "s390-linux-gnu",
+		"s390x":       "s390x-linux-gnu",
+		"sh3":         "sh3-linux-gnu",
+		"sh3eb":       "sh3eb-linux-gnu",
+		"sh4":         "sh4-linux-gnu",
+		"sh4eb":       "sh4eb-linux-gnu",
+		"sparc":       "sparc-linux-gnu",
+		"sparc64":     "sparc64-linux-gnu",
+		"tilegx":      "tilegx-linux-gnu",
+		"x32":         "x86_64-linux-gnux32",
+	}
+)
+
+// hasTriplet returns true if one of the directories in target is a multiarch
+// triplet, e.g. usr/lib/x86_64-linux-gnu/libfoo.so.1
+func hasTriplet(target string) bool {
+	parts := strings.Split(target, "/")
+	for _, part := range parts[:len(parts)-1] {
+		for _, triplet := range multiArchTriplets {
+			if part == triplet {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// multiArchWarnings warns about files in a Multi-Arch: same package that are
+// not under an architecture-qualified path. When the package is installed for
+// more than one architecture these files collide unless they are identical,
+// so only documentation under /usr/share/doc is allowed.
+func (p *PackageSpec) multiArchWarnings() []string {
+	if p.MultiArch != "same" {
+		return nil
+	}
+	targets, err := p.ListArchivePaths()
+	if err != nil {
+		// This will be reported when we try to build the package
+		return nil
+	}
+
+	unqualified := []string{}
+	for _, target := range targets {
+		if hasTriplet(target) || strings.HasPrefix(target, "usr/share/doc/") {
+			continue
+		}
+		unqualified = append(unqualified, "/"+target)
+	}
+	if len(unqualified) == 0 {
+		return nil
+	}
+	sort.Strings(unqualified)
+	triplet, ok := multiArchTriplets[p.Architecture]
+	if !ok {
+		triplet = multiArchTriplets["amd64"]
+	}
+	return []string{fmt.Sprintf("Multi-Arch: same packages must install files under architecture-qualified paths like /usr/lib/%s, or they will conflict when installed for another architecture; found %s", triplet, strings.Join(unqualified, ", "))}
+}
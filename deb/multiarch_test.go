@@ -0,0 +1,71 @@
+package deb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWarningsMultiArchSame(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, file := range []string{
+		"usr/lib/x86_64-linux-gnu/libfoo.so.1",
+		"usr/share/doc/libfoo1/copyright",
+		"usr/lib/libfoo.so.1",
+		"usr/bin/foo",
+	} {
+		filename := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte("data\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := WarningsFixture(t)
+	p.Section = "libs"
+	p.AutoPath = dir
+
+	if warnings := p.Warnings(); len(warnings) != 0 {
+		t.Fatalf("Expected no warnings without Multi-Arch; found %+v", warnings)
+	}
+
+	p.MultiArch = "same"
+	if err := p.Validate(false); err != nil {
+		t.Fatal(err)
+	}
+	warnings := p.Warnings()
+	if len(warnings) != 1 {
+		t.Fatalf("Expected one Multi-Arch warning; found %+v", warnings)
+	}
+	if !strings.Contains(warnings[0], "found /usr/bin/foo, /usr/lib/libfoo.so.1") || !strings.HasSuffix(warnings[0], "/usr/lib/libfoo.so.1") {
+		t.Errorf("Expected warning to list only unqualified files; found %q", warnings[0])
+	}
+	if !strings.Contains(warnings[0], "/usr/lib/x86_64-linux-gnu,") {
+		t.Errorf("Expected warning to suggest the amd64 triplet; found %q", warnings[0])
+	}
+
+	// The suggested path matches the package architecture
+	p.Architecture = "arm64"
+	warnings = p.Warnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "/usr/lib/aarch64-linux-gnu,") {
+		t.Errorf("Expected warning to suggest the arm64 triplet; found %+v", warnings)
+	}
+
+	p.Architecture = "all"
+	if err := p.Validate(false); err == nil || !strings.Contains(err.Error(), "Multi-Arch: same is not allowed") {
+		t.Errorf("Expected Multi-Arch: same to be invalid for all, found %v", err)
+	}
+	p.MultiArch = "sometimes"
+	if err := p.Validate(false); err == nil || !strings.Contains(err.Error(), `Multi-Arch "sometimes" is invalid`) {
+		t.Errorf("Expected invalid Multi-Arch error, found %v", err)
+	}
+}
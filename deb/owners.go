@@ -0,0 +1,72 @@
+package deb
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cbednarski/mkdeb/deb/tar"
+)
+
+// reOwnerName matches user and group names that are safe to use on debian
+var reOwnerName = regexp.MustCompile(`^[a-z_][a-z0-9_-]*$`)
+
+// owner is the user and group that own a file in the data archive. Either
+// the numeric id or the name is set for each.
+type owner struct {
+	uid   int
+	gid   int
+	uname string
+	gname string
+}
+
+// parseOwner parses an entry in Owners like "svc:svc" or "1000:1000". If the
+// group is left out it is the same as the user.
+func parseOwner(spec string) (owner, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) == 1 {
+		parts = append(parts, parts[0])
+	}
+
+	o := owner{}
+	for i, part := range parts {
+		id, err := strconv.Atoi(part)
+		name := ""
+		if err != nil || id < 0 {
+			if !reOwnerName.MatchString(part) {
+				return o, fmt.Errorf("Owner %q is invalid; expected a user and group like 'svc:svc' or '1000:1000'", spec)
+			}
+			id, name = 0, part
+		}
+		if i == 0 {
+			o.uid, o.uname = id, name
+		} else {
+			o.gid, o.gname = id, name
+		}
+	}
+	return o, nil
+}
+
+// setOwner sets the owner of target in header, which is root unless target is
+// listed in Owners
+func (p *PackageSpec) setOwner(header *tar.Header, target string) error {
+	header.Uid = 0
+	header.Gid = 0
+	header.Uname = "root"
+	header.Gname = "root"
+
+	for dest, spec := range p.Owners {
+		if path.Join(".", toSlash(dest)) != target {
+			continue
+		}
+		o, err := parseOwner(spec)
+		if err != nil {
+			return err
+		}
+		header.Uid, header.Uname = o.uid, o.uname
+		header.Gid, header.Gname = o.gid, o.gname
+	}
+	return nil
+}
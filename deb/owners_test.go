@@ -0,0 +1,56 @@
+package deb
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestBuildOwners(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.Force = true
+	p.Owners = map[string]string{
+		"/etc/package1":           "svc",
+		"/etc/package1/config":    "svc:adm",
+		"/usr/local/bin/package1": "1000:100",
+	}
+	if err := p.Validate(true); err != nil {
+		t.Fatal(err)
+	}
+
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+	if err := p.Build("output"); err != nil {
+		t.Fatal(err)
+	}
+	_, contents := readDeb(t, filename)
+	headers, _ := readTarGzData(t, bytes.NewReader(contents["data.tar.gz"]))
+
+	for name, expected := range map[string]owner{
+		"etc/package1":           {uname: "svc", gname: "svc"},
+		"etc/package1/config":    {uname: "svc", gname: "adm"},
+		"usr/local/bin/package1": {uid: 1000, gid: 100},
+		"usr/local/bin":          {uname: "root", gname: "root"},
+	} {
+		header := headers[name]
+		if header == nil {
+			t.Errorf("Expected %s in the data archive", name)
+			continue
+		}
+		found := owner{uid: header.Uid, gid: header.Gid, uname: header.Uname, gname: header.Gname}
+		if found != expected {
+			t.Errorf("Expected %s to be owned by %+v, found %+v", name, expected, found)
+		}
+	}
+
+	for _, spec := range []string{"", "Svc", "svc:", "svc:adm:x", "-1"} {
+		p.Owners = map[string]string{"/etc/package1/config": spec}
+		err := p.Validate(true)
+		if err == nil || !strings.Contains(err.Error(), "Owner") {
+			t.Errorf("Expected owner %q to be invalid; found %+v", spec, err)
+		}
+	}
+}
@@ -15,29 +15,43 @@ package deb
 import (
 	"bytes"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
+	"log/slog"
+	"math"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 	"time"
 
 	"github.com/cbednarski/mkdeb/deb/tar"
 
-	"github.com/klauspost/pgzip"
 	"github.com/laher/argo/ar"
 )
 
 var (
-	reDepends     = regexp.MustCompile(`^[a-zA-Z0-9.+_-]+( \((>|>=|<|<=|=) ([0-9][0-9a-zA-Z.-]*?)\))?$`)
-	reReplacesEtc = regexp.MustCompile(`^[a-zA-Z0-9.+_-]+( \(<< ([0-9][0-9a-zA-Z.-]*?)\))?$`)
+	rePackageName    = regexp.MustCompile(`^[a-z0-9][a-z0-9.+-]+$`)
+	reVersion        = regexp.MustCompile(`^([0-9]+:)?[0-9][a-zA-Z0-9.+~]*(-[a-zA-Z0-9.+~]+)*$`)
+	reDepends        = regexp.MustCompile(`^[a-zA-Z0-9.+_-]+( \((>|>=|<|<=|=) ([0-9][0-9a-zA-Z.+~:-]*?)\))?$`)
+	reReplacesEtc    = regexp.MustCompile(`^[a-zA-Z0-9.+_-]+( \(<< ([0-9][0-9a-zA-Z.-]*?)\))?$`)
+	reBuiltUsing     = regexp.MustCompile(`^[a-z0-9][a-z0-9.+-]+ \(= ([0-9]+:)?[0-9][a-zA-Z0-9.+~:-]*\)$`)
+	reFieldName      = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*$`)
+	reTag            = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]*::[a-z0-9+.:{}-]+$`)
+	reFormatVersion  = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+	reMaintainer     = regexp.MustCompile(`^[^<>,]+ <[^<>@\s]+@[^<>@\s]+>$`)
+	reChangelogEntry = regexp.MustCompile(`^(\S+) \(([^()\s]+)\) ([^;]+);`) // e.g. mkdeb (1.2.0-1) unstable; urgency=low
 
 	controlFiles = []string{
 		"preinst",
@@ -46,18 +60,129 @@ var (
 		"postrm",
 	}
 
+	// reservedControlNames are members of the control archive. Data files
+	// can't be installed at the top level with these names.
+	reservedControlNames = []string{
+		"conffiles",
+		"config",
+		"control",
+		"md5sums",
+		"postinst",
+		"postrm",
+		"preinst",
+		"prerm",
+		"sha256sums",
+		"shlibs",
+		"symbols",
+		"templates",
+		"triggers",
+	}
+
+	// testsuites are the test suites that can be named in Testsuite
+	testsuites = []string{
+		"autopkgtest",
+		"autopkgtest-pkg-dkms",
+		"autopkgtest-pkg-elpa",
+		"autopkgtest-pkg-go",
+		"autopkgtest-pkg-nodejs",
+		"autopkgtest-pkg-octave",
+		"autopkgtest-pkg-perl",
+		"autopkgtest-pkg-python",
+		"autopkgtest-pkg-r",
+		"autopkgtest-pkg-ruby",
+	}
+
+	priorities = []string{
+		"required",
+		"important",
+		"standard",
+		"optional",
+		"extra", // Deprecated in favor of optional
+	}
+
+	// Top-level directories from the filesystem hierarchy standard that
+	// packages normally install files under
+	rootDirs = []string{"usr", "etc", "var", "opt", "bin", "sbin", "lib", "srv", "run"}
+
+	// Archive areas (e.g. contrib/net) are stripped before checking sections
+	sections = []string{
+		"admin", "cli-mono", "comm", "database", "debian-installer", "debug",
+		"devel", "doc", "editors", "education", "electronics", "embedded",
+		"fonts", "games", "gnome", "gnu-r", "gnustep", "graphics", "hamradio",
+		"haskell", "httpd", "interpreters", "introspection", "java",
+		"javascript", "kde", "kernel", "libdevel", "libs", "lisp",
+		"localization", "mail", "math", "metapackages", "misc", "net", "news",
+		"ocaml", "oldlibs", "otherosfs", "perl", "php", "python", "ruby",
+		"rust", "science", "shells", "sound", "tasks", "tex", "text", "utils",
+		"vcs", "video", "web", "x11", "xfce", "zope",
+	}
+
+	// defaultExcludes are skipped when scanning AutoPath, in addition to any
+	// patterns in PackageSpec.Exclude
+	defaultExcludes = []string{
+		".git",
+		".svn",
+		".hg",
+		".bzr",
+		"CVS",
+		".DS_Store",
+		"*.swp",
+		"*~",
+		"#*#",
+		".#*",
+	}
+
+	// supportedArchitectures matches the Linux architectures listed by
+	// dpkg-architecture -L. Comments show the GOARCH to build binaries for
+	// the architectures Go supports.
 	supportedArchitectures = []string{
 		"all", // This is used for non-binary packages
-		"amd64",
-		"arm64",
-		"armel",
-		"armhf",
-		"i386",
-		"mips",
-		"mipsel",
+		"alpha",
+		"amd64", // GOARCH=amd64
+		"arc",
+		"arm",
+		"arm64", // GOARCH=arm64
+		"arm64ilp32",
+		"armeb",
+		"armel", // GOARCH=arm with GOARM=5
+		"armhf", // GOARCH=arm with GOARM=7
+		"avr32",
+		"hppa",
+		"i386", // GOARCH=386
+		"ia64",
+		"loong64", // GOARCH=loong64
+		"m32r",
+		"m68k",
+		"mips",     // GOARCH=mips
+		"mips64",   // GOARCH=mips64
+		"mips64el", // GOARCH=mips64le
+		"mips64r6",
+		"mips64r6el",
+		"mipsel", // GOARCH=mipsle
+		"mipsn32",
+		"mipsn32el",
+		"mipsn32r6",
+		"mipsn32r6el",
+		"mipsr6",
+		"mipsr6el",
+		"nios2",
+		"or1k",
 		"powerpc",
-		"ppc64el",
-		"s390x",
+		"powerpcel",
+		"powerpcspe",
+		"ppc64",   // GOARCH=ppc64
+		"ppc64el", // GOARCH=ppc64le
+		"riscv64", // GOARCH=riscv64
+		"s390",
+		"s390x", // GOARCH=s390x
+		"sh3",
+		"sh3eb",
+		"sh4",
+		"sh4eb",
+		"sparc",
+		"sparc64",
+		"tilegx",
+		"x32",
 	}
 )
 
@@ -71,18 +196,23 @@ var (
 // Package is the name of your package, and typically matches the name of your
 // main program.
 //
-// Version is a debian version string. See the reference for more details.
-// This field is not currently validated except to verify that it is specified,
-// but if the syntax is invalid you will not be able to install the package.
+// Version is a debian version string in the form [epoch:]upstream[-revision],
+// such as 1.2.3 or 2:1.0-1ubuntu1. The upstream portion must start with a
+// digit and may contain letters, digits, and . + ~. See the reference for more
+// details.
 //
 // Architecture is the CPU architecture your package is compiled for. If your
 // package does not include a compiled binary you can set this to "all".
 //
 // Maintainer should indicate contact information for the package, such as
-// Chris Bednarski <chris@example.com>
+// Chris Bednarski <chris@example.com>. Other forms are reported by Warnings().
 //
 // Description should briefly explain what your package is used for. Only a
-// single line is currently supported.
+// single line is currently supported, though BuildInfo adds a second line.
+//
+// Like lintian, Warnings() reports a synopsis that is over 80
+// characters, starts with an article or the package name, or ends with a full
+// stop.
 //
 // Optional Fields
 //
@@ -95,13 +225,57 @@ var (
 //	    "tree"
 //	]
 //
+// Whitespace is normalized, so "curl(>=7.0.0)" is written as "curl (>= 7.0.0)",
+// and duplicates are removed from each list.
+//
 // Conflicts, Breaks, and Replaces work in a very similar way. For additional
 // information on when you should use optional fields and how to specify them,
 // refer to the debian package specification.
 //
+// BuiltUsing lists source packages that were incorporated into this package
+// during the build, such as statically linked libraries. Each entry must name
+// an exact version, e.g. "gcc-10 (= 10.2.1-6)".
+//
+// Section classifies your package, e.g. "utils" or "net". It defaults to misc.
+// Non-standard sections are reported by Warnings().
+//
+// Priority must be one of required, important, standard, optional, or extra.
+// Note that extra is deprecated in favor of optional, and Warnings() reports it
+// if you set it explicitly. If Priority is not set it defaults to optional when
+// Section is a standard debian section, or extra otherwise.
+//
 // Homepage should link to your package's source repository, if applicable.
 // Otherwise link to your website.
 //
+// VcsGit and VcsBrowser point to the git repository for your package's source
+// and a web interface for browsing it, respectively.
+//
+// Origin names the organization that produced the package, and Bugs is a URL
+// (such as https://example.com/issues) where bugs should be reported.
+//
+// Essential marks a package that is required for the system to work, so dpkg
+// will refuse to remove it. This is only appropriate for base system packages.
+//
+// Tags are debtags that classify the package, like "role::program" or
+// "implemented-in::go". They are written to the Tag field.
+//
+// ExtraFields adds fields mkdeb does not support directly to the control file,
+// like "X-Commit": "abcd123". They are written before Description.
+//
+// MultiArch is one of same, foreign, allowed, or no. Set it to same for
+// libraries that can be installed for more than one architecture at a time,
+// which requires every file to be under an architecture-qualified path like
+// /usr/lib/x86_64-linux-gnu. Files that are not are reported as warnings.
+//
+// Testsuite names the test suites that can be run against the package, usually
+// autopkgtest. Separate multiple suites with commas.
+//
+// Date is used as the timestamp of every file in the package so rebuilding it
+// always produces the same archive. It must be in RFC 2822 format, e.g. "Wed,
+// 01 May 2024 12:00:00 +0000" or "Wed, 1 May 2024 12:00:00 +0000". Date is not
+// written to the control file since it isn't a standard field for binary
+// packages and lintian warns about it; add it to ExtraFields if you need it.
+//
 // Control Scripts
 //
 // You may need to perform additional setup (or cleanup) when (un)installing a
@@ -111,6 +285,11 @@ var (
 // These are commonly used to create users, start or stop services, or perform
 // cleanup when a package is uninstalled.
 //
+// Each control script field may be a path to a script file, or the body of the
+// script itself. Inline scripts are detected by a leading shebang, e.g.
+//
+//	"postinst": "#!/bin/sh\nuseradd mkdeb\n"
+//
 // AutoPath
 //
 // The Build method is designed to automatically fill in most of the build
@@ -122,19 +301,222 @@ var (
 // Whether or not AutoPath is used you may supplement the list of files to be
 // included by specifying the Files field.
 //
+// Files can't be installed at the top level with the name of a control archive
+// member, like /postinst or /md5sums, and a control script can't also be
+// listed in Files. Build fails if either would happen.
+//
+// RootTree indicates that AutoPath is a prepared root filesystem, laid out the
+// way dpkg-deb --build expects. Control scripts are read from the DEBIAN
+// directory at the top of AutoPath, which is not included in the package, and
+// files elsewhere in the tree named like control scripts (e.g. postinst) are
+// packaged like any other file. Paths listed in DEBIAN/conffiles are added to
+// Conffiles.
+//
+// Files and directories in AutoPath matching a pattern in Exclude are skipped.
+// Patterns use path.Match syntax and are matched against the file name, e.g.
+// "*.bak". VCS metadata like .git and editor backups like *.swp and *~ are
+// always skipped unless NoDefaultExcludes is set.
+//
+// RemoteFiles works like Files, but each source is an http(s) URL that is
+// downloaded during the build. You can verify the download by appending the
+// expected sha256 checksum to the URL, like this:
+//
+//	"remoteFiles": {
+//	    "https://example.com/mkdeb.tar.gz#sha256=2c26b46b...": "/opt/mkdeb.tar.gz"
+//	}
+//
+// Downloads time out after 10 minutes. Remote files are installed with mode
+// 0755 if they are in a bin or sbin directory or look like a script or ELF
+// binary, and 0644 otherwise. Their mtime comes from the Last-Modified header
+// when the server sends one.
+//
+// ArchiveFiles also works like Files, but each source is the name of a member
+// inside the tar, tar.gz, or zip archive specified by FromArchive. Members are
+// copied directly into the package without extracting the archive.
+//
+//	"fromArchive": "upstream-1.0.tar.gz",
+//	"archiveFiles": {
+//	    "upstream-1.0/bin/upstream": "/usr/bin/upstream"
+//	}
+//
+// Prefix is prepended to the path of every file in the package, whether it
+// comes from AutoPath, Files, RemoteFiles, or ArchiveFiles. For example, with
+// a Prefix of /opt/vendor the file usr/bin/foo is installed to
+// /opt/vendor/usr/bin/foo. Note that files are only treated as conffiles if
+// they are installed under /etc after the prefix is applied, unless they are
+// listed in Conffiles.
+//
+// Conffiles lists the install paths of additional files that should be
+// treated as config files, for files outside /etc like /opt/app/config.yml.
+// Each path must be included in the package. These are left as-is when
+// upgrading the package even if UpgradeConfigs is set.
+//
+// FilenameTemplate changes the name of the package file from the default of
+// package-version-arch.deb. It is a text/template rendered with the
+// PackageSpec, and must produce a name ending in .deb, e.g.
+//
+//	"filenameTemplate": "{{.Package}}_{{.Version}}_{{.Architecture}}_prod.deb"
+//
+// Architectures builds a separate package for each architecture listed,
+// instead of the one specified by Architecture. AutoPath and sources in Files
+// may refer to {{.Architecture}} to use different files for each one, e.g.
+//
+//	"architectures": ["amd64", "arm64"],
+//	"autoPath": "build/{{.Architecture}}"
+//
 // Build Time Options
 //
+// ExtraRootDirs lists top-level directories, in addition to standard FHS
+// directories like usr and etc, that files may be installed under without a
+// warning.
+//
+// AllowWorldWritable lists the install paths of files, like /var/spool/app/drop,
+// that are intentionally writable by everyone. Other world-writable files are
+// reported by Warnings().
+//
+// Extends is the path to a base config, relative to this one. Fields from the
+// base config are used unless this config overrides them; see MergeSpecs for
+// details. This is only used when loading a config with
+// NewPackageSpecFromFile. Relative paths in the base config, like AutoPath,
+// are relative to the config that extends it, not to the base config itself.
+//
 // TempPath controls where intermediate files are written during the build. This
 // defaults to the system temp directory (usually /tmp).
 //
+// ChecksumCache saves the md5sums of source files under TempPath, or
+// ~/.cache/mkdeb if TempPath isn't set, so they don't need to be calculated
+// again in the next build. A cached checksum is used
+// until the file's size or modification time changes. Checksums are always
+// calculated again to verify the files listed in Checksums.
+//
 // UpgradeConfigs causes a package upgrade to replace all of the config files.
 // By default files under /etc are left as-is when upgrading a package so you
 // can keep changes made to your config files, but if you want to upgrade the
-// config files themselves you will need to set UpgradeConfigs to true.
+// config files themselves you will need to set UpgradeConfigs to true. This
+// does not apply to files listed in Conffiles.
+//
+// PreserveConfigs lists config files under /etc that are exceptions to
+// UpgradeConfigs. If UpgradeConfigs is set these are still left as-is when
+// upgrading, and otherwise these are replaced like regular files.
 //
 // PreserveSymlinks writes symlinks to the archive. By default the contents of
 // the file the symlink is pointing to is copied into the .deb package.
 //
+// FollowDirSymlinks causes symlinked directories in AutoPath to be scanned as
+// if they were regular directories. By default they are not followed.
+//
+// CaseInsensitiveDuplicates treats files whose paths differ only by case as
+// duplicates, e.g. etc/Foo and etc/foo, which would collide if the package is
+// installed on a case-insensitive filesystem.
+//
+// SplitDebug moves debug information from ELF binaries into a separate
+// package-dbgsym package under /usr/lib/debug, and strips the binaries in the
+// main package. This requires objcopy.
+//
+// DebugExtension is the file extension of the -dbgsym package, either deb (the
+// default) or ddeb, which some toolchains expect for debug packages.
+//
+// CompressOver gzips files larger than this many bytes whose extension is in
+// CompressExtensions, like [".txt", ".json"], and installs them with .gz added
+// to their name. Files that are already compressed, executables, and conffiles
+// are left alone, as are ArchiveFiles. md5sums and Installed-Size are
+// calculated from the compressed files.
+//
+// TarFormat is the tar format used for the control and data archives: pax
+// (the default), gnu, or ustar. Some old extractors only understand gnu. The
+// build fails if a file's path or size can't be represented in the format,
+// e.g. ustar paths are limited to 255 characters and must be ASCII.
+//
+// FormatVersion is written to the debian-binary member of the package. This
+// defaults to 2.0, which is what dpkg expects, and you should not normally need
+// to change it.
+//
+// ControlCompression and DataCompression set the compression used for the
+// control and data archives in the package. Each may be gzip (the default), xz,
+// or none. xz typically produces smaller packages but is slower to build.
+//
+// KeepIntermediate leaves the build workspace in place after Build finishes so
+// you can inspect control.tar.gz and data.tar.gz. The workspace is created
+// under TempPath and its location is logged.
+//
+// BuildTime is the timestamp used for the control files and .deb archive
+// members. It defaults to Date if that is set, or the time the build starts.
+// Set ClampMTime to also use it for every file in the package instead of their
+// modification time, so building the same files always produces the same data
+// archive.
+//
+// GitMTime sets the modification time of each file in the package to the time
+// of the last git commit that changed it. Directories and files that are not
+// tracked by git use BuildTime instead, as if ClampMTime was set.
+//
+// BuildInfo adds a line like "Built: 2024-05-01 (abcd123)" to the extended
+// description with the date of the build and the git commit checked out in
+// the current directory, if any.
+//
+// PreBuild and PostBuild are shell commands the build command runs in the
+// config directory before and after building the package, like "make". The
+// build stops if a PreBuild command fails. Build does not run them.
+//
+// Verify reads the package back after it is built and checks that the control
+// and data archives can be decompressed and that every file matches md5sums.
+// If verification fails the package is removed.
+//
+// Alternatives registers programs in the package with update-alternatives, so
+// for example /usr/bin/vim.tiny can provide /usr/bin/editor. The commands are
+// added to postinst and prerm, which are created if needed. If a control script
+// contains a #DEBHELPER# line the commands replace it, otherwise they are
+// appended to the script.
+//
+//	"alternatives": [
+//	    {"link": "/usr/bin/editor", "path": "/usr/bin/vim.tiny", "priority": 50}
+//	]
+//
+// SystemdUnits lists systemd unit files, like app.service, to install under
+// /lib/systemd/system. The units are enabled and started by postinst, and
+// stopped and disabled by prerm when the package is removed, like
+// Alternatives. When the package is upgraded they are restarted instead.
+//
+// InitScripts lists SysV init scripts to install under /etc/init.d with mode
+// 0755. postinst registers them with update-rc.d and starts them, prerm stops
+// them, and postrm unregisters them when the package is purged. Like other
+// files in /etc, init scripts are conffiles. Units and init scripts installed
+// some other way are reported by Warnings() if there is no postinst.
+//
+// Owners maps install paths to the user and group that should own them, like
+// "svc:svc" or "1000:1000". Files are owned by root otherwise. A numeric id is
+// used as-is. A name is looked up by dpkg when the package is unpacked, and if
+// that user or group does not exist yet, for example because it is created by
+// postinst, dpkg falls back to root. In that case postinst should chown the
+// file after creating the user.
+//
+//	"owners": {
+//	    "/var/lib/svc": "svc:svc"
+//	}
+//
+// Checksums maps source files to their expected sha256 checksum. Build fails if
+// any of these files does not match, or is not part of the package.
+//
+// Sha256Sums adds a sha256sums file to the control archive, which lists the
+// sha256 checksum of each file in the package in the same format as md5sums.
+// md5sums is always included since dpkg uses it.
+//
+// InMemory builds the control and data archives in memory instead of writing
+// them to TempPath before copying them into the .deb. This avoids disk I/O, but
+// the compressed package has to fit in memory, so it is best suited to small
+// and medium sized packages.
+//
+// IgnoreFileModes replaces the permissions of files in the package with 0644,
+// or 0755 for directories and executables, instead of using the permissions
+// from the filesystem. Use this if you are building on a filesystem without
+// Unix permissions. This is always enabled on Windows.
+//
+// Force allows Build to overwrite a package file that already exists in the
+// target directory. By default Build refuses to replace an existing package.
+//
+// TemplateScripts renders control scripts with text/template using the
+// PackageSpec as data, so a script may refer to {{.Package}} or {{.Version}}.
+// This is disabled by default since shell scripts may legitimately contain {{.
+//
 // Derived Fields
 //
 // InstalledSize is calculated based on the total size of your files and control
@@ -155,14 +537,25 @@ type PackageSpec struct {
 	Description  string `json:"description"`
 
 	// Optional Fields
-	Depends    []string `json:"depends"`
-	PreDepends []string `json:"preDepends"`
-	Conflicts  []string `json:"conflicts,omitempty"`
-	Breaks     []string `json:"breaks,omitempty"`
-	Replaces   []string `json:"replaces,omitempty"`
-	Section    string   `json:"section"`  // Defaults to "default"
-	Priority   string   `json:"priority"` // Defaults to "extra"
-	Homepage   string   `json:"homepage"`
+	Depends     []string          `json:"depends"`
+	PreDepends  []string          `json:"preDepends"`
+	Conflicts   []string          `json:"conflicts,omitempty"`
+	Breaks      []string          `json:"breaks,omitempty"`
+	Replaces    []string          `json:"replaces,omitempty"`
+	BuiltUsing  []string          `json:"builtUsing,omitempty"`
+	Section     string            `json:"section"`  // Defaults to "misc"
+	Priority    string            `json:"priority"` // Defaults to "optional" or "extra"
+	Homepage    string            `json:"homepage"`
+	VcsGit      string            `json:"vcsGit,omitempty"`
+	VcsBrowser  string            `json:"vcsBrowser,omitempty"`
+	Origin      string            `json:"origin,omitempty"`
+	Bugs        string            `json:"bugs,omitempty"`
+	Essential   bool              `json:"essential,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	ExtraFields map[string]string `json:"extraFields,omitempty"`
+	MultiArch   string            `json:"multiArch,omitempty"`
+	Testsuite   string            `json:"testsuite,omitempty"`
+	Date        string            `json:"date,omitempty"`
 
 	// Control Scripts
 	Preinst  string `json:"preinst"`
@@ -171,29 +564,107 @@ type PackageSpec struct {
 	Postrm   string `json:"postrm"`
 
 	// Build time options
-	AutoPath         string            `json:"autoPath"` // Defaults to "deb-pkg"
-	Files            map[string]string `json:"files"`
-	TempPath         string            `json:"tempPath,omitempty"`
-	PreserveSymlinks bool              `json:"preserveSymlinks,omitempty"`
-	UpgradeConfigs   bool              `json:"upgradeConfigs,omitempty"`
+	Architectures             []string          `json:"architectures,omitempty"`
+	Extends                   string            `json:"extends,omitempty"`
+	ExtraRootDirs             []string          `json:"extraRootDirs,omitempty"`
+	AllowWorldWritable        []string          `json:"allowWorldWritable,omitempty"`
+	AutoPath                  string            `json:"autoPath"` // Defaults to "deb-pkg"
+	RootTree                  bool              `json:"rootTree,omitempty"`
+	Prefix                    string            `json:"prefix,omitempty"`
+	FilenameTemplate          string            `json:"filenameTemplate,omitempty"`
+	Files                     map[string]string `json:"files"`
+	RemoteFiles               map[string]string `json:"remoteFiles,omitempty"`
+	FromArchive               string            `json:"fromArchive,omitempty"`
+	ArchiveFiles              map[string]string `json:"archiveFiles,omitempty"`
+	TempPath                  string            `json:"tempPath,omitempty"`
+	ChecksumCache             bool              `json:"checksumCache,omitempty"`
+	PreserveSymlinks          bool              `json:"preserveSymlinks,omitempty"`
+	Conffiles                 []string          `json:"conffiles,omitempty"`
+	UpgradeConfigs            bool              `json:"upgradeConfigs,omitempty"`
+	PreserveConfigs           []string          `json:"preserveConfigs,omitempty"`
+	TemplateScripts           bool              `json:"templateScripts,omitempty"`
+	SplitDebug                bool              `json:"splitDebug,omitempty"`
+	DebugExtension            string            `json:"debugExtension,omitempty"`
+	Exclude                   []string          `json:"exclude,omitempty"`
+	NoDefaultExcludes         bool              `json:"noDefaultExcludes,omitempty"`
+	FollowDirSymlinks         bool              `json:"followDirSymlinks,omitempty"`
+	CaseInsensitiveDuplicates bool              `json:"caseInsensitiveDuplicates,omitempty"`
+	CompressOver              int               `json:"compressOver,omitempty"`
+	CompressExtensions        []string          `json:"compressExtensions,omitempty"`
+	TarFormat                 string            `json:"tarFormat,omitempty"`     // Defaults to "pax"
+	FormatVersion             string            `json:"formatVersion,omitempty"` // Defaults to "2.0"
+	BuildTime                 time.Time         `json:"-"`
+	ClampMTime                bool              `json:"clampMTime,omitempty"`
+	GitMTime                  bool              `json:"gitMTime,omitempty"`
+	BuildInfo                 bool              `json:"buildInfo,omitempty"`
+	Verify                    bool              `json:"verify,omitempty"`
+	PreBuild                  []string          `json:"preBuild,omitempty"`
+	PostBuild                 []string          `json:"postBuild,omitempty"`
+	Alternatives              []Alternative     `json:"alternatives,omitempty"`
+	SystemdUnits              []string          `json:"systemdUnits,omitempty"`
+	InitScripts               []string          `json:"initScripts,omitempty"`
+	Owners                    map[string]string `json:"owners,omitempty"`
+	Checksums                 map[string]string `json:"checksums,omitempty"`
+	Sha256Sums                bool              `json:"sha256Sums,omitempty"`
+	InMemory                  bool              `json:"inMemory,omitempty"`
+	IgnoreFileModes           bool              `json:"ignoreFileModes,omitempty"`
+	KeepIntermediate          bool              `json:"keepIntermediate,omitempty"`
+	ControlCompression        string            `json:"controlCompression,omitempty"` // Defaults to "gzip"
+	DataCompression           string            `json:"dataCompression,omitempty"`    // Defaults to "gzip"
+	Force                     bool              `json:"-"`
 
 	// Derived fields
 	InstalledSize int64 `json:"-"` // Kilobytes, rounded up. Derived from file sizes.
+
+	// FS is used to read source files instead of the local filesystem, if set.
+	// This allows building a package from an embedded or in-memory filesystem.
+	FS fs.FS `json:"-"`
+
+	// Logger receives structured events for each phase of Build, like
+	// validation and archive creation, including file counts and durations.
+	// Nothing is logged if this is nil.
+	Logger *slog.Logger `json:"-"`
+
+	// extension replaces deb at the end of Filename. This is set from
+	// DebugExtension for the -dbgsym package.
+	extension string
+
+	// strippedFiles maps source files to copies with debug information
+	// removed. This is populated during Build when SplitDebug is enabled.
+	strippedFiles map[string]string
+
+	// compressedFiles maps source files to gzipped copies. This is populated
+	// during Build when CompressOver is set.
+	compressedFiles map[string]string
+
+	// checksumCache holds cached checksums of source files. This is open
+	// during Build when ChecksumCache is set.
+	checksumCache *checksumCache
+
+	// fetchedFiles maps the local path of each downloaded RemoteFiles entry
+	// to its URL. This is populated by FetchRemoteFiles.
+	fetchedFiles map[string]string
+
+	// embeddedScripts holds control scripts added with SetControlScript
+	embeddedScripts map[string]embeddedScript
+
+	// defaultedPriority is set when Priority was not specified in the config,
+	// so we only warn about extra when the user chose it.
+	defaultedPriority bool
 }
 
 // DefaultPackageSpec includes default values for package specifications. This
 // simplifies configuration so a user need only specify required fields to build
 func DefaultPackageSpec() *PackageSpec {
 	return &PackageSpec{
-		Section:   "default",
-		Priority:  "extra",
-		AutoPath:  "deb-pkg",
-		PreDepends:   make([]string, 0),
-		Depends:   make([]string, 0),
-		Conflicts: make([]string, 0),
-		Breaks:    make([]string, 0),
-		Replaces:  make([]string, 0),
-		Files:     make(map[string]string, 0),
+		Section:    "misc",
+		AutoPath:   "deb-pkg",
+		PreDepends: make([]string, 0),
+		Depends:    make([]string, 0),
+		Conflicts:  make([]string, 0),
+		Breaks:     make([]string, 0),
+		Replaces:   make([]string, 0),
+		Files:      make(map[string]string, 0),
 	}
 }
 
@@ -204,82 +675,422 @@ func NewPackageSpecFromJSON(data []byte) (*PackageSpec, error) {
 	if err != nil {
 		return nil, err
 	}
+	p.applyDefaultPriority()
 	return p, nil
 }
 
-// NewPackageSpecFromFile creates a PackageSpec from a JSON file
+// applyDefaultPriority sets Priority if it was not specified. Policy
+// deprecates extra, so packages in a standard section get optional. Packages in
+// a non-standard section keep the old default of extra.
+func (p *PackageSpec) applyDefaultPriority() {
+	if p.Priority != "" {
+		return
+	}
+	p.defaultedPriority = true
+	if hasString(sections, path.Base(p.Section)) {
+		p.Priority = "optional"
+	} else {
+		p.Priority = "extra"
+	}
+}
+
+// NewPackageSpecFromFile creates a PackageSpec from a JSON file. If the file
+// sets Extends the config it points to is loaded and merged (see MergeSpecs).
 func NewPackageSpecFromFile(filename string) (*PackageSpec, error) {
-	file, err := os.Open(filename)
+	return loadSpecFile(filename, map[string]bool{})
+}
+
+// Save writes the PackageSpec to filename as JSON. The file is written to a
+// temporary file first and then renamed so an existing config is never left
+// partially written.
+func (p *PackageSpec) Save(filename string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
 	if err != nil {
-		return nil, err
+		return err
 	}
-	data, err := ioutil.ReadAll(file)
+
+	file, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename))
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("Failed to save %s: %s", filename, err)
+	}
+	defer os.Remove(file.Name()) // Fails harmlessly after a successful rename
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("Failed to save %s: %s", filename, err)
 	}
-	return NewPackageSpecFromJSON(data)
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("Failed to save %s: %s", filename, err)
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		return fmt.Errorf("Failed to save %s: %s", filename, err)
+	}
+	if err := os.Rename(file.Name(), filename); err != nil {
+		return fmt.Errorf("Failed to save %s: %s", filename, err)
+	}
+	return nil
 }
 
 // Validate checks the syntax of various text fields in PackageSpec to verify
 // that they conform to the debian package specification. Errors from this call
 // should be passed to the user so they can fix errors in their config file.
 func (p *PackageSpec) Validate(buildTime bool) error {
+	// Relationships are normalized when the control file is rendered, so
+	// check them the same way without changing p
+	preDepends := normalizeRelations(p.PreDepends)
+	depends := normalizeRelations(p.Depends)
+	conflicts := normalizeRelations(p.Conflicts)
+	breaks := normalizeRelations(p.Breaks)
+	replaces := normalizeRelations(p.Replaces)
+	builtUsing := normalizeRelations(p.BuiltUsing)
+
+	errs := ValidationErrors{}
+	invalid := func(field, value, format string, args ...interface{}) {
+		errs = append(errs, ValidationError{Field: field, Value: value, Message: fmt.Sprintf(format, args...)})
+	}
+
 	// Verify required fields are specified
-	missing := []string{}
-	if p.Package == "" {
-		missing = append(missing, "package")
+	missing := func(field string) {
+		errs = append(errs, ValidationError{Field: field, Missing: true, Message: fmt.Sprintf("%s is missing", field)})
+	}
+	for _, field := range controlFields {
+		switch {
+		case !field.Required:
+		case field.Config == "version" && !buildTime:
+			// Version is set when building rather than in the config file
+		case field.Config == "architecture" && len(p.Architectures) > 0:
+		case field.value(p) == "":
+			missing(field.Config)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if !rePackageName.MatchString(p.Package) {
+		invalid("package", p.Package, "Package name %q is invalid; expected at least two lowercase letters, digits, or .+- starting with a letter or digit, matching %q", p.Package, rePackageName.String())
+	}
+	if buildTime && !reVersion.MatchString(p.Version) {
+		invalid("version", p.Version, "Version %q is invalid; expected something like '1.2.3' or '2:1.0-1' matching %q", p.Version, reVersion.String())
+	}
+	if p.FormatVersion != "" && !reFormatVersion.MatchString(p.FormatVersion) {
+		invalid("formatVersion", p.FormatVersion, "Format version %q is invalid; expected something like '2.0' matching %q", p.FormatVersion, reFormatVersion.String())
+	}
+	if err := validateCompression("Control compression", p.ControlCompression); err != nil {
+		invalid("controlCompression", p.ControlCompression, "%s", err)
+	}
+	if err := validateCompression("Data compression", p.DataCompression); err != nil {
+		invalid("dataCompression", p.DataCompression, "%s", err)
+	}
+	for _, config := range p.PreserveConfigs {
+		if !strings.HasPrefix(path.Join(".", toSlash(config)), "etc/") {
+			invalid("preserveConfigs", config, "Preserved config %q is not under /etc; add it to conffiles instead", config)
+		}
+	}
+	if p.CompressOver < 0 {
+		invalid("compressOver", fmt.Sprint(p.CompressOver), "Compress over must be a size in bytes, or 0 to disable compression")
+	}
+	if err := p.validateCompressExtensions(); err != nil {
+		invalid("compressExtensions", strings.Join(p.CompressExtensions, ", "), "%s", err)
+	}
+	if p.TarFormat != "" && !hasString(tarFormats, p.TarFormat) {
+		invalid("tarFormat", p.TarFormat, "Tar format %q is invalid; expected one of %s", p.TarFormat, strings.Join(tarFormats, ", "))
+	}
+	if p.DebugExtension != "" && p.DebugExtension != "deb" && p.DebugExtension != "ddeb" {
+		invalid("debugExtension", p.DebugExtension, "Debug extension %q is invalid; expected deb or ddeb", p.DebugExtension)
+	}
+	for _, source := range builtUsing {
+		if !reBuiltUsing.MatchString(source) {
+			invalid("builtUsing", source, "Built-Using %q is invalid; expected a source package and exact version like 'gcc-10 (= 10.2.1-6)' matching %q", source, reBuiltUsing.String())
+		}
+	}
+	for _, name := range p.extraFieldNames() {
+		if err := validateExtraField(name, p.ExtraFields[name]); err != nil {
+			invalid("extraFields", name, "%s", err)
+		}
+	}
+	for _, tag := range p.Tags {
+		if !reTag.MatchString(tag) {
+			invalid("tags", tag, "Tag %q is invalid; expected facet::value like 'role::program'", tag)
+		}
 	}
-	if buildTime && p.Version == "" {
-		missing = append(missing, "version")
+	if p.MultiArch != "" && !hasString(multiArchValues, p.MultiArch) {
+		invalid("multiArch", p.MultiArch, "Multi-Arch %q is invalid; expected one of %s", p.MultiArch, strings.Join(multiArchValues, ", "))
 	}
-	if p.Architecture == "" {
-		missing = append(missing, "architecture")
+	if p.MultiArch == "same" && p.Architecture == "all" {
+		invalid("multiArch", p.MultiArch, "Multi-Arch: same is not allowed for architecture all")
 	}
-	if p.Maintainer == "" {
-		missing = append(missing, "maintainer")
+	for _, suite := range splitList(p.Testsuite) {
+		if !hasString(testsuites, suite) {
+			invalid("testsuite", suite, "Testsuite %q is invalid; expected one of %s", suite, strings.Join(testsuites, ", "))
+		}
+	}
+	for _, alternative := range p.Alternatives {
+		if err := alternative.validate(); err != nil {
+			invalid("alternatives", alternative.Link, "%s", err)
+		}
+	}
+	for _, unit := range p.SystemdUnits {
+		if err := validateSystemdUnit(unit); err != nil {
+			invalid("systemdUnits", unit, "%s", err)
+		}
+	}
+	for _, script := range p.InitScripts {
+		if err := validateInitScript(script); err != nil {
+			invalid("initScripts", script, "%s", err)
+		}
+	}
+	for dest, spec := range p.Owners {
+		if _, err := parseOwner(spec); err != nil {
+			invalid("owners", spec, "%s for %s", err, dest)
+		}
 	}
-	if p.Description == "" {
-		missing = append(missing, "description")
+	if p.Date != "" {
+		if _, err := parseDate(p.Date); err != nil {
+			invalid("date", p.Date, "Date %q is invalid; expected RFC 2822 format like %q", p.Date, time.RFC1123Z)
+		}
+	}
+	if p.FilenameTemplate != "" {
+		if _, err := p.renderFilename(); err != nil {
+			invalid("filenameTemplate", p.FilenameTemplate, "%s", err)
+		}
 	}
-	if len(missing) > 0 {
-		return fmt.Errorf("These required fields are missing: %s", strings.Join(missing, ", "))
+	if p.Priority != "" && !hasString(priorities, p.Priority) {
+		invalid("priority", p.Priority, "Priority %q is invalid; expected one of %s",
+			p.Priority, strings.Join(priorities, ", "))
 	}
-	if !hasString(supportedArchitectures, p.Architecture) {
-		return fmt.Errorf("Arch %q is not supported; expected one of %s",
-			p.Architecture, strings.Join(supportedArchitectures, ", "))
+	if len(p.ArchiveFiles) > 0 && p.FromArchive == "" {
+		invalid("fromArchive", "", "archiveFiles requires fromArchive to be specified")
 	}
-	for _, dep := range p.Depends {
+	for url := range p.RemoteFiles {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			invalid("remoteFiles", url, "Remote file %q is invalid; expected an http:// or https:// URL", url)
+		}
+	}
+	archField, archs := "architecture", []string{p.Architecture}
+	if len(p.Architectures) > 0 {
+		archField, archs = "architectures", p.Architectures
+	}
+	for _, arch := range archs {
+		if !hasString(supportedArchitectures, arch) {
+			invalid(archField, arch, "Arch %q is not supported; expected one of %s",
+				arch, strings.Join(supportedArchitectures, ", "))
+		}
+	}
+	for _, dep := range depends {
 		if !reDepends.MatchString(dep) {
-			return fmt.Errorf("Dependency %q is invalid; expected something like 'libc (= 5.1.2)' matching %q", dep, reDepends.String())
+			invalid("depends", dep, "Dependency %q is invalid; expected something like 'libc (= 5.1.2)' matching %q", dep, reDepends.String())
 		}
 	}
-	for _, dep := range p.PreDepends {
+	for _, dep := range preDepends {
 		if !reDepends.MatchString(dep) {
-			return fmt.Errorf("PreDependency %q is invalid; expected something like 'libc (= 5.1.2)' matching %q", dep, reDepends.String())
+			invalid("preDepends", dep, "PreDependency %q is invalid; expected something like 'libc (= 5.1.2)' matching %q", dep, reDepends.String())
 		}
 	}
-	for _, replace := range p.Replaces {
+	for _, dep := range depends {
+		if dependencyName(dep) == p.Package {
+			invalid("depends", dep, "Package %q must not depend on itself", p.Package)
+		}
+	}
+	for _, dep := range preDepends {
+		if dependencyName(dep) == p.Package {
+			invalid("preDepends", dep, "Package %q must not pre-depend on itself", p.Package)
+		}
+	}
+	for _, replace := range replaces {
 		if !reReplacesEtc.MatchString(replace) {
-			return fmt.Errorf("Replacement %q is invalid; expected something like 'libc (<< 5.1.2)' matching %q", replace, reReplacesEtc.String())
+			invalid("replaces", replace, "Replacement %q is invalid; expected something like 'libc (<< 5.1.2)' matching %q", replace, reReplacesEtc.String())
 		}
 	}
-	for _, conflict := range p.Conflicts {
+	for _, conflict := range conflicts {
 		if !reReplacesEtc.MatchString(conflict) {
-			return fmt.Errorf("Conflict %q is invalid; expected something like 'libc (<< 5.1.2)' matching %q", conflict, reReplacesEtc.String())
+			invalid("conflicts", conflict, "Conflict %q is invalid; expected something like 'libc (<< 5.1.2)' matching %q", conflict, reReplacesEtc.String())
 		}
 	}
-	for _, breaks := range p.Breaks {
-		if !reReplacesEtc.MatchString(breaks) {
-			return fmt.Errorf("Break %q is invalid; expected something like 'libc (<< 5.1.2)' matching %q", breaks, reReplacesEtc.String())
+	for _, brk := range breaks {
+		if !reReplacesEtc.MatchString(brk) {
+			invalid("breaks", brk, "Break %q is invalid; expected something like 'libc (<< 5.1.2)' matching %q", brk, reReplacesEtc.String())
 		}
 	}
+
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
+// dependencyName returns the package name from a dependency like
+// "libc6 (>= 2.3)" or "python3:any"
+func dependencyName(dep string) string {
+	name := strings.TrimSpace(dep)
+	if i := strings.IndexAny(name, " ("); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.Index(name, ":"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// Warnings checks PackageSpec for problems that will not prevent the package
+// from being built or installed but are likely to cause trouble with other
+// tooling, such as lintian. Warnings should be shown to the user, but unlike
+// errors from Validate they are not fatal.
+func (p *PackageSpec) Warnings() []string {
+	warnings := []string{}
+	if p.Maintainer != "" && !reMaintainer.MatchString(p.Maintainer) {
+		warnings = append(warnings, fmt.Sprintf("Maintainer %q should be in the form 'Your Name <you@example.com>'", p.Maintainer))
+	}
+	if p.Section != "" && !hasString(sections, path.Base(p.Section)) {
+		warnings = append(warnings, fmt.Sprintf("Section %q is not a standard debian section; consider using one like 'misc' or 'utils'", p.Section))
+	}
+
+	// Control scripts are always written with mode 0755 so we don't need to
+	// check the execute bit, but without a shebang they will fail to run.
+	for name, script := range p.MapControlFiles() {
+		data, err := p.readControlScript(name, script)
+		if err != nil {
+			// This will be reported when we try to build the package
+			continue
+		}
+		if !bytes.HasPrefix(data, []byte("#!")) {
+			warnings = append(warnings, fmt.Sprintf("Control script %s (%s) does not start with a shebang like #!/bin/sh", name, script))
+		}
+	}
+
+	if p.Priority == "extra" && !p.defaultedPriority {
+		warnings = append(warnings, `Priority "extra" is deprecated; use "optional" instead`)
+	}
+
+	// Replacing files from a package that can still be installed alongside
+	// this one will cause problems when that package is upgraded
+	for _, replace := range p.Replaces {
+		name := dependencyName(replace)
+		if !hasDependency(p.Conflicts, name) && !hasDependency(p.Breaks, name) {
+			warnings = append(warnings, fmt.Sprintf("Package replaces %q but does not list it in conflicts or breaks; add it to breaks if this package takes over some of its files, or to conflicts if it replaces the whole package", name))
+		}
+	}
+
+	warnings = append(warnings, p.synopsisWarnings()...)
+	warnings = append(warnings, p.rootDirWarnings()...)
+	warnings = append(warnings, p.worldWritableWarnings()...)
+	warnings = append(warnings, p.multiArchWarnings()...)
+	warnings = append(warnings, p.serviceWarnings()...)
+	return warnings
+}
+
+// worldWritableWarnings warns about files in the package that anyone can
+// modify, which is almost never intended and is flagged by lintian
+func (p *PackageSpec) worldWritableWarnings() []string {
+	if p.ignoreFileModes() {
+		return nil
+	}
+	files, err := p.ListFiles(false)
+	if err != nil {
+		// This will be reported when we try to build the package
+		return nil
+	}
+
+	warnings := []string{}
+	for _, file := range files {
+		var fileinfo os.FileInfo
+		if p.PreserveSymlinks {
+			fileinfo, err = p.lstat(file)
+		} else {
+			fileinfo, err = p.stat(file)
+		}
+		if err != nil || fileinfo.Mode()&os.ModeSymlink != 0 || fileinfo.Mode().Perm()&0002 == 0 {
+			continue
+		}
+		target, err := p.NormalizeFilename(file)
+		if err != nil || hasString(p.AllowWorldWritable, "/"+target) {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("File /%s is world-writable (mode %#o); fix its permissions or add it to allowWorldWritable if this is intended", target, fileinfo.Mode().Perm()))
+	}
+	return warnings
+}
+
+// hasDependency returns true if one of deps refers to the package name
+func hasDependency(deps []string, name string) bool {
+	for _, dep := range deps {
+		if dependencyName(dep) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// rootDirWarnings warns about files that will be installed outside of the
+// standard FHS directories, which usually means there is a typo like /user/bin
+// in the config.
+func (p *PackageSpec) rootDirWarnings() []string {
+	targets, err := p.ListArchivePaths()
+	if err != nil {
+		// This will be reported when we try to build the package
+		return nil
+	}
+
+	// Only warn once for each directory
+	examples := map[string]string{}
+	for _, target := range targets {
+		dir := strings.SplitN(target, "/", 2)[0]
+		if hasString(rootDirs, dir) || hasString(p.ExtraRootDirs, dir) {
+			continue
+		}
+		if example, ok := examples[dir]; !ok || target < example {
+			examples[dir] = target
+		}
+	}
+
+	dirs := []string{}
+	for dir := range examples {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	warnings := []string{}
+	for _, dir := range dirs {
+		warnings = append(warnings, fmt.Sprintf("Files like /%s are installed under /%s, which is not a standard FHS directory; add %q to extraRootDirs if this is intended", examples[dir], dir, dir))
+	}
+	return warnings
+}
+
 // Filename derives the standard debian filename as package-version-arch.deb
-// based on the data specified in PackageSpec.
+// based on the data specified in PackageSpec. If FilenameTemplate is set it is
+// used instead, unless it fails to render.
 func (p *PackageSpec) Filename() string {
-	return fmt.Sprintf("%s-%s-%s.deb", p.Package, p.Version, p.Architecture)
+	if p.FilenameTemplate != "" {
+		if filename, err := p.renderFilename(); err == nil {
+			return filename
+		}
+	}
+	extension := "deb"
+	if p.extension != "" {
+		extension = p.extension
+	}
+	return fmt.Sprintf("%s-%s-%s.%s", p.Package, p.Version, p.Architecture, extension)
+}
+
+// renderFilename renders FilenameTemplate and checks that the result is a
+// usable .deb filename
+func (p *PackageSpec) renderFilename() (string, error) {
+	t, err := template.New("filename").Parse(p.FilenameTemplate)
+	if err != nil {
+		return "", fmt.Errorf("Failed parsing filename template: %s", err)
+	}
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, p); err != nil {
+		return "", fmt.Errorf("Failed rendering filename template: %s", err)
+	}
+	filename := buf.String()
+	if !strings.HasSuffix(filename, ".deb") || filename == ".deb" {
+		return "", fmt.Errorf("Filename template rendered %q; expected a name ending in .deb", filename)
+	}
+	if strings.ContainsAny(filename, `/\`) {
+		return "", fmt.Errorf("Filename template rendered %q; expected a name without directories", filename)
+	}
+	return filename, nil
 }
 
 // Build creates a .deb file in the target directory. The name is defived from
@@ -287,94 +1098,353 @@ func (p *PackageSpec) Filename() string {
 //
 //	path.Join(target, PackageSpec.Filename())
 func (p *PackageSpec) Build(target string) error {
+	_, err := p.BuildWithStats(target)
+	return err
+}
+
+// BuildStats records how long each phase of a build took. The control and data
+// archives are created in parallel, so their durations may add up to more than
+// the time it took to build the package.
+type BuildStats struct {
+	ControlArchive time.Duration
+	DataArchive    time.Duration
+	Assembly       time.Duration // Writing the .deb (ar) file
+}
+
+// add adds the durations in other to s
+func (s *BuildStats) add(other *BuildStats) {
+	s.ControlArchive += other.ControlArchive
+	s.DataArchive += other.DataArchive
+	s.Assembly += other.Assembly
+}
+
+// BuildWithStats works like Build, and also reports how long each phase of the
+// build took. If Architectures is set the durations are the totals for all of
+// the packages.
+func (p *PackageSpec) BuildWithStats(target string) (*BuildStats, error) {
+	stats := &BuildStats{}
+	logger := p.logger()
+
+	start := time.Now()
 	err := p.Validate(true)
 	if err != nil {
-		return err
+		logger.Error("validation failed", "error", err)
+		return nil, err
 	}
+	logger.Info("validated package", "version", p.Version, "duration", time.Since(start))
+
+	// Build a separate package for each architecture
+	if len(p.Architectures) > 0 {
+		packages, err := p.Packages()
+		if err != nil {
+			return nil, err
+		}
+		for _, pkg := range packages {
+			pkgStats, err := pkg.BuildWithStats(target)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to build %s for %s: %s", pkg.Package, pkg.Architecture, err)
+			}
+			stats.add(pkgStats)
+		}
+		return stats, nil
+	}
+
+	// Don't clobber a package we built earlier unless we're asked to
+	output := path.Join(target, p.Filename())
+	if !p.Force && FileExists(output) {
+		return nil, fmt.Errorf("%s already exists; remove it or use force to overwrite it", output)
+	}
+
+	// Use the same timestamp for everything in this build
+	if p.BuildTime.IsZero() {
+		p.BuildTime = p.buildTime()
+		defer func() { p.BuildTime = time.Time{} }()
+	}
+
 	ws, err := ioutil.TempDir(p.TempPath, "mkdeb")
 	if err != nil {
-		return fmt.Errorf("Could not create build workspace: %v", err)
+		return nil, fmt.Errorf("Could not create build workspace: %v", err)
 	}
 	defer func() {
+		p.fetchedFiles = nil
+		p.strippedFiles = nil
+		p.compressedFiles = nil
+		if p.KeepIntermediate {
+			log.Printf("Intermediate files were kept in %s", ws)
+			return
+		}
 		err := os.RemoveAll(ws) // clean up
 		if err != nil {
 			log.Printf("Error cleaning up build workspace '%v': %v", ws, err)
 		}
 	}()
 
-	// 1. Create binary package (tar.gz format)
-	// 2. Create control file package (tar.gz format)
+	if err := p.FetchRemoteFiles(ws); err != nil {
+		return nil, err
+	}
+	if err := p.VerifyChecksums(); err != nil {
+		return nil, err
+	}
+
+	// An empty package is almost certainly a configuration mistake
+	start = time.Now()
+	files, err := p.ListFiles(false)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("listed files", "files", len(files), "archiveFiles", len(p.ArchiveFiles), "duration", time.Since(start))
+	if len(files) == 0 && len(p.ArchiveFiles) == 0 && len(p.MapControlFiles()) == 0 {
+		return nil, fmt.Errorf("Package has no files to install; set autoPath to a directory containing your files or list them in files")
+	}
+
+	var dbgsym *PackageSpec
+	if p.SplitDebug {
+		if dbgsym, err = p.splitDebugInfo(ws); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.compressFiles(ws); err != nil {
+		return nil, err
+	}
+
+	if p.ChecksumCache {
+		p.openChecksumCache()
+		defer p.closeChecksumCache()
+	}
+
+	// 1. Create binary package (tar.gz or tar.xz format)
+	// 2. Create control file package (tar.gz or tar.xz format)
 	// 3. Create .deb / package (ar archive format)
 
+	start = time.Now()
+	var writeMembers func(archive *ar.Writer, header ar.Header) error
+	if p.InMemory {
+		control := &bytes.Buffer{}
+		data := &bytes.Buffer{}
+		if err := p.writeArchives(control, data, stats); err != nil {
+			return nil, err
+		}
+		writeMembers = func(archive *ar.Writer, header ar.Header) error {
+			if err := writeBytesToAr(archive, header, p.ControlArchiveName(), control.Bytes()); err != nil {
+				return err
+			}
+			return writeBytesToAr(archive, header, p.DataArchiveName(), data.Bytes())
+		}
+	} else {
+		controlFile := filepath.Join(ws, p.ControlArchiveName())
+		dataFile := filepath.Join(ws, p.DataArchiveName())
+		if err := p.createArchives(controlFile, dataFile, stats); err != nil {
+			return nil, err
+		}
+		writeMembers = func(archive *ar.Writer, header ar.Header) error {
+			if err := writeFileToAr(archive, header, p.ControlArchiveName(), controlFile); err != nil {
+				return err
+			}
+			return writeFileToAr(archive, header, p.DataArchiveName(), dataFile)
+		}
+	}
+	logger.Info("created archives", "control", p.ControlArchiveName(), "data", p.DataArchiveName(), "inMemory", p.InMemory, "duration", time.Since(start))
+
+	start = time.Now()
+
 	err = os.MkdirAll(target, 0755)
 	if err != nil {
-		return fmt.Errorf("Unable to create target directory %q: %s", target, err)
+		return nil, fmt.Errorf("Unable to create target directory %q: %s", target, err)
 	}
 
-	file, err := os.Create(path.Join(target, p.Filename()))
+	file, err := os.Create(output)
 	if err != nil {
-		return fmt.Errorf("Failed to create build target: %s", err)
+		return nil, fmt.Errorf("Failed to create build target: %s", err)
 	}
 
 	archive := ar.NewWriter(file)
 
-	archiveCreationTime := time.Now()
-
 	baseHeader := ar.Header{
-		ModTime: archiveCreationTime,
+		ModTime: p.buildTime(),
 		Uid:     0,
 		Gid:     0,
-		Mode:    0600,
+		Mode:    0644, // Matches dpkg-deb
 	}
 
-	// Write the debian binary version (hard-coded to 2.0)
-	if err := writeBytesToAr(archive, baseHeader, "debian-binary", []byte("2.0\n")); err != nil {
-		return fmt.Errorf("Failed to write debian-binary: %s", err)
+	// Write the debian binary version
+	formatVersion := p.FormatVersion
+	if formatVersion == "" {
+		formatVersion = "2.0"
+	}
+	if err := writeBytesToAr(archive, baseHeader, "debian-binary", []byte(formatVersion+"\n")); err != nil {
+		return nil, fmt.Errorf("Failed to write debian-binary: %s", err)
 	}
 
-	controlFile := filepath.Join(ws, "control.tar.gz")
-	if err := p.CreateControlArchive(controlFile); err != nil {
-		return fmt.Errorf("Failed to compress control files: %s", err)
+	// Copy the control file and data archives into ar (.deb)
+	if err := writeMembers(archive, baseHeader); err != nil {
+		return nil, err
 	}
 
-	// Copy the control file archive into ar (.deb)
-	if err := writeFileToAr(archive, baseHeader, controlFile); err != nil {
-		return err
+	if err := archive.Close(); err != nil {
+		return nil, err
 	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	stats.Assembly = time.Since(start)
+	logger.Info("assembled package", "output", output, "duration", stats.Assembly)
 
-	dataFile := filepath.Join(ws, "data.tar.gz")
-	if err := p.CreateDataArchive(dataFile); err != nil {
-		return fmt.Errorf("Failed to compress data files: %s", err)
+	if p.Verify {
+		if err := verifyPackage(output); err != nil {
+			// Don't leave a broken package where it might be published
+			os.Remove(output)
+			return nil, fmt.Errorf("Package verification failed: %s", err)
+		}
+		logger.Info("verified package", "output", output)
 	}
 
-	// Copy the data archive into the ar (.deb)
-	if err := writeFileToAr(archive, baseHeader, dataFile); err != nil {
-		return err
+	if dbgsym != nil {
+		if err := dbgsym.Build(target); err != nil {
+			return nil, fmt.Errorf("Failed to build %s: %s", dbgsym.Package, err)
+		}
 	}
+	return stats, nil
+}
 
-	if err := archive.Close(); err != nil {
-		return err
+// buildTime returns the timestamp used for files generated during the build.
+// See BuildTime.
+func (p *PackageSpec) buildTime() time.Time {
+	if p.BuildTime.IsZero() {
+		if date, err := parseDate(p.Date); err == nil {
+			return date
+		}
+		return time.Now()
 	}
-	if err := file.Close(); err != nil {
-		return err
+	return p.BuildTime
+}
+
+// parseDate parses an RFC 2822 date like "Wed, 01 May 2024 12:00:00 +0000".
+// Unlike time.RFC1123Z this accepts a day of the month with a single digit.
+func parseDate(date string) (time.Time, error) {
+	return time.Parse("Mon, 2 Jan 2006 15:04:05 -0700", date)
+}
+
+// HumanSize formats a size in KiB, like the one from CalculateSize, for
+// people to read. Sizes under 1 MiB are shown in whole KiB, and larger sizes
+// are shown in MiB, GiB, or TiB with one decimal place, e.g. "1.4 MiB".
+func HumanSize(kib int64) string {
+	if kib < 1024 {
+		return fmt.Sprintf("%d KiB", kib)
+	}
+	size := float64(kib) / 1024
+	units := []string{"MiB", "GiB", "TiB"}
+	for _, unit := range units[:len(units)-1] {
+		// Check the rounded size so 1023.96 MiB is shown as 1.0 GiB rather
+		// than 1024.0 MiB
+		if math.Round(size*10)/10 < 1024 {
+			return fmt.Sprintf("%.1f %s", size, unit)
+		}
+		size /= 1024
 	}
-	return nil
+	return fmt.Sprintf("%.1f %s", size, units[len(units)-1])
 }
 
-// RenderControlFile creates a debian control file for this package.
-func (p *PackageSpec) RenderControlFile() ([]byte, error) {
-	t, err := template.New("controlfile").Funcs(template.FuncMap{"join": join}).Parse(controlFileTemplate)
+// Summary describes a package that was built in target, including the number
+// of files, the installed size, and the size of the .deb file itself. Files
+// are counted from the package's data archive, so RemoteFiles are included,
+// but their size is not since they are removed once the build is done.
+func (p *PackageSpec) Summary(target string) (string, error) {
+	output := path.Join(target, p.Filename())
+	info, err := os.Stat(output)
 	if err != nil {
-		// This should only happen if the template itself is messed up, which
-		// means the code has an error (not a user error)
-		panic(err)
+		return "", fmt.Errorf("Failed to stat %s: %s", output, err)
 	}
-	buf := &bytes.Buffer{}
-	err = t.Execute(buf, p)
+
+	count := 0
+	_, err = walkPackage(output, func(member string, h *tar.Header, r io.Reader) error {
+		if strings.HasPrefix(member, "data.tar") && h.Typeflag != tar.TypeDir {
+			count++
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	return buf.Bytes(), nil
+
+	size, err := p.CalculateSize()
+	if err != nil {
+		return "", err
+	}
+
+	// Round the package size up to match the installed size
+	packageSize := (info.Size() + 1023) / 1024
+
+	return fmt.Sprintf("Built package %s (%d files, %s installed, %s package)", output, count, HumanSize(size), HumanSize(packageSize)), nil
+}
+
+// PackageChecksum returns the sha256 checksum and size in bytes of the .deb at
+// filename, for publishing it alongside the package.
+func PackageChecksum(filename string) (string, int64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, fmt.Errorf("Failed to read %s: %s", filename, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// createArchives creates the control and data archives in parallel. They are
+// independent of each other until they are written into the .deb, so there is
+// no reason to wait for one to finish before starting the other.
+func (p *PackageSpec) createArchives(controlFile, dataFile string, stats *BuildStats) error {
+	control, err := os.Create(controlFile)
+	if err != nil {
+		return fmt.Errorf("Failed to create control archive %q: %s", controlFile, err)
+	}
+	defer control.Close()
+	data, err := os.Create(dataFile)
+	if err != nil {
+		return fmt.Errorf("Failed to create data archive %q: %s", dataFile, err)
+	}
+	defer data.Close()
+
+	if err := p.writeArchives(control, data, stats); err != nil {
+		return err
+	}
+	if err := control.Close(); err != nil {
+		return err
+	}
+	return data.Close()
+}
+
+// writeArchives writes the control and data archives in parallel. See
+// createArchives.
+func (p *PackageSpec) writeArchives(control, data io.Writer, stats *BuildStats) error {
+	controlErr := make(chan error, 1)
+	go func() {
+		start := time.Now()
+		err := p.WriteControlArchive(control)
+		stats.ControlArchive = time.Since(start)
+		if err != nil {
+			controlErr <- fmt.Errorf("Failed to compress control files: %s", err)
+			return
+		}
+		controlErr <- nil
+	}()
+
+	var dataErr error
+	start := time.Now()
+	if err := p.WriteDataArchive(data); err != nil {
+		dataErr = fmt.Errorf("Failed to compress data files: %s", err)
+	}
+	stats.DataArchive = time.Since(start)
+
+	// Always wait for the control archive so we don't leave it running
+	if err := <-controlErr; err != nil {
+		return err
+	}
+	return dataErr
 }
 
 // ListFiles returns a list of files that will be included in the archive,
@@ -390,20 +1460,45 @@ func (p *PackageSpec) ListFiles(includeDirs bool) ([]string, error) {
 	// This is used to check for duplicates between AutoPath and the Files map.
 	targets := map[string]struct{}{}
 
+	// fileTargets maps targets that are files (not directories) to their source
+	// so we can detect when something else needs a file to be a directory.
+	fileTargets := map[string]string{}
+
+	// key is the form of a target used to compare it against other targets
+	key := func(target string) string {
+		if p.CaseInsensitiveDuplicates {
+			return strings.ToLower(target)
+		}
+		return target
+	}
+
 	// First, grab all the files in AutoPath that are not control files
-	if p.AutoPath != "" && p.AutoPath != "-" && FileExists(p.AutoPath) {
-		if err := filepath.Walk(p.AutoPath, func(filepath string, info os.FileInfo, err2 error) error {
+	if p.AutoPath != "" && p.AutoPath != "-" && p.exists(p.AutoPath) {
+		if err := p.walk(p.AutoPath, func(filepath string, info os.FileInfo, err2 error) error {
 			if err2 != nil {
 				return err2
 			}
 
+			// A root tree keeps its control files in DEBIAN
+			if p.RootTree && filepath == p.controlDir() {
+				return fs.SkipDir
+			}
+
+			// Skip VCS metadata, editor backups, etc.
+			if filepath != p.AutoPath && p.isExcluded(path.Base(filepath)) {
+				if info.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+
 			// Skip directories if instructed
 			if !includeDirs && info.IsDir() {
 				return nil
 			}
 
 			// Skip control files
-			if hasString(controlFiles, path.Base(filepath)) {
+			if !p.RootTree && hasString(controlFiles, path.Base(filepath)) {
 				return nil
 			}
 			files = append(files, filepath)
@@ -411,66 +1506,271 @@ func (p *PackageSpec) ListFiles(includeDirs bool) ([]string, error) {
 			if err != nil {
 				return err
 			}
-			if _, ok := targets[target]; ok {
+			if _, ok := targets[key(target)]; ok {
 				// This is an odd edge case; it should probably never happen
 				return fmt.Errorf("Duplicate file detected from AutoPath: %s", filepath)
 			}
-			targets[target] = struct{}{}
+			targets[key(target)] = struct{}{}
+			if !info.IsDir() {
+				fileTargets[key(target)] = filepath
+			}
 			return nil
 		}); err != nil {
 			return nil, err
 		}
 	}
 
-	for src := range p.Files {
-		target, err := p.NormalizeFilename(src)
+	for src := range p.fileMap() {
+		target, err := p.NormalizeFilename(src)
+		if err != nil {
+			return files, err
+		}
+		if _, ok := targets[key(target)]; ok {
+			// This indicates a conflict between Files and what we discovered
+			// automatically via AuthPath (configuration error)
+			return files, fmt.Errorf("Duplicate file detected from Files: %s", src)
+		}
+		targets[key(target)] = struct{}{}
+		fileTargets[key(target)] = src
+		files = append(files, src)
+	}
+
+	for member, dest := range p.ArchiveFiles {
+		target := p.targetPath(dest)
+		if _, ok := targets[key(target)]; ok {
+			return files, fmt.Errorf("Duplicate file detected from ArchiveFiles: %s", member)
+		}
+		targets[key(target)] = struct{}{}
+		fileTargets[key(target)] = member
+	}
+
+	for src, url := range p.fetchedFiles {
+		target, err := p.NormalizeFilename(src)
+		if err != nil {
+			return files, err
+		}
+		if _, ok := targets[key(target)]; ok {
+			return files, fmt.Errorf("Duplicate file detected from RemoteFiles: %s", url)
+		}
+		targets[key(target)] = struct{}{}
+		fileTargets[key(target)] = url
+		files = append(files, src)
+	}
+
+	// Check that no target is inside of a path that is packaged as a file, e.g.
+	// usr/bin/foo and usr/bin/foo/bar
+	sortedTargets := []string{}
+	for target := range targets {
+		sortedTargets = append(sortedTargets, target)
+	}
+	sort.Strings(sortedTargets)
+	for _, target := range sortedTargets {
+		for parent := path.Dir(target); parent != "." && parent != "/"; parent = path.Dir(parent) {
+			if src, ok := fileTargets[parent]; ok {
+				return files, fmt.Errorf("Conflicting files detected: %s is packaged as the file %s, but %s needs it to be a directory", src, parent, target)
+			}
+		}
+	}
+
+	if err := p.checkControlCollisions(files, fileTargets); err != nil {
+		return files, err
+	}
+
+	return files, nil
+}
+
+// checkControlCollisions makes sure data files can't be confused with control
+// files. A file installed at the top level can't be named like a member of
+// the control archive, e.g. /postinst, and a control script can't also be
+// packaged as a data file.
+func (p *PackageSpec) checkControlCollisions(files []string, fileTargets map[string]string) error {
+	for target, src := range fileTargets {
+		if hasString(reservedControlNames, strings.ToLower(target)) {
+			return fmt.Errorf("%s would be installed as /%s, which is reserved for the control archive; install it in a directory like /usr/share/%s instead", src, target, p.Package)
+		}
+	}
+
+	scripts := map[string]string{}
+	for name, script := range p.MapControlFiles() {
+		scripts[path.Clean(toSlash(script))] = name
+	}
+	for _, file := range files {
+		if name, ok := scripts[path.Clean(toSlash(file))]; ok {
+			return fmt.Errorf("%s is the %s control script and can't also be packaged as a data file", file, name)
+		}
+	}
+	return nil
+}
+
+// isExcluded returns true if a file or directory in AutoPath should be skipped
+// based on its name
+func (p *PackageSpec) isExcluded(name string) bool {
+	patterns := append([]string{}, p.Exclude...)
+	if !p.NoDefaultExcludes {
+		patterns = append(patterns, defaultExcludes...)
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ListArchivePaths lists the paths of the files that will be written to the
+// data archive, including files copied from ArchiveFiles and RemoteFiles.
+// Unlike ListFiles these are the targets inside the package rather than the
+// source paths, so they are normalized like NormalizeFilename and sorted.
+// RemoteFiles are listed whether or not they have been downloaded.
+func (p *PackageSpec) ListArchivePaths() ([]string, error) {
+	files, err := p.ListFiles(false)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := []string{}
+	for _, file := range files {
+		normFile, err := p.NormalizeFilename(file)
 		if err != nil {
-			return files, err
+			return nil, err
 		}
-		if _, ok := targets[target]; ok {
-			// This indicates a conflict between Files and what we discovered
-			// automatically via AuthPath (configuration error)
-			return files, fmt.Errorf("Duplicate file detected from Files: %s", src)
+		targets = append(targets, normFile)
+	}
+	for _, dest := range p.ArchiveFiles {
+		targets = append(targets, p.targetPath(dest))
+	}
+	// Downloaded files are already in ListFiles
+	fetched := map[string]bool{}
+	for _, url := range p.fetchedFiles {
+		fetched[url] = true
+	}
+	for url, dest := range p.RemoteFiles {
+		if !fetched[url] {
+			targets = append(targets, p.targetPath(dest))
 		}
-		targets[target] = struct{}{}
-		files = append(files, src)
 	}
 
-	return files, nil
+	sort.Strings(targets)
+	return targets, nil
 }
 
 // ListEtcFiles lists all of the configuration files that are packaged under /etc
 // in the archive so they can be added to conffiles. These will be normalized
-// to include a leading /
+// to include a leading / and sorted
 func (p *PackageSpec) ListEtcFiles() ([]string, error) {
 	etcFiles := []string{}
 
-	// If UpgradeConfigs is set we'll return an empty list. This prevents the
-	// config files from receiving special treatment during package upgrades and
-	// updates them like regular files.
-	if p.UpgradeConfigs {
-		return etcFiles, nil
+	targets, err := p.ListArchivePaths()
+	if err != nil {
+		return nil, err
+	}
+
+	preserve := map[string]bool{}
+	for _, config := range p.PreserveConfigs {
+		preserve[path.Join(".", toSlash(config))] = true
 	}
 
-	files, err := p.ListFiles(false)
+	for _, normFile := range targets {
+		if !strings.HasPrefix(normFile, "etc") {
+			continue
+		}
+		// If UpgradeConfigs is set config files don't receive special
+		// treatment during package upgrades and are updated like regular
+		// files. PreserveConfigs lists the exceptions either way.
+		if p.UpgradeConfigs == preserve[normFile] {
+			etcFiles = append(etcFiles, "/"+normFile)
+		}
+	}
+
+	// Files is a map so sort the list to make the package reproducible
+	sort.Strings(etcFiles)
+	return etcFiles, nil
+}
+
+// ListConffiles lists the files that dpkg should treat as config files. This
+// includes the files from ListEtcFiles and each file listed in Conffiles, and
+// is normalized to include a leading / and sorted.
+func (p *PackageSpec) ListConffiles() ([]string, error) {
+	confFiles, err := p.ListEtcFiles()
 	if err != nil {
 		return nil, err
 	}
+	explicit, err := p.rootTreeConffiles()
+	if err != nil {
+		return nil, err
+	}
+	explicit = append(explicit, p.Conffiles...)
+	if len(explicit) == 0 {
+		return confFiles, nil
+	}
 
+	// Explicit conffiles must be in the package, or dpkg will reject it
+	packaged := map[string]bool{}
+	files, err := p.ListFiles(false)
+	if err != nil {
+		return nil, err
+	}
 	for _, file := range files {
 		normFile, err := p.NormalizeFilename(file)
 		if err != nil {
 			return nil, err
 		}
-		if strings.HasPrefix(normFile, "etc") {
-			etcFiles = append(etcFiles, "/"+normFile)
+		packaged[normFile] = true
+	}
+	for _, dest := range p.ArchiveFiles {
+		packaged[p.targetPath(dest)] = true
+	}
+
+	for _, confFile := range explicit {
+		normFile := path.Join(".", toSlash(confFile))
+		if !packaged[normFile] {
+			return nil, fmt.Errorf("Conffile %q is not included in the package", confFile)
+		}
+		if !hasString(confFiles, "/"+normFile) {
+			confFiles = append(confFiles, "/"+normFile)
 		}
 	}
-	return etcFiles, nil
+
+	sort.Strings(confFiles)
+	return confFiles, nil
+}
+
+// rootTreeConffiles returns the paths listed in DEBIAN/conffiles when RootTree
+// is set, one per line. It is not an error for the file to be missing.
+func (p *PackageSpec) rootTreeConffiles() ([]string, error) {
+	if !p.RootTree {
+		return nil, nil
+	}
+	filename := path.Join(p.controlDir(), "conffiles")
+	data, err := p.readFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed reading %s: %s", filename, err)
+	}
+	confFiles := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			confFiles = append(confFiles, line)
+		}
+	}
+	return confFiles, nil
+}
+
+// controlDir returns the directory where MapControlFiles looks for control
+// scripts. This is AutoPath, or AutoPath/DEBIAN if RootTree is set.
+func (p *PackageSpec) controlDir() string {
+	if p.RootTree {
+		return path.Join(p.AutoPath, "DEBIAN")
+	}
+	return p.AutoPath
 }
 
 // MapControlFiles returns a list of optional control scripts including
-// pre/post/inst/rm that are used in this package.
+// pre/post/inst/rm that are used in this package. Each value is either a path
+// to the script, the inline script itself (see isInlineScript), or <embedded>
+// for scripts added with SetControlScript.
 func (p *PackageSpec) MapControlFiles() map[string]string {
 	files := map[string]string{}
 
@@ -479,8 +1779,8 @@ func (p *PackageSpec) MapControlFiles() map[string]string {
 	if p.Preinst != "" {
 		files["preinst"] = p.Preinst
 	} else if p.AutoPath != "" && p.AutoPath != "-" {
-		filename := path.Join(p.AutoPath, "preinst")
-		if FileExists(filename) {
+		filename := path.Join(p.controlDir(), "preinst")
+		if p.exists(filename) {
 			files["preinst"] = filename
 		}
 	}
@@ -488,8 +1788,8 @@ func (p *PackageSpec) MapControlFiles() map[string]string {
 	if p.Postinst != "" {
 		files["postinst"] = p.Postinst
 	} else if p.AutoPath != "" && p.AutoPath != "-" {
-		filename := path.Join(p.AutoPath, "postinst")
-		if FileExists(filename) {
+		filename := path.Join(p.controlDir(), "postinst")
+		if p.exists(filename) {
 			files["postinst"] = filename
 		}
 	}
@@ -497,8 +1797,8 @@ func (p *PackageSpec) MapControlFiles() map[string]string {
 	if p.Prerm != "" {
 		files["prerm"] = p.Prerm
 	} else if p.AutoPath != "" && p.AutoPath != "-" {
-		filename := path.Join(p.AutoPath, "prerm")
-		if FileExists(filename) {
+		filename := path.Join(p.controlDir(), "prerm")
+		if p.exists(filename) {
 			files["prerm"] = filename
 		}
 	}
@@ -506,16 +1806,21 @@ func (p *PackageSpec) MapControlFiles() map[string]string {
 	if p.Postrm != "" {
 		files["postrm"] = p.Postrm
 	} else if p.AutoPath != "" && p.AutoPath != "-" {
-		filename := path.Join(p.AutoPath, "postrm")
-		if FileExists(filename) {
+		filename := path.Join(p.controlDir(), "postrm")
+		if p.exists(filename) {
 			files["postrm"] = filename
 		}
 	}
 
+	for name := range p.embeddedScripts {
+		files[name] = embeddedScriptSource
+	}
+
 	return files
 }
 
 // CalculateSize returns the size in Kilobytes of all files in the package.
+// RemoteFiles are only counted after FetchRemoteFiles has downloaded them.
 func (p *PackageSpec) CalculateSize() (int64, error) {
 	size := int64(0)
 
@@ -524,29 +1829,47 @@ func (p *PackageSpec) CalculateSize() (int64, error) {
 		return 0, err
 	}
 
-	controlFiles := p.MapControlFiles()
-	controlFilesList := []string{}
-	for _, item := range controlFiles {
-		controlFilesList = append(controlFilesList, item)
+	// Control scripts are always copied into the package, even if they are
+	// symlinks, so count the size of their contents.
+	for name, script := range p.MapControlFiles() {
+		data, err := p.controlScriptData(name, script)
+		if err != nil {
+			return 0, err
+		}
+		size += int64(len(data))
 	}
 
-	// Merge list of control files and data files so we can get the whole size
-	files = append(files, controlFilesList...)
+	// Generated snippets are added to the control scripts
+	for _, name := range controlFiles {
+		size += int64(len(p.scriptSnippets(name)))
+	}
 
+	// Count what is written to the data archive. A symlink is either written
+	// as a link with no contents if PreserveSymlinks is set, or replaced with
+	// a copy of the file it points to.
 	for _, file := range files {
-		var fileinfo os.FileInfo
-		var err error
 		if p.PreserveSymlinks {
-			fileinfo, err = os.Lstat(file)
-		} else {
-			fileinfo, err = os.Stat(file)
+			fileinfo, err := p.lstat(file)
+			if err != nil {
+				return 0, fmt.Errorf("Failed to stat %q: %s", file, err)
+			}
+			if fileinfo.Mode()&os.ModeSymlink != 0 {
+				continue
+			}
 		}
+		fileinfo, err := p.stat(file)
 		if err != nil {
 			return 0, fmt.Errorf("Failed to stat %q: %s", file, err)
 		}
 		size += fileinfo.Size()
 	}
 
+	archiveSize, err := p.archiveFilesSize()
+	if err != nil {
+		return 0, err
+	}
+	size += archiveSize
+
 	// Convert size from bytes to kilobytes. If there is a remainder, round up.
 	if size%1024 > 0 {
 		size = size/1024 + 1
@@ -563,8 +1886,19 @@ func (p *PackageSpec) CalculateSize() (int64, error) {
 //	checksum  file1
 //	checksum  file2
 //
-// All files returned by ListFiles() are included
+// All files returned by ListFiles() are included, so RemoteFiles are only
+// included after FetchRemoteFiles has downloaded them.
 func (p *PackageSpec) CalculateChecksums() ([]byte, error) {
+	return p.calculateChecksums(md5.New)
+}
+
+// CalculateSha256Checksums produces the contents of the sha256sums file. This
+// is the same as CalculateChecksums but uses sha256 instead of md5.
+func (p *PackageSpec) CalculateSha256Checksums() ([]byte, error) {
+	return p.calculateChecksums(sha256.New)
+}
+
+func (p *PackageSpec) calculateChecksums(newHash func() hash.Hash) ([]byte, error) {
 	data := []byte{}
 	files, err := p.ListFiles(false)
 	if err != nil {
@@ -572,7 +1906,22 @@ func (p *PackageSpec) CalculateChecksums() ([]byte, error) {
 	}
 
 	for _, file := range files {
-		sum, err := md5SumFile(file)
+		// Like dpkg, only list regular files. Symlinks are only written to
+		// the archive as links when PreserveSymlinks is set.
+		var info os.FileInfo
+		if p.PreserveSymlinks {
+			info, err = p.lstat(file)
+		} else {
+			info, err = p.stat(file)
+		}
+		if err != nil {
+			return data, err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		sum, err := p.cachedHashFile(file, newHash)
 		if err != nil {
 			return data, err
 		}
@@ -583,10 +1932,57 @@ func (p *PackageSpec) CalculateChecksums() ([]byte, error) {
 		data = append(data, []byte(sum+"  "+normFile+"\n")...)
 	}
 
+	archiveSums, err := p.archiveFileChecksums(newHash)
+	if err != nil {
+		return data, err
+	}
+	data = append(data, archiveSums...)
+
 	return data, nil
 }
 
-// CreateDataArchive creates
+// VerifyChecksums checks that each source file listed in Checksums has the
+// expected sha256 checksum, so files that were modified or replaced after they
+// were vetted are not packaged.
+func (p *PackageSpec) VerifyChecksums() error {
+	if len(p.Checksums) == 0 {
+		return nil
+	}
+
+	files, err := p.ListFiles(false)
+	if err != nil {
+		return err
+	}
+	packaged := map[string]string{}
+	for _, file := range files {
+		packaged[filepath.Clean(file)] = file
+	}
+
+	sources := []string{}
+	for source := range p.Checksums {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		file, ok := packaged[filepath.Clean(source)]
+		if !ok {
+			return fmt.Errorf("Checksum specified for %s but it is not included in the package", source)
+		}
+		sum, err := p.hashFile(file, sha256.New)
+		if err != nil {
+			return err
+		}
+		if expected := strings.ToLower(p.Checksums[source]); sum != expected {
+			return fmt.Errorf("Checksum mismatch for %s: expected sha256 %s, found %s", source, expected, sum)
+		}
+	}
+	return nil
+}
+
+// CreateDataArchive creates the data.tar.gz part of the .deb package,
+// compressed according to DataCompression. This includes all of the files that
+// will be installed.
 func (p *PackageSpec) CreateDataArchive(target string) error {
 	file, err := os.Create(target)
 	if err != nil {
@@ -594,16 +1990,60 @@ func (p *PackageSpec) CreateDataArchive(target string) error {
 	}
 	defer file.Close()
 
+	if err := p.WriteDataArchive(file); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// normalizeHeader sets the name, owner, modification time, and mode of a data
+// archive header. It is used for files on disk and for ArchiveFiles alike so
+// ClampMTime, Date, GitMTime, and IgnoreFileModes apply to both. gitModTime is
+// the last commit that changed the file, or zero if that isn't known, and magic
+// returns the first few bytes of the file.
+func (p *PackageSpec) normalizeHeader(header *tar.Header, target string, info os.FileInfo, gitModTime time.Time, magic func() []byte) error {
+	header.Name = target
+	if err := p.setOwner(header, target); err != nil {
+		return err
+	}
+	if p.ClampMTime || p.Date != "" {
+		header.ModTime = p.buildTime()
+	}
+	if p.GitMTime {
+		header.ModTime = p.buildTime()
+		if !gitModTime.IsZero() {
+			header.ModTime = gitModTime
+		}
+	}
+	if p.ignoreFileModes() && (info.Mode().IsRegular() || info.IsDir()) {
+		header.Mode = defaultMode(target, info, magic)
+	}
+	if p.isInitScript(target) {
+		header.Mode = DefaultExecMode
+	}
+	return nil
+}
+
+// WriteDataArchive writes the compressed data archive to w. See
+// CreateDataArchive.
+func (p *PackageSpec) WriteDataArchive(w io.Writer) error {
 	// Create a compressed archive stream
-	zipwriter := pgzip.NewWriter(file)
+	zipwriter, err := newCompressor(w, p.DataCompression)
+	if err != nil {
+		return err
+	}
 	defer zipwriter.Close()
-	archive := tar.NewWriter(zipwriter)
+	archive, err := p.newTarWriter(zipwriter)
+	if err != nil {
+		return err
+	}
 	defer archive.Close()
 
 	files, err := p.ListFiles(true)
 	if err != nil {
 		return err
 	}
+	gitModTimes := p.gitModTimes(files)
 
 	for _, filename := range files {
 		target, err := p.NormalizeFilename(filename)
@@ -611,7 +2051,7 @@ func (p *PackageSpec) CreateDataArchive(target string) error {
 			return err
 		}
 
-		info, err := os.Stat(filename)
+		info, err := p.stat(filename)
 		if err != nil {
 			return err
 		}
@@ -621,15 +2061,16 @@ func (p *PackageSpec) CreateDataArchive(target string) error {
 			return err
 		}
 
-		header.Name = target
-		header.Uid = 0
-		header.Gid = 0
-		header.Uname = "root"
-		header.Gname = "root"
+		magic := func() []byte { return p.fileMagic(filename) }
+		if err := p.normalizeHeader(header, target, info, gitModTimes[filename], magic); err != nil {
+			return err
+		}
 
-		archive.WriteHeader(header)
+		if err := archive.WriteHeader(header); err != nil {
+			return fmt.Errorf("Failed to add %s to data archive: %s", target, err)
+		}
 		if !info.IsDir() {
-			dataFile, err := os.Open(filename)
+			dataFile, err := p.open(filename)
 
 			if err != nil {
 				return err
@@ -644,18 +2085,28 @@ func (p *PackageSpec) CreateDataArchive(target string) error {
 		}
 	}
 
+	if err := p.writeArchiveFiles(archive); err != nil {
+		return err
+	}
+
+	// Close explicitly so we find out if flushing the archive fails
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("Failed to finish data archive: %s", err)
+	}
+	if err := zipwriter.Close(); err != nil {
+		return fmt.Errorf("Failed to finish data archive: %s", err)
+	}
 	return nil
 }
 
-// CreateControlArchive creates the control.tar.gz part of the .deb package
-// This includes:
+// CreateControlArchive creates the control.tar.gz part of the .deb package,
+// compressed according to ControlCompression. This includes:
 //
 //	conffiles
 //	md5sums
+//	sha256sums (if Sha256Sums is set)
 //	control
 //	pre/post/inst/rm scripts (if any)
-//
-// You must pass in a file handle that is open for writing.
 func (p *PackageSpec) CreateControlArchive(target string) error {
 	file, err := os.Create(target)
 	if err != nil {
@@ -663,17 +2114,49 @@ func (p *PackageSpec) CreateControlArchive(target string) error {
 	}
 	defer file.Close()
 
+	if err := p.WriteControlArchive(file); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// WriteControlArchive writes the compressed control archive to w. See
+// CreateControlArchive.
+func (p *PackageSpec) WriteControlArchive(w io.Writer) error {
 	// Create a compressed archive stream
-	zipwriter := pgzip.NewWriter(file)
+	zipwriter, err := newCompressor(w, p.ControlCompression)
+	if err != nil {
+		return err
+	}
 	defer zipwriter.Close()
-	archive := tar.NewWriter(zipwriter)
+	archive, err := p.newTarWriter(zipwriter)
+	if err != nil {
+		return err
+	}
 	defer archive.Close()
 
+	if err := p.writeControlFiles(archive); err != nil {
+		return err
+	}
+
+	// Close explicitly so we find out if flushing the archive fails
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("Failed to finish control archive: %s", err)
+	}
+	if err := zipwriter.Close(); err != nil {
+		return fmt.Errorf("Failed to finish control archive: %s", err)
+	}
+	return nil
+}
+
+// writeControlFiles writes the contents of the control archive. See
+// CreateControlArchive.
+func (p *PackageSpec) writeControlFiles(archive *tar.Writer) error {
 	header := tar.Header{
 		Mode:    0644,
 		Uid:     0,
 		Gid:     0,
-		ModTime: time.Now(),
+		ModTime: p.buildTime(),
 		Uname:   "root",
 		Gname:   "root",
 	}
@@ -683,78 +2166,190 @@ func (p *PackageSpec) CreateControlArchive(target string) error {
 	if err != nil {
 		return err
 	}
-	sumHeader := header
-	sumHeader.Name = "md5sums"
-	sumHeader.Size = int64(len(sumData))
-	archive.WriteHeader(&sumHeader)
-	archive.Write(sumData)
+	if err := writeBytesToTar(archive, header, "md5sums", sumData); err != nil {
+		return err
+	}
+
+	// Add sha256sums
+	if p.Sha256Sums {
+		sumData, err := p.CalculateSha256Checksums()
+		if err != nil {
+			return err
+		}
+		if err := writeBytesToTar(archive, header, "sha256sums", sumData); err != nil {
+			return err
+		}
+	}
 
 	// Add conffiles
-	confFiles, err := p.ListEtcFiles()
+	confFiles, err := p.ListConffiles()
 	if err != nil {
 		return err
 	}
 	confData := []byte(strings.Join(confFiles, "\n") + "\n")
-	confHeader := header
-	confHeader.Name = "conffiles"
-	confHeader.Size = int64(len(confData))
-	archive.WriteHeader(&confHeader)
-	archive.Write(confData)
+	if err := writeBytesToTar(archive, header, "conffiles", confData); err != nil {
+		return err
+	}
 
 	// Add control file
 	controlData, err := p.RenderControlFile()
 	if err != nil {
 		return err
 	}
-	controlHeader := header
-	controlHeader.Name = "control"
-	controlHeader.Size = int64(len(controlData))
-	archive.WriteHeader(&controlHeader)
-	archive.Write(controlData)
-
-	// Add control scripts
-	scripts := p.MapControlFiles()
-	if err != nil {
+	if err := writeBytesToTar(archive, header, "control", controlData); err != nil {
 		return err
 	}
-	for target, script := range scripts {
-		scriptData, err := ioutil.ReadFile(script)
-		if err != nil {
-			return fmt.Errorf("Failed reading script %q: %s", script, err)
+
+	// Add control scripts, including scripts we generate for options like
+	// Alternatives. Write them in a fixed order so the archive is reproducible.
+	scripts := p.MapControlFiles()
+	for _, target := range controlFiles {
+		var scriptData []byte
+		if script, ok := scripts[target]; ok {
+			scriptData, err = p.controlScriptData(target, script)
+			if err != nil {
+				return err
+			}
+		}
+		scriptData = p.addSnippets(target, scriptData)
+		if scriptData == nil {
+			continue
 		}
 
 		scriptHeader := header
-		scriptHeader.Mode = 0755
-		scriptHeader.Name = target
-		if err != nil {
+		scriptHeader.Mode = int64(p.scriptMode(target))
+		if err := writeBytesToTar(archive, scriptHeader, target, scriptData); err != nil {
 			return err
 		}
-		scriptHeader.Size = int64(len(scriptData))
-		archive.WriteHeader(&scriptHeader)
-		archive.Write(scriptData)
 	}
 
 	return nil
 }
 
+// controlScriptData returns the contents of a control script as it is written
+// to the control archive, rendered as a template if TemplateScripts is set
+func (p *PackageSpec) controlScriptData(name, script string) ([]byte, error) {
+	data, err := p.readControlScript(name, script)
+	if err != nil {
+		return nil, err
+	}
+	if p.TemplateScripts {
+		return p.renderScript(name, data)
+	}
+	return data, nil
+}
+
+// renderScript renders a control script as a template using PackageSpec as
+// data. This is used when TemplateScripts is enabled.
+func (p *PackageSpec) renderScript(name string, data []byte) ([]byte, error) {
+	t, err := template.New(name).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("Failed parsing %s template: %s", name, err)
+	}
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, p); err != nil {
+		return nil, fmt.Errorf("Failed rendering %s template: %s", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
 // NormalizeFilename converts a local filename into a target archive filename
 // by either using the PackageSpec.Files map or by stripping the AutoPath prefix
 // from the file path. For example, deb-pkg/etc/blah will become ./etc/blah and
 // a file mapped from config to /etc/config will become ./etc/config in the archive
+//
+// Files that will be compressed because of CompressOver have .gz added, since
+// that is how they are installed.
 func (p *PackageSpec) NormalizeFilename(filename string) (string, error) {
-	if target, ok := p.Files[filename]; ok {
-		return path.Join(".", target), nil
+	target, err := p.normalizeFilename(filename)
+	if err != nil {
+		return "", err
+	}
+	if p.CompressOver > 0 {
+		info, err := p.statOriginal(filename)
+		if err != nil {
+			return "", err
+		}
+		if p.shouldCompress(filename, target, info) {
+			target += ".gz"
+		}
+	}
+	return target, nil
+}
+
+func (p *PackageSpec) normalizeFilename(filename string) (string, error) {
+	if target, ok := p.filesTarget(filename); ok {
+		return p.targetPath(target), nil
+	}
+	if url, ok := p.fetchedFiles[filename]; ok {
+		return p.targetPath(p.RemoteFiles[url]), nil
 	}
 	if p.AutoPath != "" && p.AutoPath != "-" {
 		fpath, err := filepath.Rel(p.AutoPath, filename)
 		if err != nil {
 			return "", err
 		}
-		return path.Join(".", fpath), nil
+		if fpath == ".." || strings.HasPrefix(fpath, "../") {
+			return "", fmt.Errorf("Not sure what to do with %q because it is not specified in files or inside autopath", filename)
+		}
+		return p.targetPath(fpath), nil
 	}
 	return "", fmt.Errorf("Not sure what to do with %q because it is not specified in files and autopath is disabled", filename)
 }
 
+// filesTarget returns the destination for filename from the Files map,
+// SystemdUnits, or InitScripts. Source paths are compared after cleaning them,
+// so "./bin/app" and "bin/app" or "/build//out/app" and "/build/out/app" refer
+// to the same file.
+func (p *PackageSpec) filesTarget(filename string) (string, bool) {
+	files := p.fileMap()
+	if target, ok := files[filename]; ok {
+		return target, true
+	}
+	clean := filepath.Clean(filename)
+	for src, target := range files {
+		if filepath.Clean(src) == clean {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// targetPath converts a destination path into an archive path, applying Prefix.
+// Paths inside a .deb always use forward slashes, so backslashes (e.g. from a
+// config written on Windows) are converted regardless of the host OS.
+func (p *PackageSpec) targetPath(dest string) string {
+	return path.Join(".", toSlash(p.Prefix), toSlash(dest))
+}
+
+func toSlash(name string) string {
+	return strings.Replace(name, `\`, "/", -1)
+}
+
+// isInlineScript returns true if a control script field contains the script
+// itself rather than a path to a script file. Inline scripts must start with a
+// shebang like #!/bin/sh.
+func isInlineScript(script string) bool {
+	return strings.HasPrefix(script, "#!")
+}
+
+// readControlScript returns the contents of the control script name, which may
+// be added with SetControlScript, or specified either inline or as a path to a
+// file.
+func (p *PackageSpec) readControlScript(name, script string) ([]byte, error) {
+	if embedded, ok := p.embeddedScripts[name]; ok {
+		return embedded.data, nil
+	}
+	if isInlineScript(script) {
+		return []byte(script), nil
+	}
+	data, err := p.readFile(script)
+	if err != nil {
+		return nil, fmt.Errorf("Failed reading script %q: %s", script, err)
+	}
+	return data, nil
+}
+
 // FileExists returns true if the specified file/dir exists and we can stat it
 func FileExists(path string) bool {
 	_, err := os.Stat(path)
@@ -766,6 +2361,11 @@ func SupportedArchitectures() []string {
 	return supportedArchitectures
 }
 
+// IsSupportedArchitecture returns true if arch is accepted by the validator
+func IsSupportedArchitecture(arch string) bool {
+	return hasString(supportedArchitectures, arch)
+}
+
 func hasString(items []string, search string) bool {
 	for _, item := range items {
 		if item == search {
@@ -775,13 +2375,19 @@ func hasString(items []string, search string) bool {
 	return false
 }
 
-func md5SumFile(path string) (string, error) {
-	file, err := os.Open(path)
+func (p *PackageSpec) md5SumFile(path string) (string, error) {
+	return p.hashFile(path, md5.New)
+}
+
+// hashFile returns the hex encoded checksum of a file using newHash
+func (p *PackageSpec) hashFile(path string, newHash func() hash.Hash) (string, error) {
+	file, err := p.open(path)
 	if err != nil {
 		return "", err
 	}
+	defer file.Close()
 
-	hash := md5.New()
+	hash := newHash()
 	_, err = io.Copy(hash, file)
 	if err != nil {
 		return "", err
@@ -791,6 +2397,18 @@ func md5SumFile(path string) (string, error) {
 	return hex.EncodeToString(sum), nil
 }
 
+func writeBytesToTar(archive *tar.Writer, header tar.Header, name string, data []byte) error {
+	header.Name = name
+	header.Size = int64(len(data))
+	if err := archive.WriteHeader(&header); err != nil {
+		return fmt.Errorf("Failed writing tar header for %q: %s", name, err)
+	}
+	if numbytes, err := archive.Write(data); err != nil {
+		return fmt.Errorf("Failed writing tar data for %q (had %d, wrote %d): %s", name, len(data), numbytes, err)
+	}
+	return nil
+}
+
 func writeBytesToAr(archive *ar.Writer, header ar.Header, name string, data []byte) error {
 	header.Name = name
 	// This will cause data truncation on 32-bit go arch for files around 2gb.
@@ -807,12 +2425,15 @@ func writeBytesToAr(archive *ar.Writer, header ar.Header, name string, data []by
 	return nil
 }
 
-func writeFileToAr(archive *ar.Writer, header ar.Header, source string) error {
-	header.Name = filepath.Base(source)
+// writeFileToAr copies source into the ar archive as name. name must be a
+// plain member name like data.tar.gz, not a path.
+func writeFileToAr(archive *ar.Writer, header ar.Header, name, source string) error {
+	header.Name = name
 	file, err := os.Open(source)
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 	info, err := file.Stat()
 	if err != nil {
 		return fmt.Errorf("Failed to stat %q to write ar header size: %s", file.Name(), err)
@@ -832,29 +2453,3 @@ func writeFileToAr(archive *ar.Writer, header ar.Header, source string) error {
 func join(s []string) string {
 	return strings.Join(s, ", ")
 }
-
-const controlFileTemplate = `Package: {{ .Package }}
-Version: {{ .Version }}
-Architecture: {{ .Architecture}}
-Maintainer: {{ .Maintainer }}
-Installed-Size: {{ .InstalledSize }}
-{{- if (len .PreDepends) gt 0 }}
-Pre-Depends: {{ join .PreDepends }}
-{{- end -}}
-{{- if (len .Depends) gt 0 }}
-Depends: {{ join .Depends }}
-{{- end -}}
-{{- if (len .Conflicts) gt 0 }}
-Conflicts: {{ join .Conflicts }}
-{{- end -}}
-{{- if (len .Breaks) gt 0 }}
-Breaks: {{ join .Breaks }}
-{{- end -}}
-{{- if (len .Replaces) gt 0 }}
-Replaces: {{ join .Replaces }}
-{{- end }}
-Section: {{ .Section }}
-Priority: {{ .Priority }}
-Homepage: {{ .Homepage }}
-Description: {{ .Description }}
-`
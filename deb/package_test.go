@@ -1,241 +1,2003 @@
 package deb
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/cbednarski/mkdeb/deb/tar"
+
+	"github.com/laher/argo/ar"
 )
 
-func PackageSpecFixture(t *testing.T) *PackageSpec {
-	p, err := NewPackageSpecFromFile(path.Join("test-fixtures", "example-basic.json"))
+func PackageSpecFixture(t *testing.T) *PackageSpec {
+	p, err := NewPackageSpecFromFile(path.Join("test-fixtures", "example-basic.json"))
+	if err != nil {
+		t.Fatalf("Failed to load fixture: %s", err)
+	}
+	p.AutoPath = path.Join("test-fixtures", "package1")
+	return p
+}
+
+// WarningsFixture is PackageSpecFixture with a synopsis that lintian accepts,
+// so tests of Warnings() only see the warnings they are checking for
+func WarningsFixture(t *testing.T) *PackageSpec {
+	p := PackageSpecFixture(t)
+	p.Description = "CLI tool for building debian packages"
+	return p
+}
+
+// readTarGz returns the headers and contents of each file in a .tar.gz archive
+func readTarGz(t *testing.T, filename string) (map[string]*tar.Header, map[string][]byte) {
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	return readTarGzData(t, file)
+}
+
+// readTarGzData is like readTarGz but reads the archive from r
+func readTarGzData(t *testing.T, r io.Reader) (map[string]*tar.Header, map[string][]byte) {
+	zipreader, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := tar.NewReader(zipreader)
+
+	headers := map[string]*tar.Header{}
+	contents := map[string][]byte{}
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers[header.Name] = header
+		contents[header.Name] = data
+	}
+	return headers, contents
+}
+
+// readDeb returns the headers and contents of each member of a .deb package
+func readDeb(t *testing.T, filename string) ([]*ar.Header, map[string][]byte) {
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	archive := ar.NewReader(file)
+
+	headers := []*ar.Header{}
+	contents := map[string][]byte{}
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers = append(headers, header)
+		contents[header.Name] = data
+	}
+	return headers, contents
+}
+
+func TestDefaultPackageSpec(t *testing.T) {
+	p := DefaultPackageSpec()
+	expected := "deb-pkg"
+	if p.AutoPath != expected {
+		t.Fatalf("Expected AutoPath to be %q, got %q", expected, p.AutoPath)
+	}
+}
+
+func TestSave(t *testing.T) {
+	p := PackageSpecFixture(t)
+
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p.Description = "A modified description"
+	p.Depends = []string{"curl (>= 7.0.0)"}
+	filename := filepath.Join(dir, "mkdeb.json")
+	if err := p.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	p2, err := NewPackageSpecFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p2.Description != p.Description {
+		t.Errorf("Expected description %q, found %q", p.Description, p2.Description)
+	}
+	if len(p2.Depends) != 1 || p2.Depends[0] != p.Depends[0] {
+		t.Errorf("Expected depends %+v, found %+v", p.Depends, p2.Depends)
+	}
+	if p2.AutoPath != p.AutoPath {
+		t.Errorf("Expected autoPath %q, found %q", p.AutoPath, p2.AutoPath)
+	}
+
+	// Only the config file should be left behind
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("Expected only %s in %s, found %d files", filename, dir, len(files))
+	}
+}
+
+func TestFilename(t *testing.T) {
+	p := &PackageSpec{
+		Package:      "mkdeb",
+		Version:      "0.1.0",
+		Architecture: "amd64",
+	}
+	expected := "mkdeb-0.1.0-amd64.deb"
+	if p.Filename() != expected {
+		t.Fatalf("Expected filename to be %q, got %q", expected, p.Filename())
+	}
+}
+
+func TestFilenameTemplate(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.FilenameTemplate = "{{.Package}}_{{.Version}}_{{.Architecture}}_prod.deb"
+
+	if err := p.Validate(true); err != nil {
+		t.Fatal(err)
+	}
+	expected := "mkdeb_0.1.0_amd64_prod.deb"
+	if p.Filename() != expected {
+		t.Fatalf("Expected filename to be %q, got %q", expected, p.Filename())
+	}
+
+	filename := path.Join("output", expected)
+	defer os.Remove(filename)
+	if err := p.Build("output"); err != nil {
+		t.Fatal(err)
+	}
+	if !FileExists(filename) {
+		t.Errorf("Expected package to be built as %s", filename)
+	}
+
+	for _, tmpl := range []string{"{{.Package}}", "{{.Nope}}.deb", "{{.Package", "{{.Package}}/{{.Version}}.deb", "{{if false}}x{{end}}.deb"} {
+		p.FilenameTemplate = tmpl
+		err := p.Validate(true)
+		if err == nil || !strings.Contains(err.Error(), "ilename template") {
+			t.Errorf("Expected %q to be invalid; found %+v", tmpl, err)
+		}
+		if p.Filename() != "mkdeb-0.1.0-amd64.deb" {
+			t.Errorf("Expected %q to fall back to the default filename, found %q", tmpl, p.Filename())
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+
+	if err := p.Validate(true); err != nil {
+		t.Fatal(err)
+	}
+
+	p2 := &PackageSpec{}
+	err := p2.Validate(true)
+	expected := "These required fields are missing: package, version, architecture, maintainer, description"
+	if err.Error() != expected {
+		t.Fatalf("-- Expected --\n%s\n-- Found --\n%s\n", expected, err.Error())
+	}
+}
+
+func TestValidateErrorFields(t *testing.T) {
+	p := &PackageSpec{Package: "mkdeb"}
+	err := p.Validate(true)
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected ValidationErrors, found %T", err)
+	}
+	expected := []string{"version", "architecture", "maintainer", "description"}
+	if !reflect.DeepEqual(errs.Fields(), expected) {
+		t.Errorf("Expected fields %+v, found %+v", expected, errs.Fields())
+	}
+	for _, e := range errs {
+		if !e.Missing {
+			t.Errorf("Expected %q to be reported as missing", e.Field)
+		}
+	}
+
+	// All invalid fields are reported, not just the first
+	p = PackageSpecFixture(t)
+	p.Version = "1.0"
+	p.Priority = "urgent"
+	p.Depends = []string{"libc6", "bad dep!"}
+	err = p.Validate(true)
+	errs, ok = err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected ValidationErrors, found %T", err)
+	}
+	expected = []string{"priority", "depends"}
+	if !reflect.DeepEqual(errs.Fields(), expected) {
+		t.Errorf("Expected fields %+v, found %+v", expected, errs.Fields())
+	}
+	if errs[1].Value != "bad dep!" {
+		t.Errorf("Expected value %q, found %q", "bad dep!", errs[1].Value)
+	}
+	for _, msg := range []string{"Priority \"urgent\"", "Dependency \"bad dep!\""} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("Expected %q in %q", msg, err.Error())
+		}
+	}
+}
+
+func TestValidatePackageName(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+
+	for _, name := range []string{"mkdeb", "libc6", "g++", "python3.5-dev", "0ad"} {
+		p.Package = name
+		if err := p.Validate(true); err != nil {
+			t.Errorf("Expected %q to be valid: %s", name, err)
+		}
+	}
+
+	for _, name := range []string{"MkDeb", "-mkdeb", "m", "mk_deb", "mk deb"} {
+		p.Package = name
+		err := p.Validate(true)
+		if err == nil || !strings.Contains(err.Error(), "Package name") {
+			t.Errorf("Expected %q to be invalid; found %+v", name, err)
+		}
+	}
+}
+
+func TestValidateVersion(t *testing.T) {
+	p := PackageSpecFixture(t)
+
+	for _, version := range []string{"1.2.3", "2:1.0-1ubuntu1", "1.0~rc1", "1.0+git20170101-2"} {
+		p.Version = version
+		if err := p.Validate(true); err != nil {
+			t.Errorf("Expected %q to be valid: %s", version, err)
+		}
+	}
+
+	for _, version := range []string{"1.0 beta", "v1.0", "1.0-", "a:1.0"} {
+		p.Version = version
+		err := p.Validate(true)
+		if err == nil || !strings.Contains(err.Error(), "Version") {
+			t.Errorf("Expected %q to be invalid; found %+v", version, err)
+		}
+	}
+
+	// Version is not known until build time so it is not checked otherwise
+	p.Version = "1.0 beta"
+	if err := p.Validate(false); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateDependsVersion(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "1.0"
+
+	// These are the same versions TestValidateVersion accepts, so a package
+	// like -dbgsym can depend on exactly the version of another package
+	for _, version := range []string{"1.2.3", "2:1.0-1ubuntu1", "1.0~rc1", "1.0+git20170101-2"} {
+		p.Depends = []string{"libc6 (= " + version + ")"}
+		if err := p.Validate(true); err != nil {
+			t.Errorf("Expected dependency on %q to be valid: %s", version, err)
+		}
+	}
+}
+
+func TestValidateSelfDependency(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.Depends = []string{"libc6", "mkdeb-data"}
+	if err := p.Validate(true); err != nil {
+		t.Errorf("Expected similarly named dependency to be valid: %s", err)
+	}
+
+	for _, dep := range []string{"mkdeb", "mkdeb (>= 0.1.0)"} {
+		p.Depends = []string{"libc6", dep}
+		err := p.Validate(true)
+		if err == nil || !strings.Contains(err.Error(), "must not depend on itself") {
+			t.Errorf("Expected self-dependency %q to be invalid; found %+v", dep, err)
+		}
+	}
+
+	p.Depends = nil
+	p.PreDepends = []string{"mkdeb"}
+	err := p.Validate(true)
+	if errs, ok := err.(ValidationErrors); !ok || errs[0].Field != "preDepends" {
+		t.Errorf("Expected preDepends self-dependency to be invalid; found %+v", err)
+	}
+}
+
+func TestWarningsMaintainer(t *testing.T) {
+	p := WarningsFixture(t)
+	p.Section = "utils"
+
+	for _, maintainer := range []string{
+		"Chris Bednarski <banzaimonkey@gmail.com>",
+		"Debian Go Packaging Team <team+pkg-go@tracker.debian.org>",
+	} {
+		p.Maintainer = maintainer
+		if warnings := p.Warnings(); len(warnings) != 0 {
+			t.Errorf("Expected no warnings for %q; found %+v", maintainer, warnings)
+		}
+	}
+
+	for _, maintainer := range []string{
+		"just-a-name",
+		"<banzaimonkey@gmail.com>",
+		"Chris Bednarski banzaimonkey@gmail.com",
+		"Chris Bednarski <banzaimonkey>",
+	} {
+		p.Maintainer = maintainer
+		warnings := p.Warnings()
+		if len(warnings) != 1 || !strings.Contains(warnings[0], "Maintainer") {
+			t.Errorf("Expected a maintainer warning for %q; found %+v", maintainer, warnings)
+		}
+	}
+}
+
+func TestIsSupportedArchitecture(t *testing.T) {
+	for _, arch := range []string{"amd64", "arm64", "all"} {
+		if !IsSupportedArchitecture(arch) {
+			t.Errorf("Expected %q to be supported", arch)
+		}
+	}
+	for _, arch := range []string{"aarch64", "x86_64", ""} {
+		if IsSupportedArchitecture(arch) {
+			t.Errorf("Expected %q not to be supported", arch)
+		}
+	}
+}
+
+func TestValidateDpkgArchitectures(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	for _, arch := range []string{"arm", "ppc64", "sparc64", "mips64el", "riscv64", "loong64"} {
+		p.Architecture = arch
+		if err := p.Validate(true); err != nil {
+			t.Errorf("Expected %q to be valid, found %s", arch, err)
+		}
+		if _, ok := multiArchTriplets[arch]; !ok {
+			t.Errorf("Expected a multiarch triplet for %q", arch)
+		}
+	}
+}
+
+func TestValidatePriority(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+
+	for _, priority := range []string{"required", "important", "standard", "optional", "extra"} {
+		p.Priority = priority
+		if err := p.Validate(true); err != nil {
+			t.Errorf("Expected %q to be valid: %s", priority, err)
+		}
+	}
+
+	for _, priority := range []string{"Optional", "low", "default"} {
+		p.Priority = priority
+		err := p.Validate(true)
+		if err == nil || !strings.Contains(err.Error(), "Priority") {
+			t.Errorf("Expected %q to be invalid; found %+v", priority, err)
+		}
+	}
+}
+
+func TestDefaultPriority(t *testing.T) {
+	for section, expected := range map[string]string{
+		"utils":         "optional",
+		"contrib/net":   "optional",
+		"default":       "extra",
+		"not-a-section": "extra",
+	} {
+		p, err := NewPackageSpecFromJSON([]byte(fmt.Sprintf(`{"section": %q}`, section)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Priority != expected {
+			t.Errorf("Expected priority %q for section %q, found %q", expected, section, p.Priority)
+		}
+	}
+
+	p, err := NewPackageSpecFromJSON([]byte(`{"section": "utils", "priority": "important"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Priority != "important" {
+		t.Errorf("Expected explicit priority to be kept, found %q", p.Priority)
+	}
+}
+
+func TestWarningsPriorityExtra(t *testing.T) {
+	hasWarning := func(p *PackageSpec) bool {
+		for _, warning := range p.Warnings() {
+			if strings.Contains(warning, "deprecated") {
+				return true
+			}
+		}
+		return false
+	}
+
+	// The default for non-standard sections is not the user's fault
+	p, err := NewPackageSpecFromJSON([]byte(`{"section": "not-a-section"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Priority != "extra" || hasWarning(p) {
+		t.Errorf("Expected default priority extra without a warning, found %q %+v", p.Priority, p.Warnings())
+	}
+
+	p, err = NewPackageSpecFromJSON([]byte(`{"section": "utils", "priority": "extra"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasWarning(p) {
+		t.Errorf("Expected a warning for priority extra, found %+v", p.Warnings())
+	}
+}
+
+func TestWarningsSection(t *testing.T) {
+	p := WarningsFixture(t)
+
+	for _, section := range []string{"utils", "net", "contrib/net", "non-free/libs"} {
+		p.Section = section
+		if warnings := p.Warnings(); len(warnings) != 0 {
+			t.Errorf("Expected no warnings for %q; found %+v", section, warnings)
+		}
+	}
+
+	for _, section := range []string{"default", "tools"} {
+		p.Section = section
+		warnings := p.Warnings()
+		if len(warnings) != 1 || !strings.Contains(warnings[0], "Section") {
+			t.Errorf("Expected a section warning for %q; found %+v", section, warnings)
+		}
+	}
+}
+
+func TestWarningsSynopsis(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Description = "CLI tool for building debian packages"
+	if warnings := p.Warnings(); len(warnings) != 0 {
+		t.Errorf("Expected no warnings for %q; found %+v", p.Description, warnings)
+	}
+
+	for description, expected := range map[string]string{
+		"A CLI tool for building debian packages":   "article",
+		"The CLI tool for building debian packages": "article",
+		"mkdeb builds debian packages":              "package name",
+		"CLI tool for building debian packages.":    "full stop",
+		strings.Repeat("very ", 16) + "long":        "84 characters",
+	} {
+		p.Description = description
+		warnings := p.Warnings()
+		if len(warnings) != 1 || !strings.Contains(warnings[0], expected) {
+			t.Errorf("Expected a synopsis warning about %s for %q; found %+v", expected, description, warnings)
+		}
+	}
+
+	// Only the first line is the synopsis
+	p.Description = "CLI tool for building debian packages\n A longer explanation."
+	if warnings := p.Warnings(); len(warnings) != 0 {
+		t.Errorf("Expected no warnings for %q; found %+v", p.Description, warnings)
+	}
+}
+
+func TestWarningsControlScriptShebang(t *testing.T) {
+	p := WarningsFixture(t)
+	p.Section = "utils"
+
+	if warnings := p.Warnings(); len(warnings) != 0 {
+		t.Fatalf("Expected no warnings; found %+v", warnings)
+	}
+
+	script, err := ioutil.TempFile("", "postinst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(script.Name())
+	script.WriteString("echo missing shebang\n")
+	script.Close()
+
+	p.Postinst = script.Name()
+	warnings := p.Warnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "shebang") {
+		t.Errorf("Expected a shebang warning; found %+v", warnings)
+	}
+}
+
+func TestWarningsReplaces(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Replaces = []string{"mkdeb-legacy (<< 0.1.0)"}
+
+	found := false
+	for _, warning := range p.Warnings() {
+		if strings.Contains(warning, `replaces "mkdeb-legacy"`) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected a warning for replaces without conflicts or breaks, found %+v", p.Warnings())
+	}
+	if err := p.Validate(false); err != nil {
+		t.Errorf("Expected replaces without conflicts to be valid: %s", err)
+	}
+
+	for _, fix := range []func(){
+		func() { p.Conflicts = []string{"mkdeb-legacy"}; p.Breaks = nil },
+		func() { p.Conflicts = nil; p.Breaks = []string{"mkdeb-legacy (<< 0.1.0)"} },
+	} {
+		fix()
+		for _, warning := range p.Warnings() {
+			if strings.Contains(warning, "mkdeb-legacy") {
+				t.Errorf("Unexpected warning %q with conflicts %+v and breaks %+v", warning, p.Conflicts, p.Breaks)
+			}
+		}
+	}
+}
+
+func TestWarningsRootDirs(t *testing.T) {
+	p := WarningsFixture(t)
+	p.Section = "utils"
+
+	if warnings := p.Warnings(); len(warnings) != 0 {
+		t.Fatalf("Expected no warnings; found %+v", warnings)
+	}
+
+	p.Files = map[string]string{
+		"package/binary": "/user/bin/binary",
+		"package/other":  "/user/bin/other",
+	}
+	warnings := p.Warnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "/user") {
+		t.Fatalf("Expected one warning for /user; found %+v", warnings)
+	}
+
+	p.ExtraRootDirs = []string{"user"}
+	if warnings := p.Warnings(); len(warnings) != 0 {
+		t.Errorf("Expected no warnings; found %+v", warnings)
+	}
+}
+
+func TestBuildWithStats(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.Force = true
+
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+	stats, err := p.BuildWithStats("output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for phase, duration := range map[string]time.Duration{
+		"control archive": stats.ControlArchive,
+		"data archive":    stats.DataArchive,
+		"assembly":        stats.Assembly,
+	} {
+		if duration <= 0 {
+			t.Errorf("Expected %s duration to be recorded, found %s", phase, duration)
+		}
+	}
+}
+
+func TestWarningsWorldWritable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "var", "lib", "tool"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	shared := filepath.Join(dir, "var", "lib", "tool", "shared")
+	if err := ioutil.WriteFile(shared, []byte("data\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Chmod so the umask doesn't change the mode
+	if err := os.Chmod(shared, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	p := WarningsFixture(t)
+	p.Section = "utils"
+	p.AutoPath = dir
+
+	warnings := p.Warnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "/var/lib/tool/shared is world-writable") {
+		t.Fatalf("Expected one world-writable warning; found %+v", warnings)
+	}
+
+	p.AllowWorldWritable = []string{"/var/lib/tool/shared"}
+	if warnings := p.Warnings(); len(warnings) != 0 {
+		t.Errorf("Expected no warnings; found %+v", warnings)
+	}
+}
+
+func TestListControlFiles(t *testing.T) {
+	p := PackageSpecFixture(t)
+
+	files := p.MapControlFiles()
+
+	search := "preinst"
+	expected := "test-fixtures/package1/preinst"
+	if found, ok := files[search]; !ok {
+		t.Errorf("Unable to find %q in %+v", search, files)
+	} else if found != expected {
+		t.Fatalf("Expected %q, found %q", expected, found)
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	p := PackageSpecFixture(t)
+
+	files, err := p.ListFiles(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configPath := path.Join("test-fixtures", "package1", "etc", "package1", "config")
+	if !hasString(files, configPath) {
+		t.Errorf("%q is missing: %+v", configPath, files)
+	}
+
+	binaryPath := path.Join("test-fixtures", "package1", "usr", "local", "bin", "package1")
+	if !hasString(files, binaryPath) {
+		t.Errorf("%q is missing: %+v", binaryPath, files)
+	}
+}
+
+func TestListArchivePaths(t *testing.T) {
+	p := PackageSpecFixture(t)
+	fsys := MapFSFixture()
+	fsys["bin/hello-tool"] = &fstest.MapFile{Data: []byte("tool\n"), Mode: 0755}
+	p.FS = fsys
+	p.AutoPath = "deb-pkg"
+	p.Files = map[string]string{"bin/hello-tool": "/usr/local/bin/hello-tool"}
+
+	paths, err := p.ListArchivePaths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"etc/hello/settings", "usr/bin/hello", "usr/local/bin/hello-tool"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected paths %+v, found %+v", expected, paths)
+	}
+
+	// RemoteFiles are listed before they are downloaded, and files that will
+	// be compressed are listed with .gz added
+	fsys["deb-pkg/usr/share/doc/hello/manual.txt"] = &fstest.MapFile{Data: bytes.Repeat([]byte("manual\n"), 200), Mode: 0644}
+	p.CompressOver = 1024
+	p.CompressExtensions = []string{".txt"}
+	p.RemoteFiles = map[string]string{"https://example.com/hello.1": "/usr/share/man/man1/hello.1"}
+	paths, err = p.ListArchivePaths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"etc/hello/settings", "usr/bin/hello", "usr/local/bin/hello-tool", "usr/share/doc/hello/manual.txt.gz", "usr/share/man/man1/hello.1"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected paths %+v, found %+v", expected, paths)
+	}
+}
+
+func TestListFilesRootTree(t *testing.T) {
+	p := PackageSpecFixture(t)
+	root := path.Join("test-fixtures", "root-tree")
+	p.AutoPath = root
+	p.RootTree = true
+
+	files, err := p.ListFiles(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := []string{}
+	for _, file := range files {
+		target, err := p.NormalizeFilename(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	expected := []string{"usr/bin/foo", "usr/share/foo/examples/postinst"}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("Expected files %+v, found %+v", expected, targets)
+	}
+
+	scripts := p.MapControlFiles()
+	if scripts["preinst"] != path.Join(root, "DEBIAN", "preinst") || len(scripts) != 1 {
+		t.Errorf("Expected preinst from DEBIAN, found %+v", scripts)
+	}
+}
+
+func TestListConffilesRootTree(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.AutoPath = path.Join("test-fixtures", "root-tree")
+	p.RootTree = true
+
+	confFiles, err := p.ListConffiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"/usr/share/foo/examples/postinst"}
+	if !reflect.DeepEqual(confFiles, expected) {
+		t.Errorf("Expected conffiles from DEBIAN/conffiles %+v, found %+v", expected, confFiles)
+	}
+}
+
+func TestListFilesExclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{
+		"usr/bin/tool",
+		"usr/bin/tool~",
+		"usr/bin/.tool.swp",
+		"usr/share/tool/notes.bak",
+		".git/config",
+		"usr/share/tool/.svn/entries",
+	} {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := PackageSpecFixture(t)
+	p.AutoPath = dir
+	p.Exclude = []string{"*.bak"}
+
+	files, err := p.ListFiles(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := filepath.Join(dir, "usr", "bin", "tool")
+	if len(files) != 1 || files[0] != expected {
+		t.Errorf("Expected only %q, found %+v", expected, files)
+	}
+
+	// Default excludes can be disabled
+	p.Exclude = nil
+	p.NoDefaultExcludes = true
+	files, err = p.ListFiles(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 6 {
+		t.Errorf("Expected 6 files, found %+v", files)
+	}
+}
+
+func TestCalculateSize(t *testing.T) {
+	p := PackageSpecFixture(t)
+
+	// find deb/test-fixtures/package1/ | xargs cat 2>/dev/null | wc -c
+	// divide by 1024 and round up remainder to go from bytes => kilobytes
+	expected := int64(1)
+
+	size, err := p.CalculateSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != expected {
+		t.Errorf("Expected %d got %d", expected, size)
+	}
+}
+
+func TestNormalizeFilenameAutoPath(t *testing.T) {
+	p := PackageSpecFixture(t)
+
+	configPath := path.Join("test-fixtures", "package1", "etc", "package1", "config")
+	configExpected := "etc/package1/config"
+	if filename, err := p.NormalizeFilename(configPath); err != nil {
+		t.Fatal()
+	} else if filename != configExpected {
+		t.Errorf("Expected %q got %q", configExpected, filename)
+	}
+}
+
+func TestNormalizeFilenameFileMap(t *testing.T) {
+	p := PackageSpecFixture(t)
+
+	hardcodedPath := "something/magic"
+	p.Files = map[string]string{
+		hardcodedPath: "/usr/local/bin/magic",
+	}
+
+	hardcodedExpected := "usr/local/bin/magic"
+	if filename, err := p.NormalizeFilename(hardcodedPath); err != nil {
+		t.Fatal(err)
+	} else if filename != hardcodedExpected {
+		t.Errorf("Expected %q got %q", hardcodedExpected, filename)
+	}
+}
+
+func TestNormalizeFilenameBackslashes(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Prefix = `\opt\vendor`
+	p.Files = map[string]string{
+		`build\tool`: `\usr\bin\tool`,
+	}
+
+	expected := "opt/vendor/usr/bin/tool"
+	if filename, err := p.NormalizeFilename(`build\tool`); err != nil {
+		t.Fatal(err)
+	} else if filename != expected {
+		t.Errorf("Expected %q got %q", expected, filename)
+	}
+
+	p.ArchiveFiles = map[string]string{
+		"upstream-1.0/bin/upstream": `\usr\bin\upstream`,
+	}
+	if target := p.targetPath(p.ArchiveFiles["upstream-1.0/bin/upstream"]); target != "opt/vendor/usr/bin/upstream" {
+		t.Errorf("Expected %q got %q", "opt/vendor/usr/bin/upstream", target)
+	}
+}
+
+func TestNormalizeFilenameAbsoluteSource(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.AutoPath = "-"
+
+	source, err := filepath.Abs(path.Join("test-fixtures", "package1", "usr", "local", "bin", "package1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Files = map[string]string{
+		source: "/usr/bin/package1",
+	}
+
+	expected := "usr/bin/package1"
+	for _, name := range []string{source, filepath.Dir(source) + "//./package1"} {
+		if filename, err := p.NormalizeFilename(name); err != nil {
+			t.Fatal(err)
+		} else if filename != expected {
+			t.Errorf("Expected %q got %q", expected, filename)
+		}
+	}
+
+	// Paths outside of AutoPath and not in Files can't be mapped
+	p.AutoPath = path.Join("test-fixtures", "package1")
+	if _, err := p.NormalizeFilename("/somewhere/else"); err == nil {
+		t.Errorf("Expected an error for a file outside of autopath")
+	}
+	p.AutoPath = "-"
+
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+	if err := p.Build("output"); err != nil {
+		t.Fatal(err)
+	}
+	_, contents := readDeb(t, filename)
+	headers, _ := readTarGzData(t, bytes.NewReader(contents["data.tar.gz"]))
+	if _, ok := headers[expected]; !ok || len(headers) != 1 {
+		t.Errorf("Expected only %s in the data archive, found %+v", expected, headers)
+	}
+}
+
+func TestDuplicateDetector(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Files = map[string]string{
+		"package/binary": "/usr/local/bin/package1",
+	}
+
+	_, err := p.ListFiles(false)
+	if err == nil || !strings.Contains(err.Error(), "Duplicate") {
+		t.Fatalf("Expected duplicate file error; found %+v", err)
+	}
+}
+
+func TestFileDirectoryConflictDetector(t *testing.T) {
+	p := PackageSpecFixture(t)
+
+	// A file from Files where AutoPath has a directory
+	p.Files = map[string]string{
+		"package/binary": "/usr/local/bin",
+	}
+	_, err := p.ListFiles(false)
+	if err == nil || !strings.Contains(err.Error(), "Conflicting") {
+		t.Errorf("Expected conflicting file error; found %+v", err)
+	}
+
+	// A file from Files inside a path AutoPath has as a file
+	p.Files = map[string]string{
+		"package/plugin": "/usr/local/bin/package1/plugin",
+	}
+	_, err = p.ListFiles(false)
+	if err == nil || !strings.Contains(err.Error(), "Conflicting") {
+		t.Errorf("Expected conflicting file error; found %+v", err)
+	}
+
+	// Two files in the same directory are fine
+	p.Files = map[string]string{
+		"package/other": "/usr/local/bin/other",
+	}
+	if _, err = p.ListFiles(true); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCaseInsensitiveDuplicates(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Files = map[string]string{
+		"package/foo": "/etc/Foo",
+		"package/bar": "/etc/foo",
+	}
+
+	// Paths differing by case are distinct by default
+	if _, err := p.ListFiles(false); err != nil {
+		t.Error(err)
+	}
+
+	p.CaseInsensitiveDuplicates = true
+	_, err := p.ListFiles(false)
+	if err == nil || !strings.Contains(err.Error(), "Duplicate") {
+		t.Errorf("Expected duplicate file error; found %+v", err)
+	}
+}
+
+func TestControlNameCollisions(t *testing.T) {
+	p := PackageSpecFixture(t)
+
+	// A data file installed with the name of a control archive member
+	p.Files = map[string]string{
+		"package/binary": "/md5sums",
+	}
+	_, err := p.ListFiles(false)
+	if err == nil || !strings.Contains(err.Error(), "reserved for the control archive") {
+		t.Errorf("Expected reserved name error; found %+v", err)
+	}
+
+	// The same name is fine in a subdirectory
+	p.Files = map[string]string{
+		"package/binary": "/usr/share/package1/md5sums",
+	}
+	if _, err := p.ListFiles(false); err != nil {
+		t.Error(err)
+	}
+
+	// A control file at the top of AutoPath that is not a script
+	fsys := MapFSFixture()
+	fsys["deb-pkg/control"] = &fstest.MapFile{Data: []byte("Package: hello\n")}
+	p.FS = fsys
+	p.AutoPath = "deb-pkg"
+	p.Files = nil
+	_, err = p.ListFiles(false)
+	if err == nil || !strings.Contains(err.Error(), "reserved for the control archive") {
+		t.Errorf("Expected reserved name error for AutoPath; found %+v", err)
+	}
+}
+
+func TestControlScriptListedAsData(t *testing.T) {
+	p := PackageSpecFixture(t)
+	preinst := path.Join("test-fixtures", "package1", "preinst")
+	if p.MapControlFiles()["preinst"] != preinst {
+		t.Fatalf("Expected preinst from AutoPath, found %+v", p.MapControlFiles())
+	}
+
+	p.Files = map[string]string{
+		preinst: "/usr/share/package1/preinst",
+	}
+	_, err := p.ListFiles(false)
+	if err == nil || !strings.Contains(err.Error(), "preinst control script") {
+		t.Errorf("Expected control script collision error; found %+v", err)
+	}
+
+	// The same goes for a script set explicitly
+	p.Files = map[string]string{
+		"scripts/postinst": "/usr/share/package1/postinst",
+	}
+	p.Postinst = "scripts/postinst"
+	_, err = p.ListFiles(false)
+	if err == nil || !strings.Contains(err.Error(), "postinst control script") {
+		t.Errorf("Expected control script collision error; found %+v", err)
+	}
+}
+
+func TestListEtcFiles(t *testing.T) {
+	p := PackageSpecFixture(t)
+
+	files, err := p.ListEtcFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) == 0 {
+		t.Fatalf("No config files found")
+	}
+
+	expected := "/etc/package1/config"
+	if files[0] != expected {
+		t.Errorf("Expected %q got %q", expected, files[0])
+	}
+}
+
+func TestListEtcFilesSorted(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Files = map[string]string{}
+	for _, name := range []string{"zeta", "alpha", "mu", "beta", "omega", "gamma"} {
+		p.Files["config-"+name] = "/etc/package1/" + name
+	}
+
+	expected := "/etc/package1/alpha,/etc/package1/beta,/etc/package1/config,/etc/package1/gamma,/etc/package1/mu,/etc/package1/omega,/etc/package1/zeta"
+
+	// Run this a few times since map iteration order is random
+	for i := 0; i < 10; i++ {
+		files, err := p.ListEtcFiles()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found := strings.Join(files, ","); found != expected {
+			t.Fatalf("Expected %s, found %s", expected, found)
+		}
+	}
+}
+
+func TestPreserveConfigs(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Files = map[string]string{
+		"config-alpha": "/etc/package1/alpha",
+		"config-beta":  "/etc/package1/beta",
+	}
+	p.PreserveConfigs = []string{"/etc/package1/alpha"}
+
+	// Without UpgradeConfigs the listed files are upgraded
+	files, err := p.ListEtcFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "/etc/package1/beta,/etc/package1/config"
+	if found := strings.Join(files, ","); found != expected {
+		t.Errorf("Expected %s, found %s", expected, found)
+	}
+
+	// With UpgradeConfigs only the listed files are preserved
+	p.UpgradeConfigs = true
+	files, err = p.ListEtcFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "/etc/package1/alpha"
+	if found := strings.Join(files, ","); found != expected {
+		t.Errorf("Expected %s, found %s", expected, found)
+	}
+
+	p.PreserveConfigs = []string{"/opt/package1/config"}
+	if err := p.Validate(false); err == nil || !strings.Contains(err.Error(), "is not under /etc") {
+		t.Errorf("Expected preserved config outside /etc to be invalid, found %v", err)
+	}
+}
+
+func TestUpgradeConfig(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.UpgradeConfigs = true
+
+	data, err := p.ListEtcFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data) != 0 {
+		t.Errorf("Found unexpected config files in conffiles list: %+v", data)
+	}
+}
+
+func TestListConffiles(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.Files = map[string]string{
+		path.Join("test-fixtures", "conffiles", "config.yml"): "/opt/app/config.yml",
+	}
+	p.Conffiles = []string{"/opt/app/config.yml"}
+
+	files, err := p.ListConffiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"/etc/package1/config", "/opt/app/config.yml"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %+v, found %+v", expected, files)
+	}
+
+	// UpgradeConfigs only applies to config files found under /etc
+	p.UpgradeConfigs = true
+	files, err = p.ListConffiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"/opt/app/config.yml"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %+v, found %+v", expected, files)
+	}
+
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	controlFile := filepath.Join(dir, "control.tar.gz")
+	if err := p.CreateControlArchive(controlFile); err != nil {
+		t.Fatal(err)
+	}
+	_, contents := readTarGz(t, controlFile)
+	if found := string(contents["conffiles"]); found != "/opt/app/config.yml\n" {
+		t.Errorf("Expected conffiles to list /opt/app/config.yml, found %q", found)
+	}
+
+	p.Conffiles = []string{"/opt/app/missing.yml"}
+	_, err = p.ListConffiles()
+	if err == nil || !strings.Contains(err.Error(), "not included in the package") {
+		t.Errorf("Expected missing conffile error; found %+v", err)
+	}
+}
+
+func TestMD5SumFile(t *testing.T) {
+	sum, err := (&PackageSpec{}).md5SumFile(path.Join("test-fixtures", "example-depends.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "77d87ca6af3e6710a1faf86aaed5b800"
+	if sum != expected {
+		t.Errorf("Expected %q got %q", expected, sum)
+	}
+}
+
+func TestCalculateChecksums(t *testing.T) {
+	p := PackageSpecFixture(t)
+
+	expected := `adcc07f30ee844b18eab61f69f8c32c4  etc/package1/config
+0940b4d946e3e2b8bbfdf5cfcf722518  usr/local/bin/package1
+`
+
+	data, err := p.CalculateChecksums()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := string(data)
+	if found != expected {
+		t.Errorf("--Expected--\n%s\n--Found--\n%s\n", expected, found)
+	}
+}
+
+func TestCalculateSha256Checksums(t *testing.T) {
+	p := PackageSpecFixture(t)
+
+	expected := `45355ce794ed416dd2929a00b7b8dabaa1cb24e224ae3ce66bc552c97bb6fcb0  etc/package1/config
+dc5023da204bc8fce5bfaa668bee3d63c523e94ba2f2528e023d5779c44869c1  usr/local/bin/package1
+`
+
+	data, err := p.CalculateSha256Checksums()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := string(data)
+	if found != expected {
+		t.Errorf("--Expected--\n%s\n--Found--\n%s\n", expected, found)
+	}
+
+	// sha256sums is only added to the control archive if requested
+	buf := &bytes.Buffer{}
+	if err := p.WriteControlArchive(buf); err != nil {
+		t.Fatal(err)
+	}
+	_, contents := readTarGzData(t, buf)
+	if _, ok := contents["sha256sums"]; ok {
+		t.Errorf("Expected no sha256sums in the control archive")
+	}
+
+	p.Sha256Sums = true
+	buf.Reset()
+	if err := p.WriteControlArchive(buf); err != nil {
+		t.Fatal(err)
+	}
+	_, contents = readTarGzData(t, buf)
+	if found := string(contents["sha256sums"]); found != expected {
+		t.Errorf("--Expected sha256sums--\n%s\n--Found--\n%s\n", expected, found)
+	}
+	if _, ok := contents["md5sums"]; !ok {
+		t.Errorf("Expected md5sums in the control archive")
+	}
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	binary := path.Join("test-fixtures", "package1", "usr", "local", "bin", "package1")
+
+	p.Checksums = map[string]string{
+		binary: "DC5023DA204BC8FCE5BFAA668BEE3D63C523E94BA2F2528E023D5779C44869C1",
+	}
+	if err := p.VerifyChecksums(); err != nil {
+		t.Error(err)
+	}
+
+	p.Checksums = map[string]string{
+		binary: "45355ce794ed416dd2929a00b7b8dabaa1cb24e224ae3ce66bc552c97bb6fcb0",
+	}
+	err := p.VerifyChecksums()
+	if err == nil || !strings.Contains(err.Error(), "Checksum mismatch") {
+		t.Errorf("Expected checksum mismatch; found %+v", err)
+	}
+
+	// Build should refuse to package the file
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+	err = p.Build("output")
+	if err == nil || !strings.Contains(err.Error(), "Checksum mismatch") {
+		t.Errorf("Expected checksum mismatch; found %+v", err)
+	}
+	if FileExists(filename) {
+		t.Errorf("Expected %s not to be built", filename)
+	}
+
+	p.Checksums = map[string]string{
+		"missing": "45355ce794ed416dd2929a00b7b8dabaa1cb24e224ae3ce66bc552c97bb6fcb0",
+	}
+	err = p.VerifyChecksums()
+	if err == nil || !strings.Contains(err.Error(), "not included") {
+		t.Errorf("Expected missing file error; found %+v", err)
+	}
+}
+
+func TestCreateDataArchive(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.TempPath = "test-fixtures"
+
+	filename := "test-data.tar.gz"
+	if err := p.CreateDataArchive(filename); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filename)
+}
+
+func TestCreateControlArchive(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.TempPath = "test-fixtures"
+
+	filename := "test-control.tar.gz"
+	if err := p.CreateControlArchive(filename); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+}
+
+func TestWriteDataArchive(t *testing.T) {
+	p := PackageSpecFixture(t)
+
+	buf := &bytes.Buffer{}
+	if err := p.WriteDataArchive(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	headers, contents := readTarGzData(t, buf)
+	expected, err := ioutil.ReadFile(path.Join("test-fixtures", "package1", "usr", "local", "bin", "package1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := headers["usr/local/bin/package1"]; !ok {
+		t.Fatalf("Expected usr/local/bin/package1 in the data archive, found %+v", headers)
+	}
+	if string(contents["usr/local/bin/package1"]) != string(expected) {
+		t.Errorf("Expected %q, found %q", expected, contents["usr/local/bin/package1"])
+	}
+	if _, ok := headers["preinst"]; ok {
+		t.Errorf("Expected control scripts to be left out of the data archive")
+	}
+}
+
+func TestWriteControlArchive(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+
+	buf := &bytes.Buffer{}
+	if err := p.WriteControlArchive(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	_, contents := readTarGzData(t, buf)
+	control, err := p.RenderControlFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents["control"]) != string(control) {
+		t.Errorf("Expected control:\n%s\nFound:\n%s", control, contents["control"])
+	}
+	for _, name := range []string{"md5sums", "conffiles", "preinst"} {
+		if _, ok := contents[name]; !ok {
+			t.Errorf("Expected %s in the control archive", name)
+		}
+	}
+}
+
+func TestCreateControlArchiveScripts(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Postinst = "#!/bin/sh\necho installed\n"
+
+	filename := "test-control.tar.gz"
+	if err := p.CreateControlArchive(filename); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+
+	headers, contents := readTarGz(t, filename)
+
+	// preinst is read from a file in AutoPath
+	expected := "#!/bin/sh\necho \"We are ready to install\"\n"
+	if found := string(contents["preinst"]); found != expected {
+		t.Errorf("Expected preinst %q, found %q", expected, found)
+	}
+
+	// postinst is specified inline
+	if found := string(contents["postinst"]); found != p.Postinst {
+		t.Errorf("Expected postinst %q, found %q", p.Postinst, found)
+	}
+
+	for _, name := range []string{"preinst", "postinst"} {
+		if header, ok := headers[name]; !ok {
+			t.Errorf("%s is missing from control archive", name)
+		} else if header.Mode != 0755 {
+			t.Errorf("Expected %s to have mode 0755, found %o", name, header.Mode)
+		}
+	}
+}
+
+func TestCreateControlArchiveTemplateScripts(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.Postinst = "#!/bin/sh\necho {{.Package}} {{.Version}} installed\n"
+
+	filename := "test-control.tar.gz"
+	defer os.Remove(filename)
+
+	// Templates are not rendered unless TemplateScripts is enabled
+	if err := p.CreateControlArchive(filename); err != nil {
+		t.Fatal(err)
+	}
+	_, contents := readTarGz(t, filename)
+	if found := string(contents["postinst"]); found != p.Postinst {
+		t.Errorf("Expected postinst %q, found %q", p.Postinst, found)
+	}
+
+	p.TemplateScripts = true
+	if err := p.CreateControlArchive(filename); err != nil {
+		t.Fatal(err)
+	}
+	_, contents = readTarGz(t, filename)
+	expected := "#!/bin/sh\necho mkdeb 0.1.0 installed\n"
+	if found := string(contents["postinst"]); found != expected {
+		t.Errorf("Expected postinst %q, found %q", expected, found)
+	}
+}
+
+func TestCalculateSizeSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// usr/bin/tool is a link to another packaged file, usr/lib/tool/tool
+	libDir := filepath.Join(dir, "usr", "lib", "tool")
+	binDir := filepath.Join(dir, "usr", "bin")
+	for _, d := range []string{libDir, binDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := bytes.Repeat([]byte("x"), 2048)
+	if err := ioutil.WriteFile(filepath.Join(libDir, "tool"), data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../lib/tool/tool", filepath.Join(binDir, "tool")); err != nil {
+		t.Fatal(err)
+	}
+
+	p := PackageSpecFixture(t)
+	p.AutoPath = dir
+
+	// The link is replaced by a copy of the file, so it is counted twice
+	size, err := p.CalculateSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := int64(4); size != expected {
+		t.Errorf("Expected %d got %d", expected, size)
+	}
+
+	// The link is written as a link, so only the file is counted
+	p.PreserveSymlinks = true
+	size, err = p.CalculateSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := int64(2); size != expected {
+		t.Errorf("Expected %d got %d", expected, size)
+	}
+}
+
+func TestCalculateChecksumsRegularFilesOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	appDir := filepath.Join(dir, "usr", "share", "app")
+	if err := os.MkdirAll(filepath.Join(appDir, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(appDir, "file"), []byte("data\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("file", filepath.Join(appDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	p := PackageSpecFixture(t)
+	p.AutoPath = dir
+	p.PreserveSymlinks = true
+
+	sums, err := p.CalculateChecksums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf("%x  usr/share/app/file\n", md5.Sum([]byte("data\n")))
+	if string(sums) != expected {
+		t.Errorf("Expected only the regular file in md5sums\n%s\n--Found--\n%s", expected, sums)
+	}
+
+	// Without PreserveSymlinks the link is packaged as a copy of the file
+	p.PreserveSymlinks = false
+	sums, err = p.CalculateChecksums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(sums), "  usr/share/app/link\n") {
+		t.Errorf("Expected the copied link in md5sums\n%s", sums)
+	}
+}
+
+func TestCalculateSizeInlineScript(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.AutoPath = "-"
+	p.Files = map[string]string{
+		path.Join("test-fixtures", "example-basic.json"): "/usr/share/mkdeb/example.json",
+	}
+	p.Postinst = "#!/bin/sh\n" + strings.Repeat("#", 1024)
+
+	size, err := p.CalculateSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := int64(2); size != expected {
+		t.Errorf("Expected %d got %d", expected, size)
+	}
+}
+
+func TestCalculateSizeTemplateScripts(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.AutoPath = "-"
+	p.Files = map[string]string{
+		path.Join("test-fixtures", "example-basic.json"): "/usr/share/mkdeb/example.json",
+	}
+	p.Description = strings.Repeat("x", 2048)
+	p.Postinst = "#!/bin/sh\n# {{.Description}}\n"
+
+	// The rendered script is counted, not the template
+	p.TemplateScripts = true
+	size, err := p.CalculateSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := int64(3); size != expected {
+		t.Errorf("Expected %d got %d", expected, size)
+	}
+}
+
+// failingWriter accepts a limited number of bytes and then returns an error
+type failingWriter struct {
+	remaining int
+}
+
+func (w *failingWriter) Write(data []byte) (int, error) {
+	if len(data) > w.remaining {
+		n := w.remaining
+		w.remaining = 0
+		return n, errors.New("disk full")
+	}
+	w.remaining -= len(data)
+	return len(data), nil
+}
+
+func TestWriteControlFilesError(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+
+	// Fail in the middle of each file written to the control archive
+	for _, limit := range []int{0, 600, 1200, 1800, 2400} {
+		archive := tar.NewWriter(&failingWriter{remaining: limit})
+		err := p.writeControlFiles(archive)
+		if err == nil || !strings.Contains(err.Error(), "disk full") {
+			t.Errorf("Expected write error with limit %d; found %+v", limit, err)
+		}
+	}
+}
+
+func TestCreateArchives(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+
+	dir, err := ioutil.TempDir("", "mkdeb")
 	if err != nil {
-		t.Fatalf("Failed to load fixture: %s", err)
+		t.Fatal(err)
 	}
-	p.AutoPath = path.Join("test-fixtures", "package1")
-	return p
-}
+	defer os.RemoveAll(dir)
 
-func TestDefaultPackageSpec(t *testing.T) {
-	p := DefaultPackageSpec()
-	expected := "deb-pkg"
-	if p.AutoPath != expected {
-		t.Fatalf("Expected AutoPath to be %q, got %q", expected, p.AutoPath)
+	// Create the archives serially and in parallel and compare the results
+	serialControl := filepath.Join(dir, "serial-control.tar.gz")
+	serialData := filepath.Join(dir, "serial-data.tar.gz")
+	if err := p.CreateControlArchive(serialControl); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.CreateDataArchive(serialData); err != nil {
+		t.Fatal(err)
 	}
-}
 
-func TestFilename(t *testing.T) {
-	p := &PackageSpec{
-		Package:      "mkdeb",
-		Version:      "0.1.0",
-		Architecture: "amd64",
+	control := filepath.Join(dir, "control.tar.gz")
+	data := filepath.Join(dir, "data.tar.gz")
+	if err := p.createArchives(control, data, &BuildStats{}); err != nil {
+		t.Fatal(err)
 	}
-	expected := "mkdeb-0.1.0-amd64.deb"
-	if p.Filename() != expected {
-		t.Fatalf("Expected filename to be %q, got %q", expected, p.Filename())
+
+	for serial, parallel := range map[string]string{serialControl: control, serialData: data} {
+		serialHeaders, serialContents := readTarGz(t, serial)
+		headers, contents := readTarGz(t, parallel)
+		if len(headers) != len(serialHeaders) {
+			t.Errorf("Expected %d files in %s, found %d", len(serialHeaders), parallel, len(headers))
+		}
+		for name, header := range serialHeaders {
+			if found, ok := headers[name]; !ok {
+				t.Errorf("%s is missing from %s", name, parallel)
+			} else if found.Mode != header.Mode || found.Size != header.Size {
+				t.Errorf("Expected %s header %+v, found %+v", name, header, found)
+			}
+			if string(contents[name]) != string(serialContents[name]) {
+				t.Errorf("Expected %s to contain %q, found %q", name, serialContents[name], contents[name])
+			}
+		}
 	}
 }
 
-func TestValidate(t *testing.T) {
+func TestCreateArchivesError(t *testing.T) {
 	p := PackageSpecFixture(t)
 	p.Version = "0.1.0"
+	p.Postinst = "missing-postinst"
 
-	if err := p.Validate(true); err != nil {
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
 		t.Fatal(err)
 	}
+	defer os.RemoveAll(dir)
 
-	p2 := &PackageSpec{}
-	err := p2.Validate(true)
-	expected := "These required fields are missing: package, version, architecture, maintainer, description"
-	if err.Error() != expected {
-		t.Fatalf("-- Expected --\n%s\n-- Found --\n%s\n", expected, err.Error())
+	err = p.createArchives(filepath.Join(dir, "control.tar.gz"), filepath.Join(dir, "data.tar.gz"), &BuildStats{})
+	if err == nil || !strings.Contains(err.Error(), "missing-postinst") {
+		t.Fatalf("Expected control archive error; found %+v", err)
 	}
 }
 
-func TestListControlFiles(t *testing.T) {
+func TestBuild(t *testing.T) {
 	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
 
-	files := p.MapControlFiles()
-
-	search := "preinst"
-	expected := "test-fixtures/package1/preinst"
-	if found, ok := files[search]; !ok {
-		t.Errorf("Unable to find %q in %+v", search, files)
-	} else if found != expected {
-		t.Fatalf("Expected %q, found %q", expected, found)
+	err := p.Build("output")
+	defer os.Remove(path.Join("output", p.Filename()))
+	if err != nil {
+		t.Fatal(err)
 	}
 }
 
-func TestListFiles(t *testing.T) {
+func TestBuildExistingOutput(t *testing.T) {
 	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
 
-	files, err := p.ListFiles(false)
-	if err != nil {
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+
+	if err := os.MkdirAll("output", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, []byte("not a package"), 0644); err != nil {
 		t.Fatal(err)
 	}
 
-	configPath := path.Join("test-fixtures", "package1", "etc", "package1", "config")
-	if !hasString(files, configPath) {
-		t.Errorf("%q is missing: %+v", configPath, files)
+	// Refuse to overwrite the existing file
+	err := p.Build("output")
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("Expected already exists error; found %+v", err)
+	}
+	if data, err := ioutil.ReadFile(filename); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "not a package" {
+		t.Errorf("Expected %s to be left alone, found %q", filename, data)
 	}
 
-	binaryPath := path.Join("test-fixtures", "package1", "usr", "local", "bin", "package1")
-	if !hasString(files, binaryPath) {
-		t.Errorf("%q is missing: %+v", binaryPath, files)
+	// Overwrite it when forced
+	p.Force = true
+	if err := p.Build("output"); err != nil {
+		t.Fatal(err)
+	}
+	headers, _ := readDeb(t, filename)
+	if len(headers) != 3 {
+		t.Errorf("Expected %s to be replaced with a package, found %d ar members", filename, len(headers))
 	}
 }
 
-func TestCalculateSize(t *testing.T) {
+func TestBuildKeepIntermediate(t *testing.T) {
 	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
 
-	// find deb/test-fixtures/package1/ | xargs cat 2>/dev/null | wc -c
-	// divide by 1024 and round up remainder to go from bytes => kilobytes
-	expected := int64(1)
-
-	size, err := p.CalculateSize()
+	tempPath, err := ioutil.TempDir("", "mkdeb")
 	if err != nil {
 		t.Fatal(err)
 	}
-	if size != expected {
-		t.Errorf("Expected %d got %d", expected, size)
+	defer os.RemoveAll(tempPath)
+	p.TempPath = tempPath
+
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+
+	// By default the workspace is removed
+	if err := p.Build("output"); err != nil {
+		t.Fatal(err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(tempPath, "*", "*.tar.gz")); len(matches) != 0 {
+		t.Errorf("Expected intermediate files to be removed, found %+v", matches)
 	}
-}
 
-func TestNormalizeFilenameAutoPath(t *testing.T) {
-	p := PackageSpecFixture(t)
+	p.KeepIntermediate = true
+	p.Force = true
+	if err := p.Build("output"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"control.tar.gz", "data.tar.gz"} {
+		matches, _ := filepath.Glob(filepath.Join(tempPath, "*", name))
+		if len(matches) != 1 {
+			t.Errorf("Expected %s to be kept, found %+v", name, matches)
+		}
+	}
+}
 
-	configPath := path.Join("test-fixtures", "package1", "etc", "package1", "config")
-	configExpected := "etc/package1/config"
-	if filename, err := p.NormalizeFilename(configPath); err != nil {
-		t.Fatal()
-	} else if filename != configExpected {
-		t.Errorf("Expected %q got %q", configExpected, filename)
+func TestHumanSize(t *testing.T) {
+	for kib, expected := range map[int64]string{
+		0:                         "0 KiB",
+		1:                         "1 KiB",
+		1023:                      "1023 KiB",
+		1024:                      "1.0 MiB",
+		1434:                      "1.4 MiB",
+		1024*1024 - 52:            "1023.9 MiB",
+		1024*1024 - 51:            "1.0 GiB",
+		1024 * 1024:               "1.0 GiB",
+		5 * 1024 * 1024:           "5.0 GiB",
+		1024 * 1024 * 1024:        "1.0 TiB",
+		1024 * 1024 * 1024 * 2048: "2048.0 TiB",
+	} {
+		if found := HumanSize(kib); found != expected {
+			t.Errorf("Expected %d KiB to be %q, found %q", kib, expected, found)
+		}
 	}
 }
 
-func TestNormalizeFilenameFileMap(t *testing.T) {
+func TestSummary(t *testing.T) {
 	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
 
-	hardcodedPath := "something/magic"
-	p.Files = map[string]string{
-		hardcodedPath: "/usr/local/bin/magic",
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+
+	if _, err := p.Summary("output"); err == nil {
+		t.Errorf("Expected an error summarizing a package that wasn't built")
 	}
 
-	hardcodedExpected := "usr/local/bin/magic"
-	if filename, err := p.NormalizeFilename(hardcodedPath); err != nil {
+	if err := p.Build("output"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
 		t.Fatal(err)
-	} else if filename != hardcodedExpected {
-		t.Errorf("Expected %q got %q", hardcodedExpected, filename)
+	}
+
+	summary, err := p.Summary("output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf("Built package %s (2 files, 1 KiB installed, %d KiB package)", filename, (info.Size()+1023)/1024)
+	if summary != expected {
+		t.Errorf("Expected summary %q, found %q", expected, summary)
 	}
 }
 
-func TestDuplicateDetector(t *testing.T) {
+func TestBuildEmptyPackage(t *testing.T) {
 	p := PackageSpecFixture(t)
-	p.Files = map[string]string{
-		"package/binary": "/usr/local/bin/package1",
-	}
+	p.Version = "0.1.0"
+	p.AutoPath = "-"
+	p.Files = map[string]string{}
 
-	_, err := p.ListFiles(false)
-	if err == nil || !strings.Contains(err.Error(), "Duplicate") {
-		t.Fatalf("Expected duplicate file error; found %+v", err)
+	err := p.Build("output")
+	defer os.Remove(path.Join("output", p.Filename()))
+	if err == nil || !strings.Contains(err.Error(), "no files") {
+		t.Fatalf("Expected empty package error; found %+v", err)
 	}
 }
 
-func TestListEtcFiles(t *testing.T) {
+func TestBuildFormatVersion(t *testing.T) {
 	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
 
-	files, err := p.ListEtcFiles()
-	if err != nil {
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+
+	if err := p.Build("output"); err != nil {
 		t.Fatal(err)
 	}
+	_, contents := readDeb(t, filename)
+	if found := string(contents["debian-binary"]); found != "2.0\n" {
+		t.Errorf("Expected debian-binary %q, found %q", "2.0\n", found)
+	}
 
-	if len(files) == 0 {
-		t.Fatalf("No config files found")
+	p.FormatVersion = "2.1"
+	p.Force = true
+	if err := p.Build("output"); err != nil {
+		t.Fatal(err)
+	}
+	_, contents = readDeb(t, filename)
+	if found := string(contents["debian-binary"]); found != "2.1\n" {
+		t.Errorf("Expected debian-binary %q, found %q", "2.1\n", found)
 	}
 
-	expected := "/etc/package1/config"
-	if files[0] != expected {
-		t.Errorf("Expected %q got %q", expected, files[0])
+	p.FormatVersion = "two"
+	err := p.Build("output")
+	if err == nil || !strings.Contains(err.Error(), "Format version") {
+		t.Errorf("Expected format version error; found %+v", err)
 	}
 }
 
-func TestUpgradeConfig(t *testing.T) {
+func TestBuildPrefix(t *testing.T) {
 	p := PackageSpecFixture(t)
-	p.UpgradeConfigs = true
+	p.Version = "0.1.0"
+	p.Prefix = "/opt/vendor"
+	p.Files = map[string]string{
+		path.Join("test-fixtures", "example-basic.json"): "/share/example.json",
+	}
 
-	data, err := p.ListEtcFiles()
-	if err != nil {
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+
+	if err := p.Build("output"); err != nil {
 		t.Fatal(err)
 	}
 
-	if len(data) != 0 {
-		t.Errorf("Found unexpected config files in conffiles list: %+v", data)
+	_, contents := readDeb(t, filename)
+	headers, _ := readTarGzData(t, bytes.NewReader(contents["data.tar.gz"]))
+	for _, expected := range []string{
+		"opt/vendor/etc/package1/config",
+		"opt/vendor/usr/local/bin/package1",
+		"opt/vendor/share/example.json",
+	} {
+		if _, ok := headers[expected]; !ok {
+			t.Errorf("Expected %s in data archive", expected)
+		}
+	}
+	for name := range headers {
+		if !strings.HasPrefix(name, "opt/vendor") {
+			t.Errorf("Expected %s to be under the prefix", name)
+		}
 	}
-}
 
-func TestMD5SumFile(t *testing.T) {
-	sum, err := md5SumFile(path.Join("test-fixtures", "example-depends.json"))
+	// Files are no longer under /etc, so they aren't conffiles
+	etcFiles, err := p.ListEtcFiles()
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	expected := "77d87ca6af3e6710a1faf86aaed5b800"
-	if sum != expected {
-		t.Errorf("Expected %q got %q", expected, sum)
+	if len(etcFiles) != 0 {
+		t.Errorf("Expected no conffiles, found %+v", etcFiles)
 	}
 }
 
-func TestCalculateChecksums(t *testing.T) {
+func TestBuildClampMTime(t *testing.T) {
 	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.BuildTime = time.Date(2017, time.January, 2, 15, 4, 5, 0, time.UTC)
+	p.ClampMTime = true
 
-	expected := `adcc07f30ee844b18eab61f69f8c32c4  etc/package1/config
-0940b4d946e3e2b8bbfdf5cfcf722518  usr/local/bin/package1
-`
-
-	data, err := p.CalculateChecksums()
+	dir, err := ioutil.TempDir("", "mkdeb")
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer os.RemoveAll(dir)
 
-	found := string(data)
-	if found != expected {
-		t.Errorf("--Expected--\n%s\n--Found--\n%s\n", expected, found)
+	binary := filepath.Join(dir, "usr", "bin", "tool")
+	if err := os.MkdirAll(filepath.Dir(binary), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(binary, []byte("tool"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	p.AutoPath = dir
+	p.Force = true
+
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+
+	builds := [][]byte{}
+	for i, mtime := range []time.Time{time.Now(), time.Now().Add(-48 * time.Hour)} {
+		for _, name := range []string{binary, filepath.Dir(binary)} {
+			if err := os.Chtimes(name, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := p.Build("output"); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		builds = append(builds, data)
+
+		_, contents := readDeb(t, filename)
+		headers, _ := readTarGzData(t, bytes.NewReader(contents["data.tar.gz"]))
+		if header := headers["usr/bin/tool"]; header == nil || !header.ModTime.Equal(p.BuildTime) {
+			t.Errorf("Build %d: expected usr/bin/tool to have mtime %s, found %+v", i, p.BuildTime, header)
+		}
+	}
+
+	if !bytes.Equal(builds[0], builds[1]) {
+		t.Errorf("Expected identical packages when file mtimes change")
 	}
 }
 
-func TestCreateDataArchive(t *testing.T) {
+func TestBuildDate(t *testing.T) {
 	p := PackageSpecFixture(t)
-	p.TempPath = "test-fixtures"
+	p.Version = "0.1.0"
+	p.Date = "Wed, 01 May 2024 12:00:00 +0000"
+	p.Force = true
+	if err := p.Validate(true); err != nil {
+		t.Fatal(err)
+	}
+	expected := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
 
-	filename := "test-data.tar.gz"
-	if err := p.CreateDataArchive(filename); err != nil {
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+	if err := p.Build("output"); err != nil {
 		t.Fatal(err)
 	}
-	os.Remove(filename)
+
+	headers, contents := readDeb(t, filename)
+	for _, header := range headers {
+		if !header.ModTime.Equal(expected) {
+			t.Errorf("Expected %s to have mtime %s, found %s", header.Name, expected, header.ModTime)
+		}
+	}
+	dataHeaders, _ := readTarGzData(t, bytes.NewReader(contents["data.tar.gz"]))
+	if header := dataHeaders["usr/local/bin/package1"]; header == nil || !header.ModTime.Equal(expected) {
+		t.Errorf("Expected usr/local/bin/package1 to have mtime %s, found %+v", expected, header)
+	}
+	_, control := readTarGzData(t, bytes.NewReader(contents["control.tar.gz"]))
+	if strings.Contains(string(control["control"]), "Date:") {
+		t.Errorf("Expected no Date in control file\n%s", control["control"])
+	}
+
+	p.Date = "Wed, 1 May 2024 12:00:00 +0000"
+	if err := p.Validate(true); err != nil {
+		t.Errorf("Expected a single digit day to be valid: %s", err)
+	}
+	if date := p.buildTime(); !date.Equal(expected) {
+		t.Errorf("Expected build time %s, found %s", expected, date)
+	}
+
+	for _, date := range []string{"2024-05-01", "Wed, 01 May 2024 12:00:00 UTC", "yesterday"} {
+		p.Date = date
+		err := p.Validate(true)
+		if err == nil || !strings.Contains(err.Error(), "Date") {
+			t.Errorf("Expected %q to be invalid; found %+v", date, err)
+		}
+	}
 }
 
-func TestCreateControlArchive(t *testing.T) {
+func TestBuildArHeaders(t *testing.T) {
 	p := PackageSpecFixture(t)
-	p.TempPath = "test-fixtures"
+	p.Version = "0.1.0"
 
-	filename := "test-control.tar.gz"
-	if err := p.CreateControlArchive(filename); err != nil {
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+
+	if err := p.Build("output"); err != nil {
 		t.Fatal(err)
 	}
-	defer os.Remove(filename)
+
+	headers, _ := readDeb(t, filename)
+	if len(headers) != 3 {
+		t.Fatalf("Expected 3 ar members, found %d", len(headers))
+	}
+	for _, header := range headers {
+		if header.Mode != 0644 {
+			t.Errorf("Expected %s to have mode 0644, found %o", header.Name, header.Mode)
+		}
+	}
 }
 
-func TestBuild(t *testing.T) {
+func TestBuildArMemberNames(t *testing.T) {
 	p := PackageSpecFixture(t)
 	p.Version = "0.1.0"
 
-	err := p.Build("output")
-	defer os.Remove(path.Join("output", p.Filename()))
+	tempPath, err := ioutil.TempDir("", "mkdeb")
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer os.RemoveAll(tempPath)
+	p.TempPath = tempPath
+
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+
+	if err := p.Build("output"); err != nil {
+		t.Fatal(err)
+	}
+
+	headers, _ := readDeb(t, filename)
+	expected := []string{"debian-binary", "control.tar.gz", "data.tar.gz"}
+	if len(headers) != len(expected) {
+		t.Fatalf("Expected %d ar members, found %d", len(expected), len(headers))
+	}
+	for i, header := range headers {
+		if header.Name != expected[i] {
+			t.Errorf("Expected member %d to be %q, found %q", i, expected[i], header.Name)
+		}
+	}
 }
 
 func BenchmarkBuild(b *testing.B) {
@@ -263,3 +2025,24 @@ func BenchmarkBuild(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkCreateArchives(b *testing.B) {
+	p, err := NewPackageSpecFromFile(path.Join("test-fixtures", "example-basic.json"))
+	if err != nil {
+		b.Fatalf("Failed to load fixture: %s", err)
+	}
+	p.AutoPath = path.Join("test-fixtures", "package1")
+	p.Version = "0.1.0"
+	benchTmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(benchTmp)
+	control := filepath.Join(benchTmp, "control.tar.gz")
+	data := filepath.Join(benchTmp, "data.tar.gz")
+	for i := 0; i < b.N; i++ {
+		if err := p.createArchives(control, data, &BuildStats{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
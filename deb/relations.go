@@ -0,0 +1,48 @@
+package deb
+
+import (
+	"regexp"
+	"strings"
+)
+
+// reRelation matches a single package relationship with any amount of
+// whitespace, like "curl(>=7.0.0)" or "curl ( >= 7.0.0 )"
+var reRelation = regexp.MustCompile(`^([^\s(]+)\s*(?:\(\s*(<<|<=|>=|>>|=|<|>)\s*([^\s)]+)\s*\))?$`)
+
+// normalizeRelation trims whitespace from a package relationship and writes
+// the version constraint as "name (op version)". Alternatives separated by |
+// are normalized individually. Relationships that don't look like a package
+// name and version are only trimmed, so Validate can report them.
+func normalizeRelation(relation string) string {
+	alternatives := strings.Split(relation, "|")
+	for i, alternative := range alternatives {
+		alternative = strings.TrimSpace(alternative)
+		if match := reRelation.FindStringSubmatch(alternative); match != nil {
+			alternative = match[1]
+			if match[2] != "" {
+				alternative += " (" + match[2] + " " + match[3] + ")"
+			}
+		}
+		alternatives[i] = alternative
+	}
+	return strings.Join(alternatives, " | ")
+}
+
+// normalizeRelations normalizes each relationship in a list like Depends and
+// removes exact duplicates, keeping the first occurrence of each
+func normalizeRelations(relations []string) []string {
+	if relations == nil {
+		return nil
+	}
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, relation := range relations {
+		relation = normalizeRelation(relation)
+		if relation == "" || seen[relation] {
+			continue
+		}
+		seen[relation] = true
+		normalized = append(normalized, relation)
+	}
+	return normalized
+}
@@ -0,0 +1,116 @@
+package deb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// remoteClient is used to download RemoteFiles. The timeout covers the whole
+// download, so a stalled server can't hang the build forever.
+var remoteClient = &http.Client{Timeout: 10 * time.Minute}
+
+// FetchRemoteFiles downloads each of the RemoteFiles into dir so they can be
+// included in the package. If a URL has a #sha256= suffix the download is
+// verified against it. Build calls this automatically, but you will need to
+// call it yourself if you use ListFiles, CalculateSize, or CalculateChecksums
+// directly, or RemoteFiles will be left out.
+func (p *PackageSpec) FetchRemoteFiles(dir string) error {
+	if len(p.RemoteFiles) == 0 {
+		return nil
+	}
+
+	remoteDir := filepath.Join(dir, "remote")
+	if err := os.MkdirAll(remoteDir, 0755); err != nil {
+		return fmt.Errorf("Unable to create directory for remote files: %s", err)
+	}
+
+	p.fetchedFiles = map[string]string{}
+	i := 0
+	for url := range p.RemoteFiles {
+		// Prefix with a counter so files with the same name don't collide
+		filename := filepath.Join(remoteDir, fmt.Sprintf("%d-%s", i, path.Base(stripChecksum(url))))
+		if err := downloadFile(url, filename, p.RemoteFiles[url]); err != nil {
+			return err
+		}
+		p.fetchedFiles[filename] = url
+		i++
+	}
+	return nil
+}
+
+// downloadFile fetches url and writes it to filename, verifying the checksum
+// if one is specified in the URL. The download has no permissions of its own,
+// so it is made executable if dest is in a bin or sbin directory or the file
+// is a script or ELF binary. Its mtime is taken from Last-Modified, if the
+// server sends one, so it doesn't change every time the file is downloaded.
+func downloadFile(url, filename, dest string) error {
+	source := stripChecksum(url)
+	expected := ""
+	if i := strings.Index(url, "#sha256="); i >= 0 {
+		expected = strings.ToLower(url[i+len("#sha256="):])
+	}
+
+	resp, err := remoteClient.Get(source)
+	if err != nil {
+		return fmt.Errorf("Failed to download %q: %s", source, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Failed to download %q: server responded %s", source, resp.Status)
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("Failed to create %q: %s", filename, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hash), resp.Body); err != nil {
+		return fmt.Errorf("Failed to download %q: %s", source, err)
+	}
+
+	if expected != "" {
+		if found := hex.EncodeToString(hash.Sum(nil)); found != expected {
+			return fmt.Errorf("Checksum mismatch for %q: expected sha256 %s, found %s", source, expected, found)
+		}
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("Failed to stat %q: %s", filename, err)
+	}
+	magic := func() []byte {
+		magic := make([]byte, 4)
+		n, _ := file.ReadAt(magic, 0)
+		return magic[:n]
+	}
+	if err := file.Chmod(os.FileMode(defaultMode(dest, info, magic))); err != nil {
+		return fmt.Errorf("Failed to set mode on %q: %s", filename, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("Failed to write %q: %s", filename, err)
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		if err := os.Chtimes(filename, modified, modified); err != nil {
+			return fmt.Errorf("Failed to set mtime on %q: %s", filename, err)
+		}
+	}
+	return nil
+}
+
+// stripChecksum removes the optional #sha256= suffix from a remote file URL
+func stripChecksum(url string) string {
+	if i := strings.Index(url, "#sha256="); i >= 0 {
+		return url[:i]
+	}
+	return url
+}
@@ -0,0 +1,202 @@
+package deb
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// remoteModTime is the Last-Modified time RemoteServerFixture sends
+var remoteModTime = time.Date(2017, time.July, 26, 0, 0, 0, 0, time.UTC)
+
+func RemoteServerFixture() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", remoteModTime.Format(http.TimeFormat))
+		switch r.URL.Path {
+		case "/hello", "/tool":
+			w.Write([]byte("hello\n"))
+		case "/hello.sh":
+			w.Write([]byte("#!/bin/sh\necho hello\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestFetchRemoteFiles(t *testing.T) {
+	server := RemoteServerFixture()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := PackageSpecFixture(t)
+	p.RemoteFiles = map[string]string{
+		// echo hello | sha256sum
+		server.URL + "/hello#sha256=5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03": "/usr/share/hello",
+	}
+
+	if err := p.FetchRemoteFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	sums, err := p.CalculateChecksums()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// echo hello | md5sum
+	expected := "b1946ac92492d2347c6235b4d2611184  usr/share/hello\n"
+	if !strings.Contains(string(sums), expected) {
+		t.Errorf("Expected md5sums to contain %q\n%s", expected, sums)
+	}
+}
+
+func TestFetchRemoteFilesErrors(t *testing.T) {
+	server := RemoteServerFixture()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := PackageSpecFixture(t)
+
+	p.RemoteFiles = map[string]string{
+		server.URL + "/hello#sha256=0000000000000000000000000000000000000000000000000000000000000000": "/usr/share/hello",
+	}
+	err = p.FetchRemoteFiles(dir)
+	if err == nil || !strings.Contains(err.Error(), "Checksum mismatch") {
+		t.Errorf("Expected checksum mismatch; found %+v", err)
+	}
+
+	p.RemoteFiles = map[string]string{
+		server.URL + "/missing": "/usr/share/missing",
+	}
+	err = p.FetchRemoteFiles(dir)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected download to fail; found %+v", err)
+	}
+}
+
+func TestBuildRemoteFiles(t *testing.T) {
+	server := RemoteServerFixture()
+	defer server.Close()
+
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.RemoteFiles = map[string]string{
+		server.URL + "/hello": "/usr/share/hello",
+	}
+
+	err := p.Build("output")
+	defer os.Remove(path.Join("output", p.Filename()))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFetchRemoteFilesModeAndMTime(t *testing.T) {
+	server := RemoteServerFixture()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := PackageSpecFixture(t)
+	p.RemoteFiles = map[string]string{
+		server.URL + "/hello":    "/usr/share/hello",
+		server.URL + "/hello.sh": "/usr/share/hello.sh",
+		server.URL + "/tool":     "/usr/bin/tool",
+	}
+	if err := p.FetchRemoteFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	modes := map[string]os.FileMode{
+		"/usr/share/hello":    0644,
+		"/usr/share/hello.sh": 0755,
+		"/usr/bin/tool":       0755,
+	}
+	for filename, url := range p.fetchedFiles {
+		dest := p.RemoteFiles[url]
+		info, err := os.Stat(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != modes[dest] {
+			t.Errorf("Expected %s to have mode %o, found %o", dest, modes[dest], info.Mode().Perm())
+		}
+		if !info.ModTime().Equal(remoteModTime) {
+			t.Errorf("Expected %s to have mtime %s, found %s", dest, remoteModTime, info.ModTime())
+		}
+	}
+}
+
+func TestFetchRemoteFilesTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	timeout := remoteClient.Timeout
+	remoteClient.Timeout = 50 * time.Millisecond
+	defer func() { remoteClient.Timeout = timeout }()
+
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := PackageSpecFixture(t)
+	p.RemoteFiles = map[string]string{
+		server.URL + "/slow": "/usr/share/slow",
+	}
+	err = p.FetchRemoteFiles(dir)
+	if err == nil || !strings.Contains(err.Error(), "Failed to download") {
+		t.Errorf("Expected download to time out; found %+v", err)
+	}
+}
+
+func TestSummaryRemoteFiles(t *testing.T) {
+	server := RemoteServerFixture()
+	defer server.Close()
+
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.RemoteFiles = map[string]string{
+		server.URL + "/hello": "/usr/share/hello",
+	}
+
+	filename := path.Join("output", p.Filename())
+	err := p.Build("output")
+	defer os.Remove(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fixture has two files of its own
+	summary, err := p.Summary("output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(summary, "(3 files, ") {
+		t.Errorf("Expected the summary to count the remote file, found %q", summary)
+	}
+}
@@ -0,0 +1,322 @@
+package deb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cbednarski/mkdeb/deb/tar"
+	"github.com/klauspost/pgzip"
+)
+
+// RepoComponent is the component BuildRepo puts packages in
+const RepoComponent = "main"
+
+// repoPackage is a package that has been added to the pool
+type repoPackage struct {
+	Name         string
+	Version      Version
+	Architecture string
+	Stanza       []byte
+}
+
+// BuildRepo creates an apt repository from the .deb files in packages. Each
+// package is copied into pool, e.g. pool/main/h/hello/hello-1.0-amd64.deb,
+// and the directory containing pool becomes the root of the repository. The
+// Packages index for each architecture is written to
+// dists/<dist>/main/binary-<arch>/ along with a gzipped copy, and
+// dists/<dist>/Release lists the SHA256 checksums of the indexes.
+//
+// The indexes list every package in the pool, so packages added by earlier
+// calls are kept, and removing a .deb from the pool removes it from the
+// repository the next time BuildRepo runs. Index directories for
+// architectures that no longer have any packages are removed.
+//
+// Packages for the "all" architecture are listed in the index for every other
+// architecture, or in binary-all if there are no other architectures.
+//
+// The Release file is not signed. Use gpg to create Release.gpg and InRelease
+// if your apt sources are not marked [trusted=yes].
+func BuildRepo(pool, dist string, packages []string) error {
+	if dist == "" || strings.ContainsAny(dist, `/\`) {
+		return fmt.Errorf("Invalid dist %q; expected a name like stable", dist)
+	}
+	if len(packages) == 0 {
+		return fmt.Errorf("No packages to add to the repository")
+	}
+
+	root := filepath.Dir(filepath.Clean(pool))
+	for _, filename := range packages {
+		if err := addToPool(pool, filename); err != nil {
+			return err
+		}
+	}
+	added, err := scanPool(root, pool)
+	if err != nil {
+		return err
+	}
+	sort.Slice(added, func(i, j int) bool {
+		if added[i].Name != added[j].Name {
+			return added[i].Name < added[j].Name
+		}
+		return added[i].Version.Compare(added[j].Version) < 0
+	})
+
+	// Arch-independent packages are installable on every architecture
+	indexes := map[string][][]byte{}
+	for _, pkg := range added {
+		if pkg.Architecture != "all" {
+			indexes[pkg.Architecture] = nil
+		}
+	}
+	if len(indexes) == 0 {
+		indexes["all"] = nil
+	}
+	for _, pkg := range added {
+		for arch := range indexes {
+			if pkg.Architecture == arch || pkg.Architecture == "all" {
+				indexes[arch] = append(indexes[arch], pkg.Stanza)
+			}
+		}
+	}
+
+	archs := []string{}
+	for arch := range indexes {
+		archs = append(archs, arch)
+	}
+	sort.Strings(archs)
+
+	distPath := filepath.Join(root, "dists", dist)
+	indexFiles := []string{}
+	for _, arch := range archs {
+		index := path.Join(RepoComponent, "binary-"+arch, "Packages")
+		data := bytes.Join(indexes[arch], []byte("\n"))
+		if err := writeRepoFile(filepath.Join(distPath, index), data); err != nil {
+			return err
+		}
+		compressed := &bytes.Buffer{}
+		writer := pgzip.NewWriter(compressed)
+		if _, err := writer.Write(data); err != nil {
+			return err
+		}
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		if err := writeRepoFile(filepath.Join(distPath, index+".gz"), compressed.Bytes()); err != nil {
+			return err
+		}
+		indexFiles = append(indexFiles, index, index+".gz")
+	}
+	if err := removeStaleIndexes(filepath.Join(distPath, RepoComponent), archs); err != nil {
+		return err
+	}
+
+	release, err := renderRelease(distPath, dist, archs, indexFiles)
+	if err != nil {
+		return err
+	}
+	return writeRepoFile(filepath.Join(distPath, "Release"), release)
+}
+
+// addToPool checks that filename is a package and copies it into the pool
+func addToPool(pool, filename string) error {
+	_, p, err := readPoolControl(filename)
+	if err != nil {
+		return err
+	}
+
+	// Like debian, libraries are grouped by the first four letters of their
+	// name and everything else by the first letter
+	prefix := p.Package[:1]
+	if strings.HasPrefix(p.Package, "lib") && len(p.Package) > 3 {
+		prefix = p.Package[:4]
+	}
+	dest := filepath.Join(pool, RepoComponent, prefix, p.Package, filepath.Base(filename))
+	return copyToPool(filename, dest)
+}
+
+// scanPool returns the Packages stanza for every .deb in the pool. Filename in
+// the stanza is relative to root.
+func scanPool(root, pool string) ([]repoPackage, error) {
+	packages := []repoPackage{}
+	err := filepath.Walk(pool, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || filepath.Ext(filename) != ".deb" {
+			return nil
+		}
+		pkg, err := poolPackage(root, filename)
+		if err != nil {
+			return err
+		}
+		packages = append(packages, pkg)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to scan pool %s: %s", pool, err)
+	}
+	return packages, nil
+}
+
+// poolPackage returns the Packages stanza for a package in the pool
+func poolPackage(root, filename string) (repoPackage, error) {
+	control, p, err := readPoolControl(filename)
+	if err != nil {
+		return repoPackage{}, err
+	}
+	version, err := ParseVersion(p.Version)
+	if err != nil {
+		return repoPackage{}, fmt.Errorf("Invalid version in %s: %s", filename, err)
+	}
+
+	relative, err := filepath.Rel(root, filename)
+	if err != nil {
+		return repoPackage{}, err
+	}
+	sha256sum, size, err := PackageChecksum(filename)
+	if err != nil {
+		return repoPackage{}, err
+	}
+	fields := fmt.Sprintf("Filename: %s\nSize: %d\nSHA256: %s\n", filepath.ToSlash(relative), size, sha256sum)
+
+	// dpkg-scanpackages puts the pool fields before the description, which
+	// may span several lines
+	stanza := strings.TrimRight(string(control), "\n") + "\n"
+	if i := strings.Index(stanza, "\nDescription:"); i >= 0 {
+		stanza = stanza[:i+1] + fields + stanza[i+1:]
+	} else {
+		stanza += fields
+	}
+
+	return repoPackage{
+		Name:         p.Package,
+		Version:      version,
+		Architecture: p.Architecture,
+		Stanza:       []byte(stanza),
+	}, nil
+}
+
+// readPoolControl reads and parses the control file from the .deb at filename
+// and checks that it has the fields the repository needs
+func readPoolControl(filename string) ([]byte, *PackageSpec, error) {
+	control, err := readPackageControl(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := ParseControlFile(control)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse control file in %s: %s", filename, err)
+	}
+	if p.Package == "" || p.Architecture == "" {
+		return nil, nil, fmt.Errorf("Control file in %s must have Package and Architecture", filename)
+	}
+	return control, p, nil
+}
+
+// readPackageControl returns the control file from the .deb at filename
+func readPackageControl(filename string) ([]byte, error) {
+	var control []byte
+	_, err := walkPackage(filename, func(member string, h *tar.Header, r io.Reader) error {
+		if !strings.HasPrefix(member, "control.tar") {
+			return errStopWalk
+		}
+		var err error
+		if strings.TrimPrefix(h.Name, "./") == "control" {
+			control, err = ioutil.ReadAll(r)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if control == nil {
+		return nil, fmt.Errorf("%s has no control file", filename)
+	}
+	return control, nil
+}
+
+// copyToPool copies source to dest, unless it is already there
+func copyToPool(source, dest string) error {
+	if sourceInfo, err := os.Stat(source); err != nil {
+		return err
+	} else if destInfo, err := os.Stat(dest); err == nil && os.SameFile(sourceInfo, destInfo) {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("Failed to create pool directory: %s", err)
+	}
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("Failed to copy %s to the pool: %s", source, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("Failed to copy %s to the pool: %s", source, err)
+	}
+	return out.Close()
+}
+
+// renderRelease creates the Release file for a dist, listing the checksums of
+// each of the index files
+func renderRelease(distPath, dist string, archs, indexFiles []string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "Suite: %s\n", dist)
+	fmt.Fprintf(buf, "Codename: %s\n", dist)
+	fmt.Fprintf(buf, "Date: %s\n", time.Now().UTC().Format(time.RFC1123))
+	fmt.Fprintf(buf, "Architectures: %s\n", strings.Join(archs, " "))
+	fmt.Fprintf(buf, "Components: %s\n", RepoComponent)
+
+	fmt.Fprintf(buf, "SHA256:\n")
+	for _, index := range indexFiles {
+		sha256sum, size, err := PackageChecksum(filepath.Join(distPath, index))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(buf, " %s %d %s\n", sha256sum, size, index)
+	}
+	return buf.Bytes(), nil
+}
+
+// removeStaleIndexes removes the binary-<arch> directories in componentPath
+// for architectures that are not in archs, which are left over from packages
+// that have been removed from the pool
+func removeStaleIndexes(componentPath string, archs []string) error {
+	dirs, err := filepath.Glob(filepath.Join(componentPath, "binary-*"))
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if hasString(archs, strings.TrimPrefix(filepath.Base(dir), "binary-")) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("Failed to remove stale index %s: %s", dir, err)
+		}
+	}
+	return nil
+}
+
+// writeRepoFile writes data to filename, creating its directory if needed
+func writeRepoFile(filename string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("Failed to create %s: %s", filepath.Dir(filename), err)
+	}
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("Failed to write %s: %s", filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package deb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildRepo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Build an amd64 package and an arch-independent one to put in the repo
+	packages := []string{}
+	for _, arch := range []string{"amd64", "all"} {
+		p := PackageSpecFixture(t)
+		p.Version = "0.1.0"
+		p.FS = MapFSFixture()
+		p.AutoPath = "deb-pkg"
+		p.Architecture = arch
+		if arch == "all" {
+			p.Package = "libhello-data"
+		}
+		if err := p.Build(dir); err != nil {
+			t.Fatal(err)
+		}
+		packages = append(packages, filepath.Join(dir, p.Filename()))
+	}
+
+	pool := filepath.Join(dir, "repo", "pool")
+	if err := BuildRepo(pool, "stable", packages); err != nil {
+		t.Fatal(err)
+	}
+
+	root := filepath.Join(dir, "repo")
+	for _, name := range []string{
+		"pool/main/m/mkdeb/" + filepath.Base(packages[0]),
+		"pool/main/libh/libhello-data/" + filepath.Base(packages[1]),
+		"dists/stable/main/binary-amd64/Packages",
+		"dists/stable/main/binary-amd64/Packages.gz",
+		"dists/stable/Release",
+	} {
+		if _, err := os.Stat(filepath.Join(root, name)); err != nil {
+			t.Errorf("Expected %s in the repo: %s", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "dists", "stable", "main", "binary-all")); err == nil {
+		t.Errorf("Expected arch all packages to be listed in binary-amd64")
+	}
+
+	index, err := ioutil.ReadFile(filepath.Join(root, "dists/stable/main/binary-amd64/Packages"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stanzas := strings.Split(string(index), "\n\n")
+	if len(stanzas) != 2 {
+		t.Fatalf("Expected 2 packages in the index, found\n%s", index)
+	}
+	for i, expected := range []string{
+		"Package: libhello-data\n",
+		"Filename: pool/main/libh/libhello-data/" + filepath.Base(packages[1]) + "\n",
+		"Package: mkdeb\n",
+		"Filename: pool/main/m/mkdeb/" + filepath.Base(packages[0]) + "\n",
+	} {
+		if !strings.Contains(stanzas[i/2], expected) {
+			t.Errorf("Expected stanza %d to contain %q\n%s", i/2, expected, stanzas[i/2])
+		}
+	}
+	sha256sum, size, err := PackageChecksum(packages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"SHA256: " + sha256sum + "\n", "Size: " + fmt.Sprint(size) + "\n"} {
+		if !strings.Contains(stanzas[1], expected) {
+			t.Errorf("Expected mkdeb stanza to contain %q\n%s", expected, stanzas[1])
+		}
+	}
+
+	compressed, err := ioutil.ReadFile(filepath.Join(root, "dists/stable/main/binary-amd64/Packages.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(found, index) {
+		t.Errorf("Expected Packages.gz to match Packages, found\n%s", found)
+	}
+
+	release, err := ioutil.ReadFile(filepath.Join(root, "dists/stable/Release"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha256sum, size, err = PackageChecksum(filepath.Join(root, "dists/stable/main/binary-amd64/Packages"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"Suite: stable\n",
+		"Architectures: amd64\n",
+		"Components: main\n",
+		" " + sha256sum + " " + fmt.Sprint(size) + " main/binary-amd64/Packages\n",
+	} {
+		if !strings.Contains(string(release), expected) {
+			t.Errorf("Expected Release to contain %q\n%s", expected, release)
+		}
+	}
+}
+
+func TestBuildRepoKeepsPool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	build := func(name, arch string) string {
+		p := PackageSpecFixture(t)
+		p.Package = name
+		p.Version = "0.1.0"
+		p.FS = MapFSFixture()
+		p.AutoPath = "deb-pkg"
+		p.Architecture = arch
+		if err := p.Build(dir); err != nil {
+			t.Fatal(err)
+		}
+		return filepath.Join(dir, p.Filename())
+	}
+	pool := filepath.Join(dir, "repo", "pool")
+	binaryAll := filepath.Join(dir, "repo", "dists", "stable", "main", "binary-all")
+
+	// With only an arch all package it is indexed in binary-all
+	data := build("hello-data", "all")
+	if err := BuildRepo(pool, "stable", []string{data}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(binaryAll); err != nil {
+		t.Fatalf("Expected binary-all index: %s", err)
+	}
+
+	// Adding a package in a second run keeps the first one, and binary-all is
+	// removed now that hello-data is listed under amd64
+	if err := BuildRepo(pool, "stable", []string{build("hello", "amd64")}); err != nil {
+		t.Fatal(err)
+	}
+	index, err := ioutil.ReadFile(filepath.Join(dir, "repo", "dists", "stable", "main", "binary-amd64", "Packages"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"Package: hello\n", "Package: hello-data\n"} {
+		if !strings.Contains(string(index), expected) {
+			t.Errorf("Expected index to contain %q\n%s", expected, index)
+		}
+	}
+	if _, err := os.Stat(binaryAll); err == nil {
+		t.Errorf("Expected stale binary-all index to be removed")
+	}
+	release, err := ioutil.ReadFile(filepath.Join(dir, "repo", "dists", "stable", "Release"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(release), "binary-all") {
+		t.Errorf("Expected Release not to list binary-all\n%s", release)
+	}
+}
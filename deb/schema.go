@@ -0,0 +1,88 @@
+package deb
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// requiredFields lists the config fields that Validate requires, taken from
+// controlFields. Version is not included since it is set when building rather
+// than in the config file, and architecture is not since either it or
+// architectures may be set.
+var requiredFields = schemaRequiredFields()
+
+func schemaRequiredFields() []string {
+	names := []string{}
+	for _, field := range controlFields {
+		if field.Required && field.Config != "version" && field.Config != "architecture" {
+			names = append(names, field.Config)
+		}
+	}
+	return names
+}
+
+// Schema returns a JSON Schema describing the config file format, which
+// editors can use to validate and autocomplete mkdeb configs. The schema is
+// derived from the json tags on PackageSpec so it is always up to date.
+func Schema() ([]byte, error) {
+	properties := map[string]interface{}{}
+
+	t := reflect.TypeOf(PackageSpec{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.PkgPath != "" || name == "" || name == "-" {
+			continue
+		}
+		properties[name] = schemaType(field.Type)
+	}
+
+	// Fields limited to a known set of values
+	properties["architecture"] = map[string]interface{}{
+		"type": "string",
+		"enum": supportedArchitectures,
+	}
+	properties["architectures"] = map[string]interface{}{
+		"type":  "array",
+		"items": properties["architecture"],
+	}
+	properties["priority"] = map[string]interface{}{
+		"type": "string",
+		"enum": priorities,
+	}
+	for _, name := range []string{"controlCompression", "dataCompression"} {
+		properties[name] = map[string]interface{}{
+			"type": "string",
+			"enum": compressions,
+		}
+	}
+
+	schema := map[string]interface{}{
+		"$schema":    "http://json-schema.org/draft-07/schema#",
+		"title":      "mkdeb config",
+		"type":       "object",
+		"properties": properties,
+		"required":   requiredFields,
+		"anyOf": []map[string]interface{}{
+			{"required": []string{"architecture"}},
+			{"required": []string{"architectures"}},
+		},
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func schemaType(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaType(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaType(t.Elem())}
+	}
+	return map[string]interface{}{"type": "string"}
+}
@@ -0,0 +1,75 @@
+package deb
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	data, err := Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := struct {
+		Properties map[string]map[string]interface{} `json:"properties"`
+		Required   []string                          `json:"required"`
+		AnyOf      []struct {
+			Required []string `json:"required"`
+		} `json:"anyOf"`
+	}{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"package", "maintainer", "description"} {
+		if !hasString(schema.Required, name) {
+			t.Errorf("Expected %s to be required, found %+v", name, schema.Required)
+		}
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("Expected %s in schema properties", name)
+		}
+	}
+
+	// Either architecture or architectures may be set
+	if hasString(schema.Required, "architecture") {
+		t.Errorf("Expected architecture not to be required, found %+v", schema.Required)
+	}
+	if len(schema.AnyOf) != 2 || !hasString(schema.AnyOf[0].Required, "architecture") || !hasString(schema.AnyOf[1].Required, "architectures") {
+		t.Errorf("Expected architecture or architectures to be required, found %+v", schema.AnyOf)
+	}
+
+	// Every config field should be in the schema
+	st := reflect.TypeOf(PackageSpec{})
+	for i := 0; i < st.NumField(); i++ {
+		name := strings.Split(st.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("Expected %s in schema properties", name)
+		}
+	}
+
+	if found := schema.Properties["priority"]["enum"]; len(found.([]interface{})) != len(priorities) {
+		t.Errorf("Expected priority enum %+v, found %+v", priorities, found)
+	}
+	if found := schema.Properties["upgradeConfigs"]["type"]; found != "boolean" {
+		t.Errorf("Expected upgradeConfigs to be a boolean, found %+v", found)
+	}
+}
+
+func TestSchemaRequiredFields(t *testing.T) {
+	// requiredFields should match what Validate reports as missing
+	err := (&PackageSpec{}).Validate(false)
+	if err == nil {
+		t.Fatal("Expected missing fields error")
+	}
+	for _, name := range requiredFields {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected %s to be required by Validate: %s", name, err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package deb
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// embeddedScriptSource is listed by MapControlFiles for scripts added with
+// SetControlScript, since they don't have a path.
+const embeddedScriptSource = "<embedded>"
+
+type embeddedScript struct {
+	data []byte
+	mode os.FileMode
+}
+
+// SetControlScript sets the contents of a control script like postinst, for
+// example from a file embedded with go:embed. This takes precedence over the
+// Preinst, Postinst, Prerm, and Postrm fields and scripts found in AutoPath. If
+// mode is 0 the script is written with mode 0755.
+func (p *PackageSpec) SetControlScript(name string, content []byte, mode os.FileMode) error {
+	if !hasString(controlFiles, name) {
+		return fmt.Errorf("Unknown control script %q; expected one of %s", name, strings.Join(controlFiles, ", "))
+	}
+	if mode == 0 {
+		mode = DefaultExecMode
+	}
+	if p.embeddedScripts == nil {
+		p.embeddedScripts = map[string]embeddedScript{}
+	}
+	p.embeddedScripts[name] = embeddedScript{data: content, mode: mode}
+	return nil
+}
+
+// scriptMode returns the mode used for the control script name in the control
+// archive
+func (p *PackageSpec) scriptMode(name string) os.FileMode {
+	if script, ok := p.embeddedScripts[name]; ok {
+		return script.mode
+	}
+	return DefaultExecMode
+}
@@ -0,0 +1,55 @@
+package deb
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestSetControlScript(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.Force = true
+
+	// These would normally come from go:embed
+	preinst := []byte("#!/bin/sh\necho embedded preinst\n")
+	postinst := []byte("#!/bin/sh\necho embedded postinst\n")
+	if err := p.SetControlScript("preinst", preinst, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetControlScript("postinst", postinst, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	scripts := p.MapControlFiles()
+	if scripts["preinst"] != embeddedScriptSource || scripts["postinst"] != embeddedScriptSource {
+		t.Errorf("Expected embedded scripts to replace the preinst fixture, found %+v", scripts)
+	}
+
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+	if err := p.Build("output"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, contents := readDeb(t, filename)
+	headers, control := readTarGzData(t, bytes.NewReader(contents["control.tar.gz"]))
+	for name, expected := range map[string][]byte{"preinst": preinst, "postinst": postinst} {
+		if !bytes.Equal(control[name], expected) {
+			t.Errorf("Expected %s to contain %q, found %q", name, expected, control[name])
+		}
+	}
+	if mode := headers["preinst"].Mode; mode != 0755 {
+		t.Errorf("Expected preinst to have mode 0755, found %o", mode)
+	}
+	if mode := headers["postinst"].Mode; mode != 0700 {
+		t.Errorf("Expected postinst to have mode 0700, found %o", mode)
+	}
+
+	err := p.SetControlScript("postinstall", postinst, 0)
+	if err == nil || !strings.Contains(err.Error(), "Unknown control script") {
+		t.Errorf("Expected unknown control script error; found %+v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package deb
+
+import (
+	"bytes"
+	"strings"
+)
+
+// debhelperToken marks where generated snippets are inserted in a control
+// script, the same as in debhelper. Without it snippets are appended, which
+// won't work if the script ends with exit.
+const debhelperToken = "#DEBHELPER#"
+
+// snippetGenerators return the shell code that mkdeb adds to the control
+// script name for features like Alternatives and SystemdUnits
+var snippetGenerators = []func(p *PackageSpec, name string) string{
+	(*PackageSpec).alternativesSnippet,
+	(*PackageSpec).systemdSnippet,
+	(*PackageSpec).initScriptSnippet,
+}
+
+// scriptSnippets returns the generated shell code for the control script name,
+// or an empty string if there is none
+func (p *PackageSpec) scriptSnippets(name string) string {
+	snippets := []string{}
+	for _, generate := range snippetGenerators {
+		if snippet := generate(p, name); snippet != "" {
+			snippets = append(snippets, snippet)
+		}
+	}
+	return strings.Join(snippets, "")
+}
+
+// addSnippets inserts the generated shell code for the control script name
+// into script. If there is no script one is created.
+func (p *PackageSpec) addSnippets(name string, script []byte) []byte {
+	snippets := p.scriptSnippets(name)
+	if script == nil {
+		if snippets == "" {
+			return nil
+		}
+		script = []byte("#!/bin/sh\nset -e\n")
+	}
+	if bytes.Contains(script, []byte(debhelperToken)) {
+		return bytes.Replace(script, []byte(debhelperToken), []byte(strings.TrimSuffix(snippets, "\n")), -1)
+	}
+	if snippets == "" {
+		return script
+	}
+	if !bytes.HasSuffix(script, []byte("\n")) {
+		script = append(script, '\n')
+	}
+	return append(script, snippets...)
+}
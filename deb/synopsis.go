@@ -0,0 +1,36 @@
+package deb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxSynopsisLength is the longest synopsis lintian accepts without a warning
+const maxSynopsisLength = 80
+
+// synopsisWarnings warns about style issues in the synopsis, the first line
+// of Description, that lintian would also report. The synopsis is shown in
+// package lists next to the package name, so it should be a short noun phrase
+// like "tool for building debian packages".
+func (p *PackageSpec) synopsisWarnings() []string {
+	synopsis := strings.TrimSpace(strings.SplitN(p.Description, "\n", 2)[0])
+	if synopsis == "" {
+		return nil
+	}
+
+	warnings := []string{}
+	if len(synopsis) > maxSynopsisLength {
+		warnings = append(warnings, fmt.Sprintf("Description synopsis is %d characters; keep it to %d or fewer", len(synopsis), maxSynopsisLength))
+	}
+	first := strings.ToLower(strings.Fields(synopsis)[0])
+	if first == "a" || first == "an" || first == "the" {
+		warnings = append(warnings, fmt.Sprintf("Description synopsis %q should not start with an article like %q", synopsis, strings.Fields(synopsis)[0]))
+	}
+	if p.Package != "" && strings.EqualFold(strings.Trim(first, ":,"), p.Package) {
+		warnings = append(warnings, fmt.Sprintf("Description synopsis %q should not start with the package name", synopsis))
+	}
+	if strings.HasSuffix(synopsis, ".") && !strings.HasSuffix(synopsis, "...") {
+		warnings = append(warnings, fmt.Sprintf("Description synopsis %q should not end with a full stop", synopsis))
+	}
+	return warnings
+}
@@ -0,0 +1,119 @@
+package deb
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// systemdUnitDir is where packages install systemd units
+const systemdUnitDir = "/lib/systemd/system"
+
+// systemdUnitTypes are the kinds of unit files that may be listed in
+// SystemdUnits
+var systemdUnitTypes = []string{".service", ".socket", ".timer", ".path", ".target"}
+
+// unitNames returns the names of the units in SystemdUnits, e.g. app.service
+func (p *PackageSpec) unitNames() []string {
+	names := []string{}
+	for _, unit := range p.SystemdUnits {
+		names = append(names, filepath.Base(unit))
+	}
+	return names
+}
+
+// fileMap returns the Files map plus the files added by options like
+// SystemdUnits and InitScripts, mapping each source file to its destination
+func (p *PackageSpec) fileMap() map[string]string {
+	if len(p.SystemdUnits) == 0 && len(p.InitScripts) == 0 {
+		return p.Files
+	}
+	files := map[string]string{}
+	for src, dest := range p.Files {
+		files[src] = dest
+	}
+	for _, unit := range p.SystemdUnits {
+		files[unit] = path.Join(systemdUnitDir, filepath.Base(unit))
+	}
+	for _, script := range p.InitScripts {
+		files[script] = path.Join(initScriptDir, filepath.Base(script))
+	}
+	return files
+}
+
+func validateSystemdUnit(unit string) error {
+	if !hasString(systemdUnitTypes, filepath.Ext(unit)) {
+		return fmt.Errorf("Systemd unit %q is invalid; expected a file ending in %s", unit, strings.Join(systemdUnitTypes, ", "))
+	}
+	return nil
+}
+
+// systemdSnippet enables and starts the units in postinst, and stops and
+// disables them in prerm. deb-systemd-helper is used to enable units since
+// it works even if systemd is not running, e.g. in a container build.
+//
+// Like debhelper, units are left running during an upgrade and restarted by
+// the new postinst, which is called with the previous version in $2, so they
+// pick up the new files with only a brief interruption.
+func (p *PackageSpec) systemdSnippet(name string) string {
+	if len(p.SystemdUnits) == 0 {
+		return ""
+	}
+	units := strings.Join(p.unitNames(), " ")
+	switch name {
+	case "postinst":
+		return fmt.Sprintf(`if [ "$1" = "configure" ] || [ "$1" = "abort-upgrade" ]; then
+	if [ -x /usr/bin/deb-systemd-helper ]; then
+		deb-systemd-helper unmask %[1]s >/dev/null || true
+		deb-systemd-helper enable %[1]s >/dev/null || true
+	fi
+	if [ -d /run/systemd/system ]; then
+		systemctl --system daemon-reload >/dev/null || true
+		if [ -n "$2" ]; then
+			systemctl restart %[1]s || true
+		else
+			systemctl start %[1]s || true
+		fi
+	fi
+fi
+`, units)
+	case "prerm":
+		return fmt.Sprintf(`if [ "$1" = "remove" ]; then
+	if [ -d /run/systemd/system ]; then
+		systemctl stop %[1]s || true
+	fi
+	if [ -x /usr/bin/deb-systemd-helper ]; then
+		deb-systemd-helper disable %[1]s >/dev/null || true
+	fi
+fi
+`, units)
+	}
+	return ""
+}
+
+// serviceWarnings warns about systemd units and init scripts in the package
+// when there is no postinst to enable them, which usually means they were
+// copied into AutoPath instead of being listed in SystemdUnits or InitScripts
+func (p *PackageSpec) serviceWarnings() []string {
+	if _, ok := p.MapControlFiles()["postinst"]; ok || p.scriptSnippets("postinst") != "" {
+		return nil
+	}
+	targets, err := p.ListArchivePaths()
+	if err != nil {
+		// This will be reported when we try to build the package
+		return nil
+	}
+
+	warnings := []string{}
+	for _, target := range targets {
+		dir, name := path.Split("/" + target)
+		switch {
+		case (dir == systemdUnitDir+"/" || dir == "/usr"+systemdUnitDir+"/") && hasString(systemdUnitTypes, path.Ext(name)):
+			warnings = append(warnings, fmt.Sprintf("Systemd unit /%s is installed but there is no postinst to enable it; list it in systemdUnits instead", target))
+		case dir == initScriptDir+"/":
+			warnings = append(warnings, fmt.Sprintf("Init script /%s is installed but there is no postinst to register it; list it in initScripts instead", target))
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,74 @@
+package deb
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestBuildSystemdUnits(t *testing.T) {
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.Force = true
+	p.SystemdUnits = []string{path.Join("test-fixtures", "systemd", "package1.service")}
+	if err := p.Validate(true); err != nil {
+		t.Fatal(err)
+	}
+
+	filename := path.Join("output", p.Filename())
+	defer os.Remove(filename)
+	if err := p.Build("output"); err != nil {
+		t.Fatal(err)
+	}
+	_, contents := readDeb(t, filename)
+
+	_, data := readTarGzData(t, bytes.NewReader(contents["data.tar.gz"]))
+	unit, ok := data["lib/systemd/system/package1.service"]
+	if !ok || !bytes.Contains(unit, []byte("ExecStart=/usr/local/bin/package1")) {
+		t.Errorf("Expected the unit to be installed in /lib/systemd/system, found %q", unit)
+	}
+
+	_, control := readTarGzData(t, bytes.NewReader(contents["control.tar.gz"]))
+	for name, snippets := range map[string][]string{
+		// Units are restarted on upgrade and only stopped when removed
+		"postinst": {"deb-systemd-helper enable package1.service", "systemctl start package1.service", "systemctl restart package1.service"},
+		"prerm":    {"if [ \"$1\" = \"remove\" ]; then", "systemctl stop package1.service", "deb-systemd-helper disable package1.service"},
+	} {
+		for _, snippet := range snippets {
+			if !strings.Contains(string(control[name]), snippet) {
+				t.Errorf("Expected %s to contain %q\n%s", name, snippet, control[name])
+			}
+		}
+	}
+	if !bytes.Contains(control["md5sums"], []byte("  lib/systemd/system/package1.service\n")) {
+		t.Errorf("Expected the unit in md5sums\n%s", control["md5sums"])
+	}
+
+	p.SystemdUnits = []string{"package1.conf"}
+	err := p.Validate(true)
+	if err == nil || !strings.Contains(err.Error(), "Systemd unit") {
+		t.Errorf("Expected package1.conf to be invalid; found %+v", err)
+	}
+}
+
+func TestWarningsServiceWithoutPostinst(t *testing.T) {
+	p := WarningsFixture(t)
+	p.Section = "utils"
+	p.Files = map[string]string{
+		path.Join("test-fixtures", "systemd", "package1.service"): "/lib/systemd/system/package1.service",
+	}
+
+	warnings := p.Warnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "Systemd unit /lib/systemd/system/package1.service is installed but there is no postinst") {
+		t.Fatalf("Expected one warning about the unit; found %+v", warnings)
+	}
+
+	// Listing the unit in systemdUnits generates a postinst for it
+	p.Files = nil
+	p.SystemdUnits = []string{path.Join("test-fixtures", "systemd", "package1.service")}
+	if warnings := p.Warnings(); len(warnings) != 0 {
+		t.Errorf("Expected no warnings; found %+v", warnings)
+	}
+}
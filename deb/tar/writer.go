@@ -38,6 +38,7 @@ type Writer struct {
 	closed     bool
 	usedBinary bool  // whether the binary numeric field extension was used
 	preferPax  bool  // use PAX header instead of binary numeric header
+	format     int   // format set by SetFormat; formatUnknown allows any
 	hdrBuff    block // buffer to use in writeHeader when writing a regular header
 	paxHdrBuff block // buffer to use in writeHeader when writing a PAX header
 }
@@ -45,6 +46,42 @@ type Writer struct {
 // NewWriter creates a new Writer writing to w.
 func NewWriter(w io.Writer) *Writer { return &Writer{w: w} }
 
+// SetFormat restricts the headers written by WriteHeader to a single tar
+// format: "pax", "gnu", or "ustar". With pax, long names and other fields that
+// don't fit in a ustar header use PAX extended headers. With gnu, long names
+// use GNU long name records, large numbers use base-256, and strings that aren't
+// ASCII are written as raw bytes. WriteHeader
+// returns an error if a header can't be represented in the chosen format.
+func (tw *Writer) SetFormat(name string) error {
+	switch name {
+	case "pax":
+		tw.format = formatPAX
+		tw.preferPax = true
+	case "gnu":
+		tw.format = formatGNU
+		tw.preferPax = false
+	case "ustar":
+		tw.format = formatUSTAR
+		tw.preferPax = false
+	default:
+		return fmt.Errorf("archive/tar: unknown format %q", name)
+	}
+	return nil
+}
+
+// formatName returns the name of the format passed to SetFormat
+func (tw *Writer) formatName() string {
+	switch tw.format {
+	case formatPAX:
+		return "pax"
+	case formatGNU:
+		return "gnu"
+	case formatUSTAR:
+		return "ustar"
+	}
+	return "tar"
+}
+
 // Flush finishes writing the current file (optional).
 func (tw *Writer) Flush() error {
 	if tw.nb > 0 {
@@ -76,8 +113,10 @@ var (
 // WriteHeader writes hdr and prepares to accept the file's contents.
 // WriteHeader calls Flush if it is not the first header.
 // Calling after a Close will return ErrWriteAfterClose.
+// PAX extended headers are only written if the format is set to pax with
+// SetFormat.
 func (tw *Writer) WriteHeader(hdr *Header) error {
-	return tw.writeHeader(hdr, false)
+	return tw.writeHeader(hdr, tw.format == formatPAX)
 }
 
 // WriteHeader writes hdr and prepares to accept the file's contents.
@@ -96,7 +135,9 @@ func (tw *Writer) writeHeader(hdr *Header, allowPax bool) error {
 		return tw.err
 	}
 
-	if len(hdr.Name) > 100 {
+	// GNU long name records are used for long names unless the format is
+	// restricted to something else
+	if len(hdr.Name) > nameSize && (tw.format == formatUnknown || tw.format == formatGNU) {
 		header := &tw.hdrBuff
 		copy(header[:], zeroBlock[:])
 
@@ -162,7 +203,14 @@ func (tw *Writer) writeHeader(hdr *Header, allowPax bool) error {
 	// Wrappers around formatter that automatically sets paxHeaders if the
 	// argument extends beyond the capacity of the input byte slice.
 	var f formatter
+	usedBinary := false
 	var formatString = func(b []byte, s string, paxKeyword string) {
+		// GNU tar stores strings as raw bytes, so only strings that are too
+		// long can't be represented
+		if tw.format == formatGNU && len(s) <= len(b) {
+			copy(b, s)
+			return
+		}
 		needsPaxHeader := paxKeyword != paxNone && len(s) > len(b) || !isASCII(s)
 		if needsPaxHeader {
 			paxHeaders[paxKeyword] = s
@@ -187,6 +235,7 @@ func (tw *Writer) writeHeader(hdr *Header, allowPax bool) error {
 		}
 
 		tw.usedBinary = true
+		usedBinary = true
 		f.formatNumeric(b, x)
 	}
 
@@ -249,7 +298,7 @@ func (tw *Writer) writeHeader(hdr *Header, allowPax bool) error {
 
 	// try to use a ustar header when only the name is too long
 	_, paxPathUsed := paxHeaders[paxPath]
-	if usePrefix && !tw.preferPax && len(paxHeaders) == 1 && paxPathUsed {
+	if (usePrefix || tw.format == formatUSTAR) && !tw.preferPax && len(paxHeaders) == 1 && paxPathUsed {
 		prefix, suffix, ok := splitUSTARPath(hdr.Name)
 		if ok {
 			// Since we can encode in USTAR format, disable PAX header.
@@ -261,24 +310,30 @@ func (tw *Writer) writeHeader(hdr *Header, allowPax bool) error {
 		}
 	}
 
-	if tw.usedBinary {
+	if tw.usedBinary || tw.format == formatGNU {
 		header.SetFormat(formatGNU)
 	} else {
 		header.SetFormat(formatUSTAR)
 	}
 
-	// Check if there were any formatting errors.
-	if f.err != nil {
-		tw.err = f.err
-		return tw.err
-	}
-
 	if allowPax {
 		for k, v := range hdr.Xattrs {
 			paxHeaders[paxXattr+k] = v
 		}
 	}
 
+	if tw.format == formatGNU || tw.format == formatUSTAR {
+		if len(paxHeaders) > 0 || (usedBinary && tw.format == formatUSTAR) {
+			return fmt.Errorf("archive/tar: header can't be represented in %s format", tw.formatName())
+		}
+	}
+
+	// Check if there were any formatting errors.
+	if f.err != nil {
+		tw.err = f.err
+		return tw.err
+	}
+
 	if len(paxHeaders) > 0 {
 		if !allowPax {
 			return errInvalidHeader
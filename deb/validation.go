@@ -0,0 +1,45 @@
+package deb
+
+import (
+	"strings"
+)
+
+// ValidationError describes a problem with one field of a PackageSpec.
+type ValidationError struct {
+	Field   string // Name of the field in the config file, e.g. depends
+	Value   string // The value that failed validation, if any
+	Missing bool   // The field is required but was not set
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Message
+}
+
+// ValidationErrors is returned by Validate and lists each problem found.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	missing := []string{}
+	messages := []string{}
+	for _, err := range e {
+		if err.Missing {
+			missing = append(missing, err.Field)
+		} else {
+			messages = append(messages, err.Message)
+		}
+	}
+	if len(missing) > 0 {
+		messages = append([]string{"These required fields are missing: " + strings.Join(missing, ", ")}, messages...)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Fields returns the names of the fields that failed validation
+func (e ValidationErrors) Fields() []string {
+	fields := []string{}
+	for _, err := range e {
+		fields = append(fields, err.Field)
+	}
+	return fields
+}
@@ -0,0 +1,176 @@
+package deb
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/cbednarski/mkdeb/deb/tar"
+	"github.com/laher/argo/ar"
+)
+
+// VerifyPackage reads the .deb at filename and checks that it is well formed:
+// debian-binary comes first, the control and data archives can be
+// decompressed, the control file has the required fields, and every file in
+// md5sums is in the data archive with the same checksum.
+func VerifyPackage(filename string) error {
+	var control, md5sums []byte
+	checksums := map[string]string{}
+	members, err := walkPackage(filename, func(member string, h *tar.Header, r io.Reader) error {
+		var err error
+		switch {
+		case strings.HasPrefix(member, "control.tar"):
+			switch strings.TrimPrefix(h.Name, "./") {
+			case "control":
+				control, err = ioutil.ReadAll(r)
+			case "md5sums":
+				md5sums, err = ioutil.ReadAll(r)
+			}
+		case strings.HasPrefix(member, "data.tar"):
+			if h.Typeflag != tar.TypeReg && h.Typeflag != tar.TypeRegA {
+				return nil
+			}
+			hash := md5.New()
+			if _, err := io.Copy(hash, r); err != nil {
+				return err
+			}
+			checksums[strings.TrimPrefix(h.Name, "./")] = hex.EncodeToString(hash.Sum(nil))
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(members) != 3 || !strings.HasPrefix(members[1], "control.tar") || !strings.HasPrefix(members[2], "data.tar") {
+		return fmt.Errorf("Expected debian-binary, control, and data archives in %s, found %s", filename, strings.Join(members, ", "))
+	}
+
+	if control == nil {
+		return fmt.Errorf("Control archive in %s has no control file", filename)
+	}
+	if err := checkControlFile(control); err != nil {
+		return err
+	}
+	if md5sums == nil {
+		return fmt.Errorf("Control archive in %s has no md5sums file", filename)
+	}
+
+	for _, line := range strings.Split(string(bytes.TrimSpace(md5sums)), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "  ", 2)
+		if len(fields) != 2 {
+			return fmt.Errorf("Invalid md5sums line %q", line)
+		}
+		sum, ok := checksums[fields[1]]
+		if !ok {
+			return fmt.Errorf("%s is listed in md5sums but not in the data archive", fields[1])
+		}
+		if sum != fields[0] {
+			return fmt.Errorf("Checksum mismatch for %s: md5sums has %s, data archive has %s", fields[1], fields[0], sum)
+		}
+	}
+	return nil
+}
+
+// verifyPackage is called by Build when Verify is set. Tests replace this to
+// simulate a package that fails verification.
+var verifyPackage = VerifyPackage
+
+// errStopWalk can be returned by the function passed to walkPackage to stop
+// reading the package early without an error
+var errStopWalk = errors.New("stop walking package")
+
+// walkPackage reads the .deb at filename and calls f for each file in its
+// control and data archives, along with the name of the ar member it is in,
+// like control.tar.gz. It returns the names of the ar members in order, and
+// fails if debian-binary is not the first member. If f returns errStopWalk
+// walkPackage stops and returns the members read so far.
+func walkPackage(filename string, f func(member string, h *tar.Header, r io.Reader) error) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	archive := ar.NewReader(file)
+	members := []string{}
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return members, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed reading %s: %s", filename, err)
+		}
+		members = append(members, header.Name)
+
+		switch {
+		case header.Name == "debian-binary":
+			if len(members) != 1 {
+				return nil, fmt.Errorf("debian-binary must be the first member of %s", filename)
+			}
+		case strings.HasPrefix(header.Name, "control.tar"), strings.HasPrefix(header.Name, "data.tar"):
+			err = readTarMember(archive, header.Name, func(h *tar.Header, r io.Reader) error {
+				return f(header.Name, h, r)
+			})
+			if err == errStopWalk {
+				return members, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// checkControlFile checks that the required fields are set in a control file
+func checkControlFile(data []byte) error {
+	p, err := ParseControlFile(data)
+	if err != nil {
+		return err
+	}
+	missing := []string{}
+	for _, field := range controlFields {
+		if field.Required && field.value(p) == "" {
+			missing = append(missing, field.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("Control file is missing required fields: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// readTarMember decompresses the tar archive name from r and calls f for each
+// file in it
+func readTarMember(r io.Reader, name string, f func(*tar.Header, io.Reader) error) error {
+	decompressed, err := newDecompressor(r, name)
+	if err != nil {
+		return err
+	}
+	defer decompressed.Close()
+	archive := tar.NewReader(decompressed)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Failed reading %s: %s", name, err)
+		}
+		if err := f(header, archive); err == errStopWalk {
+			return err
+		} else if err != nil {
+			return fmt.Errorf("Failed reading %s from %s: %s", header.Name, name, err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package deb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cbednarski/mkdeb/deb/tar"
+	"github.com/laher/argo/ar"
+)
+
+func TestBuildVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.Verify = true
+	if err := p.Build(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tamper with the contents of package1 so it no longer matches md5sums.
+	// The data archive is uncompressed so the file contents are in the .deb.
+	p.DataCompression = "none"
+	p.Force = true
+	if err := p.Build(dir); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, p.Filename())
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadFile("test-fixtures/package1/usr/local/bin/package1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(data, contents)
+	if i < 0 {
+		t.Fatal("Expected to find package1 in the .deb")
+	}
+	data[i] ^= 0xff
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = VerifyPackage(filename)
+	if err == nil || !strings.Contains(err.Error(), "Checksum mismatch for usr/local/bin/package1") {
+		t.Errorf("Expected checksum mismatch, found %v", err)
+	}
+}
+
+func TestBuildVerifyFailure(t *testing.T) {
+	defer func(original func(string) error) { verifyPackage = original }(verifyPackage)
+	verifyPackage = func(filename string) error {
+		return errors.New("Checksum mismatch")
+	}
+
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	p.Verify = true
+	err = p.Build(dir)
+	if err == nil || !strings.Contains(err.Error(), "Package verification failed") {
+		t.Fatalf("Expected verification to fail, found %v", err)
+	}
+	if FileExists(filepath.Join(dir, p.Filename())) {
+		t.Errorf("Expected the package to be removed when verification fails")
+	}
+}
+
+// writeDebFixture writes an ar archive with members in the given order, so
+// tests can build packages that mkdeb would never produce
+func writeDebFixture(t *testing.T, filename string, names []string, contents map[string][]byte) {
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	archive := ar.NewWriter(file)
+	for _, name := range names {
+		if err := writeBytesToAr(archive, ar.Header{Mode: 0644}, name, contents[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyPackageStructure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := PackageSpecFixture(t)
+	p.Version = "0.1.0"
+	if err := p.Build(dir); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, p.Filename())
+	if err := VerifyPackage(filename); err != nil {
+		t.Fatalf("Expected a freshly built package to be valid: %s", err)
+	}
+	_, contents := readDeb(t, filename)
+
+	// A control archive without md5sums or a Maintainer field
+	control := &bytes.Buffer{}
+	zipwriter := gzip.NewWriter(control)
+	archive := tar.NewWriter(zipwriter)
+	header := tar.Header{Mode: 0644}
+	if err := writeBytesToTar(archive, header, "control", []byte("Package: mkdeb\nVersion: 0.1.0\nArchitecture: amd64\nDescription: test\n")); err != nil {
+		t.Fatal(err)
+	}
+	archive.Close()
+	zipwriter.Close()
+	brokenContents := map[string][]byte{}
+	for name, data := range contents {
+		brokenContents[name] = data
+	}
+	brokenContents["control.tar.gz"] = control.Bytes()
+
+	for _, test := range []struct {
+		names    []string
+		contents map[string][]byte
+		expected string
+	}{
+		{[]string{"control.tar.gz", "debian-binary", "data.tar.gz"}, contents, "debian-binary must be the first member"},
+		{[]string{"debian-binary", "data.tar.gz", "control.tar.gz"}, contents, "Expected debian-binary, control, and data archives"},
+		{[]string{"debian-binary", "control.tar.gz"}, contents, "Expected debian-binary, control, and data archives"},
+		{[]string{"debian-binary", "control.tar.gz", "data.tar.gz"}, brokenContents, "missing required fields: Maintainer"},
+	} {
+		broken := filepath.Join(dir, "broken.deb")
+		writeDebFixture(t, broken, test.names, test.contents)
+		err := VerifyPackage(broken)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Expected %v to fail with %q, found %v", test.names, test.expected, err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package deb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a debian package version in the form [epoch:]upstream[-revision],
+// like 1:2.3.4-1
+type Version struct {
+	Epoch    int
+	Upstream string
+	Revision string
+}
+
+// ParseVersion splits a version string into its epoch, upstream version, and
+// revision. The epoch defaults to 0 and the revision to an empty string.
+func ParseVersion(version string) (Version, error) {
+	v := Version{}
+	if !reVersion.MatchString(version) {
+		return v, fmt.Errorf("Version %q is invalid; expected something like 1.2.3 or 1:1.2.3-1", version)
+	}
+
+	upstream := version
+	if i := strings.Index(upstream, ":"); i >= 0 {
+		epoch, err := strconv.Atoi(upstream[:i])
+		if err != nil {
+			return v, fmt.Errorf("Version %q has an invalid epoch: %s", version, err)
+		}
+		v.Epoch = epoch
+		upstream = upstream[i+1:]
+	}
+	if i := strings.LastIndex(upstream, "-"); i >= 0 {
+		v.Revision = upstream[i+1:]
+		upstream = upstream[:i]
+	}
+	v.Upstream = upstream
+	return v, nil
+}
+
+// String formats the version the way it appears in a control file
+func (v Version) String() string {
+	s := v.Upstream
+	if v.Epoch != 0 {
+		s = strconv.Itoa(v.Epoch) + ":" + s
+	}
+	if v.Revision != "" {
+		s += "-" + v.Revision
+	}
+	return s
+}
+
+// Compare returns -1, 0, or 1 if v is older than, the same as, or newer than
+// other, following the ordering used by dpkg
+func (v Version) Compare(other Version) int {
+	if v.Epoch != other.Epoch {
+		if v.Epoch < other.Epoch {
+			return -1
+		}
+		return 1
+	}
+	if c := compareVersionPart(v.Upstream, other.Upstream); c != 0 {
+		return c
+	}
+	return compareVersionPart(v.Revision, other.Revision)
+}
+
+// compareVersionPart compares upstream versions or revisions. They are split
+// into alternating runs of non-digits and digits. Non-digit runs are compared
+// character by character, where ~ sorts before anything (even the end of the
+// string), then letters, then other characters. Digit runs are compared as
+// numbers.
+func compareVersionPart(a, b string) int {
+	for a != "" || b != "" {
+		var aText, bText string
+		aText, a = splitVersionRun(a, false)
+		bText, b = splitVersionRun(b, false)
+		if c := compareVersionText(aText, bText); c != 0 {
+			return c
+		}
+
+		var aDigits, bDigits string
+		aDigits, a = splitVersionRun(a, true)
+		bDigits, b = splitVersionRun(b, true)
+		if c := compareVersionDigits(aDigits, bDigits); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// splitVersionRun returns the leading run of digits (or non-digits) in s,
+// and the rest of s
+func splitVersionRun(s string, digits bool) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) == digits {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func compareVersionText(a, b string) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var ac, bc int
+		if i < len(a) {
+			ac = versionCharOrder(a[i])
+		}
+		if i < len(b) {
+			bc = versionCharOrder(b[i])
+		}
+		if ac != bc {
+			if ac < bc {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionCharOrder weights characters so ~ sorts before the end of the string
+// (0), which sorts before letters, which sort before everything else
+func versionCharOrder(c byte) int {
+	switch {
+	case c == '~':
+		return -1
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return int(c)
+	default:
+		return int(c) + 256
+	}
+}
+
+func compareVersionDigits(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,97 @@
+package deb
+
+import (
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	for input, expected := range map[string]Version{
+		"1.2.3":            {0, "1.2.3", ""},
+		"1.2.3-1":          {0, "1.2.3", "1"},
+		"2:1.2.3-1ubuntu1": {2, "1.2.3", "1ubuntu1"},
+		"1.2-3-4":          {0, "1.2-3", "4"},
+		"1.0~rc1":          {0, "1.0~rc1", ""},
+	} {
+		v, err := ParseVersion(input)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %s", input, err)
+			continue
+		}
+		if v != expected {
+			t.Errorf("Expected %q to parse as %+v, found %+v", input, expected, v)
+		}
+		if v.String() != input {
+			t.Errorf("Expected %+v to format as %q, found %q", v, input, v.String())
+		}
+	}
+
+	for _, input := range []string{"", "a1.0", "1.0-", "x:1.0", "1.0 beta"} {
+		if _, err := ParseVersion(input); err == nil {
+			t.Errorf("Expected %q to be invalid", input)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	// Each version is older than the one after it
+	ordered := []string{
+		"0~~",
+		"0~~a",
+		"0~",
+		"0",
+		"0a",
+		"0.1",
+		"1.0~beta1",
+		"1.0~rc1",
+		"1.0",
+		"1.0-1",
+		"1.0-1+b1",
+		"1.0-1.1",
+		"1.0-2",
+		"1.0-10",
+		"1.0a",
+		"1.0+dfsg",
+		"1.0.1",
+		"1.2.9",
+		"1.2.10",
+		"1.10",
+		"2.0",
+		"1:0.1",
+		"1:1.0",
+		"2:0.1",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			a, err := ParseVersion(ordered[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ParseVersion(ordered[j])
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := 0
+			if i < j {
+				expected = -1
+			} else if i > j {
+				expected = 1
+			}
+			if c := a.Compare(b); c != expected {
+				t.Errorf("Expected %s compared to %s to be %d, found %d", a, b, expected, c)
+			}
+		}
+	}
+
+	// Leading zeros and a missing revision don't change the version
+	for _, pair := range [][2]string{
+		{"1.01", "1.1"},
+		{"1.0", "1.0-0"},
+		{"0:1.0", "1.0"},
+	} {
+		a, _ := ParseVersion(pair[0])
+		b, _ := ParseVersion(pair[1])
+		if c := a.Compare(b); c != 0 {
+			t.Errorf("Expected %s and %s to be equal, found %d", pair[0], pair[1], c)
+		}
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/cbednarski/mkdeb/deb"
 )
@@ -21,19 +24,82 @@ func main() {
 
 	switch args[1] {
 	case "archs":
-		showArchs()
+		archsCommand := flag.NewFlagSet("archs", flag.ExitOnError)
+		asJSON := archsCommand.Bool("json", false, "Print the list as JSON")
+		archsCommand.Parse(args[2:])
+		showArchs(archsCommand.Args(), *asJSON)
 	case "build":
 		buildCommand := flag.NewFlagSet("build", flag.ExitOnError)
-		version := buildCommand.String("version", "1.0", "Package version")
-		target := buildCommand.String("target", "", "Target folder with generated filename")
+		opts := buildOptions{}
+		buildCommand.StringVar(&opts.version, "version", "1.0", "Package version")
+		buildCommand.StringVar(&opts.target, "target", "", "Target folder with generated filename")
+		buildCommand.BoolVar(&opts.strict, "strict", false, "Treat warnings as errors")
+		buildCommand.BoolVar(&opts.strict, "Werror", false, "Same as -strict")
+		buildCommand.BoolVar(&opts.force, "force", false, "Overwrite an existing package")
+		buildCommand.BoolVar(&opts.keepTemp, "keep-temp", false, "Keep intermediate files")
+		buildCommand.StringVar(&opts.root, "root", "", "Package a prepared root filesystem")
+		buildCommand.BoolVar(&opts.quiet, "quiet", false, "Only show errors")
+		buildCommand.StringVar(&opts.section, "section", "", "Override the section in the config")
+		buildCommand.StringVar(&opts.priority, "priority", "", "Override the priority in the config")
+		buildCommand.BoolVar(&opts.buildInfo, "build-info", false, "Add the build date and git commit to the description")
+		buildCommand.BoolVar(&opts.verify, "verify", false, "Check the package after it is built")
+		buildCommand.BoolVar(&opts.checksum, "checksum", false, "Print the sha256 checksum and size of the package")
+		buildCommand.Var(&opts.defines, "define", "Add a control field like X-Commit=abcd123; may be repeated")
 		buildCommand.Parse(args[2:])
-		build(checkConfig(buildCommand.Args()), *version, *target)
+		build(checkConfig(buildCommand.Args()), opts)
+	case "changelog":
+		if len(args) < 3 || args[2] != "add" {
+			showUsage()
+		}
+		changelogCommand := flag.NewFlagSet("changelog add", flag.ExitOnError)
+		version := changelogCommand.String("version", "", "Package version")
+		message := changelogCommand.String("message", "", "Description of changes")
+		changelogCommand.Parse(args[3:])
+		addChangelog(checkConfig(changelogCommand.Args()), *version, *message)
+	case "check":
+		checkCommand := flag.NewFlagSet("check", flag.ExitOnError)
+		checkCommand.Parse(args[2:])
+		check(checkCommand.Args())
+	case "doctor":
+		doctorCommand := flag.NewFlagSet("doctor", flag.ExitOnError)
+		doctorCommand.Parse(args[2:])
+		doctor(doctorCommand.Args())
+	case "fields":
+		showFields()
 	case "init":
 		initialize()
+	case "name":
+		nameCommand := flag.NewFlagSet("name", flag.ExitOnError)
+		version := nameCommand.String("version", "1.0", "Package version")
+		nameCommand.Parse(args[2:])
+		name(checkConfig(nameCommand.Args()), *version)
+	case "render":
+		renderCommand := flag.NewFlagSet("render", flag.ExitOnError)
+		version := renderCommand.String("version", "1.0", "Package version")
+		renderCommand.Parse(args[2:])
+		render(checkConfig(renderCommand.Args()), *version)
+	case "repo":
+		if len(args) < 3 || args[2] != "build" {
+			showUsage()
+		}
+		repoCommand := flag.NewFlagSet("repo build", flag.ExitOnError)
+		pool := repoCommand.String("pool", "pool", "Directory to copy packages into")
+		dist := repoCommand.String("dist", "stable", "Distribution to generate indexes for")
+		repoCommand.Parse(args[3:])
+		buildRepo(*pool, *dist, repoCommand.Args())
+	case "schema":
+		showSchema()
+	case "size":
+		sizeCommand := flag.NewFlagSet("size", flag.ExitOnError)
+		sizeCommand.Parse(args[2:])
+		size(checkConfig(sizeCommand.Args()))
 	case "validate":
-		commandArgs := flag.Args()
-
-		validate(checkConfig(commandArgs))
+		validateCommand := flag.NewFlagSet("validate", flag.ExitOnError)
+		strict := validateCommand.Bool("strict", false, "Treat warnings as errors")
+		validateCommand.BoolVar(strict, "Werror", false, "Same as -strict")
+		quiet := validateCommand.Bool("quiet", false, "Only show errors")
+		validateCommand.Parse(args[2:])
+		validate(checkConfig(validateCommand.Args()), *strict, *quiet)
 	default:
 		showUsage()
 	}
@@ -66,10 +132,97 @@ func getAbsPaths(filename string) (string, string) {
 	return dir, path
 }
 
-func showArchs() {
+// showArchs lists the supported architectures. If an architecture is given it
+// checks whether that one is supported instead, so scripts can use the exit
+// code.
+func showArchs(args []string, asJSON bool) {
+	if len(args) > 1 {
+		handleError(fmt.Errorf("Too many arguments"))
+	}
+	if len(args) == 1 {
+		if !deb.IsSupportedArchitecture(args[0]) {
+			handleError(fmt.Errorf("%q is not a supported architecture", args[0]))
+		}
+		fmt.Printf("%s is supported\n", args[0])
+		return
+	}
+	if asJSON {
+		data, err := json.Marshal(deb.SupportedArchitectures())
+		handleError(err)
+		fmt.Println(string(data))
+		return
+	}
 	fmt.Printf("mkdeb supported architectures: %s\n", strings.Join(deb.SupportedArchitectures(), ", "))
 }
 
+func showFields() {
+	for _, field := range deb.ControlFields() {
+		required := ""
+		if field.Required {
+			required = "required"
+		}
+		fmt.Printf("%-15s %-13s %-9s %s\n", field.Name, field.Config, required, field.Description)
+	}
+}
+
+func showSchema() {
+	schema, err := deb.Schema()
+	handleError(err)
+	fmt.Println(string(schema))
+}
+
+// check verifies the structure of each built package in args
+func check(args []string) {
+	if len(args) < 1 {
+		fmt.Printf("Missing package file\n")
+		os.Exit(1)
+	}
+	for _, filename := range args {
+		handleError(deb.VerifyPackage(filename))
+		fmt.Printf("%s is OK\n", filename)
+	}
+}
+
+// buildRepo copies packages into pool and generates the apt indexes for dist
+func buildRepo(pool, dist string, packages []string) {
+	if len(packages) < 1 {
+		fmt.Printf("Missing package file\n")
+		os.Exit(1)
+	}
+	handleError(deb.BuildRepo(pool, dist, packages))
+	fmt.Printf("Added %d package(s) to %s\n", len(packages), filepath.Join(filepath.Dir(filepath.Clean(pool)), "dists", dist))
+}
+
+// doctor checks the environment mkdeb runs in. If a config file is given its
+// directory is checked and tools the config needs are required, otherwise the
+// current directory is checked.
+func doctor(args []string) {
+	dir, err := os.Getwd()
+	handleError(err)
+	var p *deb.PackageSpec
+	if len(args) > 0 {
+		var restore func()
+		p, dir, restore = loadConfig(checkConfig(args))
+		defer restore()
+	}
+
+	failed := 0
+	for _, check := range deb.Doctor(dir, p) {
+		status := "ok"
+		if !check.OK {
+			status = "missing"
+			if check.Required {
+				status = "error"
+				failed++
+			}
+		}
+		fmt.Printf("%-12s %-8s %s\n", check.Name, status, check.Detail)
+	}
+	if failed > 0 {
+		handleError(fmt.Errorf("%d check(s) failed", failed))
+	}
+}
+
 // initialize creates a new mkdeb config. This function is not called init()
 // because that has a special meaning in Go.
 func initialize() {
@@ -85,11 +238,6 @@ func initialize() {
 		handleError(fmt.Errorf("mkdir.json already exists in this directory"))
 	}
 
-	// Create config file
-	file, err := os.Create(target)
-	handleError(err)
-	defer file.Close()
-
 	// Create config struct
 	projectName := filepath.Base(workdir)
 	p := deb.DefaultPackageSpec()
@@ -100,46 +248,67 @@ func initialize() {
 	p.Homepage = "https://www.example.com/project"
 	p.Files = map[string]string{projectName: "/usr/local/bin/" + projectName}
 
-	data, err := json.MarshalIndent(p, "", "  ")
-	handleError(err)
-
-	_, err = file.Write(data)
-	handleError(err)
+	// Create config file
+	handleError(p.Save(target))
 }
 
-func validate(config string) {
-	// Change to config path
-	back, err := os.Getwd()
-	handleError(err)
-	workdir, filename := getAbsPaths(config)
-	err = os.Chdir(workdir)
-	handleError(err)
-	defer os.Chdir(back)
+func validate(config string, strict, quiet bool) {
+	p, _, restore := loadConfig(config)
+	defer restore()
 
 	// Validate
-	p, err := deb.NewPackageSpecFromFile(filename)
-	handleError(err)
 	handleError(p.Validate(false))
+	handleError(checkWarnings(p, strict, quiet))
 }
 
-func build(config, version, target string) {
-	// Change to config path
-	back, err := os.Getwd()
-	handleError(err)
+// buildOptions holds the flags given to the build command
+type buildOptions struct {
+	version   string
+	target    string
+	root      string
+	section   string
+	priority  string
+	defines   stringList
+	strict    bool
+	force     bool
+	keepTemp  bool
+	quiet     bool
+	buildInfo bool
+	verify    bool
+	checksum  bool
+}
 
-	// Get the working directory to cd into and the absolute path to the file
-	workdir, abspath := getAbsPaths(config)
-	err = os.Chdir(workdir)
-	handleError(err)
-	defer os.Chdir(back)
+func build(config string, opts buildOptions) {
+	// The root is relative to where we are, not to the config file
+	root := opts.root
+	if root != "" {
+		_, root = getAbsPaths(root)
+	}
 
-	p, err := deb.NewPackageSpecFromFile(abspath)
-	handleError(err)
+	p, workdir, restore := loadConfig(config)
+	defer restore()
 
 	// Set version
-	p.Version = version
+	p.Version = resolveVersion(opts.version)
+	p.Force = opts.force
+	if opts.keepTemp {
+		p.KeepIntermediate = true
+	}
+	if opts.buildInfo {
+		p.BuildInfo = true
+	}
+	if opts.verify {
+		p.Verify = true
+	}
+	if root != "" {
+		p.AutoPath = root
+		p.RootTree = true
+	}
+	overrideFields(p, opts.section, opts.priority)
+	handleError(defineFields(p, opts.defines))
 
 	// Set target filename
+	target := opts.target
 	if target == "" {
 		target = workdir
 	} else {
@@ -148,12 +317,215 @@ func build(config, version, target string) {
 		}
 	}
 
+	// Hooks run in the config directory and may create files for the package
+	var hookOutput io.Writer = os.Stdout
+	if opts.quiet {
+		hookOutput = ioutil.Discard
+	}
+	handleError(p.RunPreBuild(hookOutput))
+
 	// Validate
 	handleError(p.Validate(true))
+	handleError(checkWarnings(p, opts.strict, opts.quiet))
 
 	// Build
 	handleError(p.Build(target))
-	fmt.Printf("Built package %s\n", path.Join(target, p.Filename()))
+	packages, err := p.Packages()
+	handleError(err)
+	for _, pkg := range packages {
+		if !opts.quiet {
+			summary, err := pkg.Summary(target)
+			handleError(err)
+			fmt.Println(summary)
+		}
+		// The checksum is shown even in quiet mode so it can be used in scripts
+		if opts.checksum {
+			output := path.Join(target, pkg.Filename())
+			sum, size, err := deb.PackageChecksum(output)
+			handleError(err)
+			fmt.Printf("%s  %s (%d bytes)\n", sum, output, size)
+		}
+	}
+
+	// The package is already built so a failed post-build hook is only a
+	// warning
+	if err := p.RunPostBuild(hookOutput); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+	}
+}
+
+// overrideFields replaces the section and priority from the config with the
+// values given to -section and -priority, if they were set.
+func overrideFields(p *deb.PackageSpec, section, priority string) {
+	if section != "" {
+		p.Section = section
+	}
+	if priority != "" {
+		p.Priority = priority
+	}
+}
+
+// stringList collects the values of a flag that may be repeated, like -define
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// defineFields adds each key=value given to -define to the package's extra
+// control fields. The field names are checked when the package is validated.
+func defineFields(p *deb.PackageSpec, defines []string) error {
+	for _, define := range defines {
+		parts := strings.SplitN(define, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("-define %q is invalid; expected key=value like X-Commit=abcd123", define)
+		}
+		if p.ExtraFields == nil {
+			p.ExtraFields = map[string]string{}
+		}
+		p.ExtraFields[parts[0]] = parts[1]
+	}
+	return nil
+}
+
+// addChangelog prepends a new entry for version to debian/changelog next to the
+// config file.
+func addChangelog(config, version, message string) {
+	p, _, restore := loadConfig(config)
+	defer restore()
+
+	if message == "" {
+		handleError(fmt.Errorf("-message is required"))
+	}
+	p.Version = version
+	handleError(p.Validate(true))
+
+	filename := path.Join("debian", "changelog")
+	handleError(p.AddChangelogEntry(filename, message, time.Now()))
+	fmt.Printf("Added %s to %s\n", version, filename)
+}
+
+// name shows the filename the build command will use for a package.
+func name(config, version string) {
+	p, _, restore := loadConfig(config)
+	defer restore()
+
+	p.Version = resolveVersion(version)
+	handleError(p.Validate(true))
+	packages, err := p.Packages()
+	handleError(err)
+	for _, pkg := range packages {
+		fmt.Println(pkg.Filename())
+	}
+}
+
+// render shows the generated control file, md5sums, and conffiles for a
+// package without building it.
+func render(config, version string) {
+	p, _, restore := loadConfig(config)
+	defer restore()
+
+	p.Version = resolveVersion(version)
+	handleError(p.Validate(true))
+
+	cleanup := fetchRemoteFiles(p)
+	defer cleanup()
+
+	control, err := p.RenderControlFile()
+	handleError(err)
+	sums, err := p.CalculateChecksums()
+	handleError(err)
+	conffiles, err := p.ListConffiles()
+	handleError(err)
+
+	fmt.Printf("==> control\n%s\n", control)
+	fmt.Printf("==> md5sums\n%s\n", sums)
+	fmt.Printf("==> conffiles\n")
+	for _, conffile := range conffiles {
+		fmt.Println(conffile)
+	}
+}
+
+// size shows the installed size of a package without building it.
+func size(config string) {
+	p, _, restore := loadConfig(config)
+	defer restore()
+
+	handleError(p.Validate(false))
+	cleanup := fetchRemoteFiles(p)
+	defer cleanup()
+
+	kib, err := p.CalculateSize()
+	handleError(err)
+	// HumanSize is the same as the size in KiB until it switches to MiB
+	if kib < 1024 {
+		fmt.Printf("%d KiB\n", kib)
+	} else {
+		fmt.Printf("%d KiB (%s)\n", kib, deb.HumanSize(kib))
+	}
+}
+
+// fetchRemoteFiles downloads the package's RemoteFiles so commands that don't
+// build the package still include them. Call cleanup to remove the downloads.
+func fetchRemoteFiles(p *deb.PackageSpec) (cleanup func()) {
+	if len(p.RemoteFiles) == 0 {
+		return func() {}
+	}
+	dir, err := ioutil.TempDir(p.TempPath, "mkdeb")
+	handleError(err)
+	if err := p.FetchRemoteFiles(dir); err != nil {
+		os.RemoveAll(dir)
+		handleError(err)
+	}
+	return func() { os.RemoveAll(dir) }
+}
+
+// loadConfig changes to the directory containing the config file so paths in
+// the config are relative to it, and then loads the config. Call restore to
+// change back to the original directory.
+func loadConfig(config string) (p *deb.PackageSpec, workdir string, restore func()) {
+	back, err := os.Getwd()
+	handleError(err)
+
+	// Get the working directory to cd into and the absolute path to the file
+	workdir, abspath := getAbsPaths(config)
+	handleError(os.Chdir(workdir))
+
+	p, err = deb.NewPackageSpecFromFile(abspath)
+	handleError(err)
+	return p, workdir, func() { os.Chdir(back) }
+}
+
+// resolveVersion returns the package version given to -version. If version is
+// "changelog" the version is read from debian/changelog instead. This must be
+// called after loadConfig so the path is relative to the config file.
+func resolveVersion(version string) string {
+	if version != "changelog" {
+		return version
+	}
+	version, err := deb.ChangelogVersion(path.Join("debian", "changelog"))
+	handleError(err)
+	return version
+}
+
+// checkWarnings shows any warnings for the package spec. In strict mode the
+// warnings are returned as an error. In quiet mode the warnings are not shown.
+func checkWarnings(p *deb.PackageSpec, strict, quiet bool) error {
+	warnings := p.Warnings()
+	if !quiet {
+		for _, warning := range warnings {
+			fmt.Printf("Warning: %s\n", warning)
+		}
+	}
+	if strict && len(warnings) > 0 {
+		return fmt.Errorf("Found %d warning(s) in strict mode", len(warnings))
+	}
+	return nil
 }
 
 func isDir(path string) bool {
@@ -163,7 +535,7 @@ func isDir(path string) bool {
 
 func handleError(err error) {
 	if err != nil {
-		fmt.Printf("Error: %s\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
 }
@@ -182,8 +554,16 @@ const usage = `ABOUT
 COMMANDS
 
   build       Build a package based on the specified config file
+  changelog   Add an entry to debian/changelog
+  check       Check that a built .deb is well formed
+  doctor      Check for optional tools and a writable config directory
+  fields      List the control fields mkdeb supports
   init        Create a new mkdeb config file in the current directory
-  archs       List supported CPU architectures
+  name        Show the filename of the package for a given -version
+  render      Show the generated control files without building a package
+  schema      Show a JSON Schema for the config file, for use with editors
+  size        Show the installed size of a package in KiB
+  archs       List supported CPU architectures, or check one like amd64
   validate    Validate your config file
 
 BUILD COMMAND
@@ -192,15 +572,128 @@ BUILD COMMAND
 
   Options:
 
-    -version (required) Package version
+    -version (required) Package version, or "changelog" to use the version
+      from the top entry in debian/changelog
 
     -target (optional) output artifact to this path
 
+    -strict (optional) treat warnings as errors. -Werror does the same.
+
+    -force (optional) overwrite the package if it already exists
+
+    -root (optional) package a prepared root filesystem, where every file is
+      already at its final path and control scripts are in DEBIAN/. Paths in
+      DEBIAN/conffiles are added to conffiles. This replaces autoPath.
+
+    -keep-temp (optional) keep intermediate control.tar.gz and data.tar.gz
+      files for inspection
+
+    -quiet (optional) don't show warnings or the build summary. Errors are
+      still shown on stderr.
+
+    -section (optional) use this section instead of the one in the config
+
+    -priority (optional) use this priority instead of the one in the config
+
+    -build-info (optional) add a line like "Built: 2024-05-01 (abcd123)" to
+      the package description with the build date and git commit. Same as the
+      buildInfo option.
+
+    -verify (optional) read the package back after it is built and check
+      that its archives are intact and match md5sums. Same as the verify
+      option.
+
+    -define (optional) add a control field to the package, like
+      -define X-Commit=abcd123. May be repeated. Fields set in the config's
+      extraFields option are overridden.
+
+    -checksum (optional) print the sha256 checksum and size in bytes of the
+      package after it is built, even with -quiet.
+
   By default the build artifact
 
   The build command will change to the directory where the config file is
   located, so paths should always be specified relative to the config file.
 
+CHANGELOG COMMAND
+
+  mkdeb changelog add -version=1.2.0 -message="Fix a bug" config.json
+
+  Adds a new entry to the top of debian/changelog, next to the config file,
+  signed by the maintainer in the config file. Use -version=changelog with the
+  other commands to build using the version from the changelog.
+
+  Options:
+
+    -version (required) Package version for the new entry
+
+    -message (required) Description of the changes. Each line is listed as a
+      separate change.
+
+ARCHS COMMAND
+
+  mkdeb archs [-json] [arch]
+
+  Lists the supported CPU architectures. If arch is given, exits with an error
+  if it is not supported.
+
+  Options:
+
+    -json (optional) print the list as a JSON array
+
+CHECK COMMAND
+
+  mkdeb check package.deb [package.deb ...]
+
+  Opens each package and checks that its members are debian-binary, control,
+  and data archives in that order, that the control file has the required
+  fields, and that every file in md5sums is in the data archive with the same
+  checksum. Exits with an error on the first package that fails.
+
+DOCTOR COMMAND
+
+  mkdeb doctor [config.json]
+
+  Reports whether optional tools used when packaging (objcopy, xz, gpg, git,
+  and lintian) are installed, and whether the directory containing config.json,
+  or the current directory, is writable. Exits with an error if the directory
+  is not writable, or if config.json sets splitDebug and objcopy is missing.
+  Other missing tools are only reported.
+
+RENDER COMMAND
+
+  mkdeb render -version=1.2.0 config.json
+
+  Shows the control, md5sums, and conffiles that would be written to the
+  package. Accepts the same -version option as build.
+
+REPO COMMAND
+
+  mkdeb repo build [-pool=pool] [-dist=stable] package.deb [package.deb ...]
+
+  Copies each package into the pool, e.g. pool/main/h/hello/, and generates an
+  apt repository in the directory that contains the pool. The Packages index
+  for each architecture is written to dists/stable/main/binary-<arch>/, along
+  with Packages.gz, and dists/stable/Release lists their SHA256 checksums. The
+  indexes include every package in the pool, so you can add packages over
+  several runs. The Release file is not signed.
+
+  Options:
+
+    -pool (optional) directory to copy packages into. Defaults to pool
+
+    -dist (optional) distribution name. Defaults to stable
+
+VALIDATE COMMAND
+
+  mkdeb validate config.json
+
+  Options:
+
+    -strict (optional) treat warnings as errors. -Werror does the same.
+
+    -quiet (optional) don't show warnings. Errors are still shown on stderr.
+
 PACKAGING CONFIGURATION
 
   Required Fields
@@ -209,7 +702,9 @@ PACKAGING CONFIGURATION
   - version: Must adhere to debian version syntax.
   - architecture: CPU arch for your binaries, or "all"
   - maintainer: Your Name <email@example.com>
-  - description: Brief explanation of your package
+  - description: Brief explanation of your package, like "tool for building
+    debian packages". mkdeb warns if it is over 80 characters, starts with an
+    article or the package name, or ends with a full stop.
 
   Optional Fields
 
@@ -217,7 +712,26 @@ PACKAGING CONFIGURATION
   - conflicts: Packages your package are not compatible with
   - breaks: Packages your package breaks
   - replaces: Packages your package replaces
+  - builtUsing: Source packages built into your package, such as statically
+    linked libraries. Each needs an exact version, e.g. "gcc-10 (= 10.2.1-6)"
   - homepage: URL to your project homepage or source repository, if you have one
+  - vcsGit: URL to your project's git repository
+  - vcsBrowser: URL to browse your project's source code
+  - origin: Name of the organization that produced the package
+  - bugs: URL where bugs should be reported
+  - section: Category for your package, such as "utils" or "net". Defaults to
+    misc
+  - priority: One of required, important, standard, optional, or extra. extra
+    is deprecated. Defaults to optional, or extra if section is non-standard
+  - essential: Set to true for base system packages that dpkg must never remove
+  - tags: Debtags for your package, like ["role::program", "implemented-in::go"]
+  - extraFields: Map of additional control fields, like {"X-Commit": "abcd"}
+  - multiArch: One of same, foreign, allowed, or no. Packages marked same
+    should only install files under paths like /usr/lib/x86_64-linux-gnu
+  - testsuite: Test suites for your package, such as autopkgtest
+  - date: Timestamp for the package and every file in it, so rebuilds are
+    identical. Uses RFC 2822 format, e.g. "Wed, 01 May 2024 12:00:00 +0000",
+    and is not written to the control file
 
   For more details on how to specify various config options, refer to the
   debian package specification:
@@ -225,6 +739,20 @@ PACKAGING CONFIGURATION
   - https://www.debian.org/doc/debian-policy/ch-controlfields.html
   - https://www.debian.org/doc/manuals/debian-faq/ch-pkg_basics.en.html
 
+  Multiple Architectures
+
+  - architectures: Build a separate package for each of these architectures
+    instead of the one in architecture. Use {{.Architecture}} in autoPath or
+    files to pick the right binaries, e.g. "autoPath": "build/{{.Architecture}}"
+
+  Shared Fields
+
+  - extends: Path to a base config file, relative to this one. Fields from the
+    base config are used unless you override them here. Lists like depends are
+    added to the lists in the base config, and maps like files are merged.
+    Relative paths in the base config, like autoPath, are relative to this
+    config rather than the base config.
+
 PACKAGING LAYOUT
 
   autoPath
@@ -239,6 +767,91 @@ PACKAGING LAYOUT
   You can override this behavior by setting autoPath to - (dash character) and /
   or by using the Files map to create a custom source -> dest mapping.
 
+  rootTree
+
+  Set rootTree to true if autoPath is a prepared root filesystem laid out for
+  dpkg-deb --build. Control scripts are read from the DEBIAN directory inside
+  autoPath, and DEBIAN is not included in the package. This is the same as
+  build -root.
+
+  exclude
+
+  Files and directories in autoPath matching any of these patterns are skipped,
+  e.g. "*.bak". VCS directories like .git and editor backups like *.swp and *~
+  are always skipped unless you set noDefaultExcludes to true.
+
+  extraRootDirs
+
+  mkdeb warns about files installed outside of the standard top-level
+  directories (usr, etc, var, opt, bin, sbin, lib, srv, and run) since this is
+  usually a typo. List any other top-level directories you intend to use here.
+
+  alternatives
+
+  Registers programs with update-alternatives when the package is installed,
+  and removes them when it is removed. For example:
+
+    "alternatives": [
+      {"link": "/usr/bin/editor", "path": "/usr/bin/vim.tiny", "priority": 50}
+    ]
+
+  The commands are added to postinst and prerm, replacing a #DEBHELPER# line
+  if there is one.
+
+  systemdUnits
+
+  Lists systemd unit files, like "app.service", to install under
+  /lib/systemd/system. postinst enables and starts them and prerm stops and
+  disables them, the same as alternatives. Upgrades restart them instead.
+
+  initScripts
+
+  Lists SysV init scripts to install under /etc/init.d. postinst registers
+  them with update-rc.d and starts them, prerm stops them, and postrm removes
+  them from update-rc.d when the package is purged.
+
+  mkdeb warns about units or init scripts copied into the package some other
+  way, like through autoPath, if there is no postinst to enable them.
+
+  owners
+
+  Maps install paths to the user and group that own them, like "svc:svc" or
+  "1000:1000". Everything else is owned by root. dpkg looks up names when the
+  package is unpacked and uses root if they don't exist yet, so if postinst
+  creates the user it should also chown these files.
+
+  allowWorldWritable
+
+  mkdeb warns about files that anyone can modify, since this is usually a
+  mistake. List the install paths of any files that should be world-writable
+  here, for example "/var/spool/app/drop".
+
+  remoteFiles
+
+  Works like the Files map, but each source is an http(s) URL that is
+  downloaded during the build. Append #sha256=<checksum> to the URL to verify
+  the download. Remote files are executable if they are installed in a bin or
+  sbin directory or look like a script or binary. The render and size commands
+  download them too, so their output includes remote files.
+
+  fromArchive and archiveFiles
+
+  Copies files out of a tar, tar.gz, or zip archive without extracting it.
+  archiveFiles maps each member of the fromArchive archive to its destination,
+  for example "upstream-1.0/bin/upstream": "/usr/bin/upstream"
+
+  prefix
+
+  Prepended to the install path of every file in the package. For example,
+  with a prefix of /opt/vendor, deb-pkg/usr/bin/mysqld is installed to
+  /opt/vendor/usr/bin/mysqld.
+
+  filenameTemplate
+
+  Changes the name of the package file from package-version-arch.deb. This is
+  a Go template that may use fields like {{.Package}}, {{.Version}}, and
+  {{.Architecture}}, and must end in .deb.
+
   Control Scripts
 
   Control scripts allow you to take action at various stages of your package's
@@ -253,6 +866,8 @@ PACKAGING LAYOUT
   - postrm
 
   You can override this behavior by setting the relevant fields in your config.
+  Each field may be a path to a script, or the script itself if it starts with
+  a shebang like #!/bin/sh
 
 BUILD OPTIONS
 
@@ -261,12 +876,83 @@ BUILD OPTIONS
   - tempPath: Controls where intermediate files are written during the build.
     This defaults to the system temp directory.
 
+  - checksumCache: Save the checksums of your files in tempPath, or
+    ~/.cache/mkdeb if tempPath is not set, so they are only calculated again
+    when a file's size or modification time changes.
+
+  - controlCompression, dataCompression: Compression for the control and data
+    archives in the package. One of gzip (the default), xz, or none.
+
+  - compressOver, compressExtensions: Gzip files larger than compressOver
+    bytes whose extension is in compressExtensions, like [".txt", ".json"].
+    They are installed with .gz added to their name. Conffiles, executables,
+    and files that are already compressed are left alone.
+
+  - tarFormat: Tar format for the control and data archives. One of pax (the
+    default), gnu, or ustar. The build fails if a path is too long for the
+    format.
+
+  - buildInfo: Add the build date and git commit to the package description.
+
+  - preBuild, postBuild: Lists of shell commands to run in the config
+    directory before and after the build command builds the package. The build
+    stops if a preBuild command fails, while a failed postBuild command is
+    only a warning. Their output is shown unless -quiet is used.
+
+  - verify: Check the package after it is built. The build fails if the
+    archives can't be read or a file doesn't match md5sums.
+
+  - clampMTime: Use the build time as the modification time of every file in
+    the package, so building the same files always gives the same result.
+
+  - gitMTime: Use the time of the last git commit that changed each file as
+    its modification time. Untracked files get the build time.
+
+  - checksums: Map of source files to their expected sha256 checksum. The
+    build fails if any of these files has a different checksum.
+
+  - sha256Sums: Add a sha256sums file with the sha256 checksum of each file
+    in the package. md5sums is always included for dpkg.
+
+  - inMemory: Build the package in memory instead of writing intermediate
+    files to tempPath. This is faster but uses more memory, so it is best for
+    small and medium sized packages.
+
+  - ignoreFileModes: Use mode 0644 for files, and 0755 for directories and
+    executables, instead of the permissions from the filesystem. Use this if
+    you build on a filesystem without Unix permissions. Always on for Windows.
+
+  - keepIntermediate: Keep the intermediate control.tar.gz and data.tar.gz
+    files after the build instead of removing them. Same as -keep-temp.
+
   - upgradeConfigs: Indicates whether apt should replace files under /etc when
     installing a new package version. By default these files are not upgraded.
 
+  - preserveConfigs: Files under /etc that are exceptions to upgradeConfigs.
+    With upgradeConfigs these are still not upgraded, and without it these are
+    upgraded like regular files.
+
+  - conffiles: Install paths of additional config files outside /etc, like
+    /opt/app/config.yml. These are never replaced by upgradeConfigs.
+
   - preserveSymlinks: By default contents of symlink targets are copied. This
     option writes symlinks to the archive instead.
 
+  - followDirSymlinks: Scan symlinked directories in autoPath as if they were
+    regular directories. By default they are not followed.
+
+  - caseInsensitiveDuplicates: Report files whose paths differ only by case,
+    like etc/Foo and etc/foo, as duplicates.
+
+  - splitDebug: Move debug symbols from binaries into a separate package-dbgsym
+    package, and strip them from the main package. Requires objcopy.
+
+  - debugExtension: File extension of the package-dbgsym package, either deb
+    (the default) or ddeb.
+
+  - templateScripts: Render control scripts as Go templates so they can refer
+    to fields like {{.Package}} and {{.Version}}.
+
 LICENSE
 
   Copyright 2016 Chris Bednarski <banzaimonkey@gmail.com>, and others
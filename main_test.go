@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cbednarski/mkdeb/deb"
+	"github.com/cbednarski/mkdeb/deb/tar"
+	"github.com/laher/argo/ar"
+)
+
+// captureStdout returns everything written to stdout while f runs
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	f()
+	w.Close()
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// TestHelperMain runs main with the arguments in MKDEB_TEST_MAIN, one per
+// line. It does nothing when run normally; see runMain.
+func TestHelperMain(t *testing.T) {
+	args := os.Getenv("MKDEB_TEST_MAIN")
+	if args == "" {
+		return
+	}
+	os.Args = append([]string{"mkdeb"}, strings.Split(args, "\n")...)
+	main()
+	os.Exit(0)
+}
+
+// runMain runs mkdeb with args in a subprocess, so flags are parsed the same
+// way as on the command line and exiting on an error doesn't stop the tests.
+// It returns stdout.
+func runMain(t *testing.T, args ...string) (string, error) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperMain$")
+	cmd.Env = append(os.Environ(), "MKDEB_TEST_MAIN="+strings.Join(args, "\n"))
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		err = fmt.Errorf("mkdeb %s failed: %s\n%s", strings.Join(args, " "), err, stderr)
+	}
+	return string(out), err
+}
+
+func TestBuildQuiet(t *testing.T) {
+	target, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+
+	config := "deb/test-fixtures/example-basic.json"
+	out := captureStdout(t, func() {
+		build(config, buildOptions{version: "0.1.0", target: target, root: "deb/test-fixtures/debian-tree", quiet: true})
+	})
+	if out != "" {
+		t.Errorf("Expected no output in quiet mode, found %q", out)
+	}
+
+	out = captureStdout(t, func() {
+		validate(config, false, true)
+	})
+	if out != "" {
+		t.Errorf("Expected no output in quiet mode, found %q", out)
+	}
+}
+
+func TestCheckWarningsStrict(t *testing.T) {
+	p, err := deb.NewPackageSpecFromFile("deb/test-fixtures/example-basic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Section = "not-a-section"
+	if len(p.Warnings()) == 0 {
+		t.Fatal("Expected the fixture to have a warning")
+	}
+
+	if err := checkWarnings(p, false, true); err != nil {
+		t.Errorf("Expected warnings to be allowed by default, found %s", err)
+	}
+	if err := checkWarnings(p, true, true); err == nil || !strings.Contains(err.Error(), "strict mode") {
+		t.Errorf("Expected warnings to fail in strict mode, found %v", err)
+	}
+}
+
+func TestBuildChecksum(t *testing.T) {
+	target, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+
+	out, err := runMain(t, "build", "-checksum", "-quiet", "-version=0.1.0", "-target="+target,
+		"-root=deb/test-fixtures/debian-tree", "deb/test-fixtures/example-basic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(target, "mkdeb-0.1.0-amd64.deb")
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf("%x  %s (%d bytes)\n", sha256.Sum256(data), filename, len(data))
+	if out != expected {
+		t.Errorf("Expected %q, found %q", expected, out)
+	}
+}
+
+// readControlFile returns the control file from the .deb at filename
+func readControlFile(t *testing.T, filename string) string {
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	archive := ar.NewReader(file)
+	for {
+		header, err := archive.Next()
+		if err != nil {
+			t.Fatalf("Failed to find control.tar.gz in %s: %s", filename, err)
+		}
+		if header.Name != "control.tar.gz" {
+			continue
+		}
+		zipreader, err := gzip.NewReader(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		control := tar.NewReader(zipreader)
+		for {
+			header, err := control.Next()
+			if err != nil {
+				t.Fatalf("Failed to find control in %s: %s", filename, err)
+			}
+			if header.Name == "control" {
+				data, err := ioutil.ReadAll(control)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return string(data)
+			}
+		}
+	}
+}
+
+func TestBuildDefine(t *testing.T) {
+	target, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+
+	config := "deb/test-fixtures/example-basic.json"
+	defines := []string{"X-Commit=abcd123", "Built-By=ci"}
+	captureStdout(t, func() {
+		build(config, buildOptions{version: "0.1.0", target: target, root: "deb/test-fixtures/debian-tree", defines: defines, quiet: true})
+	})
+
+	control := readControlFile(t, filepath.Join(target, "mkdeb-0.1.0-amd64.deb"))
+	expected := "Built-By: ci\nX-Commit: abcd123\nDescription: "
+	if !strings.Contains(control, expected) {
+		t.Errorf("Expected %q in control file\n%s", expected, control)
+	}
+
+	p, err := deb.NewPackageSpecFromFile(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := defineFields(p, []string{"X-Commit"}); err == nil {
+		t.Errorf("Expected -define without a value to be invalid")
+	}
+	if err := defineFields(p, []string{"Bad Field=value"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Validate(false); err == nil || !strings.Contains(err.Error(), `Extra field name "Bad Field" is invalid`) {
+		t.Errorf("Expected invalid field name error, found %v", err)
+	}
+}
+
+func TestBuildVerifyFlag(t *testing.T) {
+	target, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+
+	_, err = runMain(t, "build", "-verify", "-quiet", "-version=0.1.0", "-target="+target,
+		"-root=deb/test-fixtures/debian-tree", "deb/test-fixtures/example-basic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "mkdeb-0.1.0-amd64.deb")); err != nil {
+		t.Errorf("Expected the package to be built: %s", err)
+	}
+}
+
+func TestShowArchs(t *testing.T) {
+	out := captureStdout(t, func() {
+		showArchs([]string{"amd64"}, false)
+	})
+	if out != "amd64 is supported\n" {
+		t.Errorf("Expected amd64 to be supported, found %q", out)
+	}
+
+	out = captureStdout(t, func() {
+		showArchs(nil, true)
+	})
+	archs := []string{}
+	if err := json.Unmarshal([]byte(out), &archs); err != nil {
+		t.Fatalf("Expected a JSON list, found %q: %s", out, err)
+	}
+	if !reflect.DeepEqual(archs, deb.SupportedArchitectures()) {
+		t.Errorf("Expected %+v, found %+v", deb.SupportedArchitectures(), archs)
+	}
+}
+
+func TestShowArchsUnsupported(t *testing.T) {
+	// showArchs exits on error, so run it in a subprocess
+	if os.Getenv("MKDEB_TEST_ARCHS") != "" {
+		showArchs([]string{os.Getenv("MKDEB_TEST_ARCHS")}, false)
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=TestShowArchsUnsupported")
+	cmd.Env = append(os.Environ(), "MKDEB_TEST_ARCHS=x86_64")
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Errorf("Expected exit code 1 for an unsupported arch, found %+v", err)
+	}
+}
+
+func TestBuildOverrideFields(t *testing.T) {
+	target, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+
+	config := "deb/test-fixtures/example-basic.json"
+	captureStdout(t, func() {
+		build(config, buildOptions{version: "0.1.0", target: target, root: "deb/test-fixtures/debian-tree", section: "net", priority: "important", quiet: true})
+	})
+	filename := filepath.Join(target, "mkdeb-0.1.0-amd64.deb")
+	if !deb.FileExists(filename) {
+		t.Fatalf("Expected the package to be built in %s", target)
+	}
+
+	control := readControlFile(t, filename)
+	for _, expected := range []string{"Section: net\n", "Priority: important\n"} {
+		if !strings.Contains(control, expected) {
+			t.Errorf("Expected %q in control file\n%s", expected, control)
+		}
+	}
+
+	p, err := deb.NewPackageSpecFromFile(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overrideFields(p, "net", "important")
+
+	// Fields are left alone if the flags are not set
+	overrideFields(p, "", "")
+	if p.Section != "net" || p.Priority != "important" {
+		t.Errorf("Expected section and priority to be unchanged, found %q %q", p.Section, p.Priority)
+	}
+}
+
+func TestRender(t *testing.T) {
+	out, err := runMain(t, "render", "-version=1.2.3", "deb/test-fixtures/example-package1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"==> control\nPackage: package1\nVersion: 1.2.3\nArchitecture: amd64\n",
+		"Description: Example package with a binary and a config file\n",
+		"==> md5sums\n" +
+			"adcc07f30ee844b18eab61f69f8c32c4  etc/package1/config\n" +
+			"0940b4d946e3e2b8bbfdf5cfcf722518  usr/local/bin/package1\n",
+		"==> conffiles\n/etc/package1/config\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected render output to contain %q\n%s", expected, out)
+		}
+	}
+}
+
+func TestRenderRemoteFiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello\n"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, "mkdeb.json")
+	data := fmt.Sprintf(`{
+	"package": "hello",
+	"architecture": "all",
+	"maintainer": "Chris Bednarski <banzaimonkey@gmail.com>",
+	"description": "Says hello",
+	"remoteFiles": {%q: "/usr/share/hello/hello"}
+}`, server.URL+"/hello")
+	if err := ioutil.WriteFile(config, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runMain(t, "render", "-version=1.0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// echo hello | md5sum
+	expected := "==> md5sums\nb1946ac92492d2347c6235b4d2611184  usr/share/hello/hello\n"
+	if !strings.Contains(out, expected) {
+		t.Errorf("Expected render output to contain %q\n%s", expected, out)
+	}
+}
+
+func TestSize(t *testing.T) {
+	out, err := runMain(t, "size", "deb/test-fixtures/example-package1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// package1 has a 29 byte config and a 24 byte binary, rounded up to 1 KiB
+	if out != "1 KiB\n" {
+		t.Errorf("Expected size 1 KiB, found %q", out)
+	}
+
+	// Larger packages also show the size in MiB
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "mkdeb.json")
+	data := `{
+	"package": "hello",
+	"architecture": "all",
+	"maintainer": "Chris Bednarski <banzaimonkey@gmail.com>",
+	"description": "Says hello",
+	"autoPath": "deb-pkg"
+}`
+	if err := ioutil.WriteFile(config, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "deb-pkg", "usr", "share", "hello"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "deb-pkg", "usr", "share", "hello", "data"), make([]byte, 1536*1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err = runMain(t, "size", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "1536 KiB (1.5 MiB)\n" {
+		t.Errorf("Expected size 1536 KiB (1.5 MiB), found %q", out)
+	}
+}
+
+func TestName(t *testing.T) {
+	out, err := runMain(t, "name", "-version=1.2.3", "deb/test-fixtures/example-basic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "mkdeb-1.2.3-amd64.deb\n" {
+		t.Errorf("Expected mkdeb-1.2.3-amd64.deb, found %q", out)
+	}
+
+	// filenameTemplate changes the name
+	dir, err := ioutil.TempDir("", "mkdeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "mkdeb.json")
+	data := `{
+	"package": "mkdeb",
+	"architecture": "amd64",
+	"maintainer": "Chris Bednarski <banzaimonkey@gmail.com>",
+	"description": "CLI tool for building debian packages",
+	"filenameTemplate": "{{.Package}}_{{.Version}}_{{.Architecture}}.deb"
+}`
+	if err := ioutil.WriteFile(config, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err = runMain(t, "name", "-version=1.2.3", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "mkdeb_1.2.3_amd64.deb\n" {
+		t.Errorf("Expected mkdeb_1.2.3_amd64.deb, found %q", out)
+	}
+}